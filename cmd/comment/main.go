@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	_ "github.com/lib/pq"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/httpmetrics"
+	"otel-playground/internal/server"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry"
+)
+
+// 一覧の件数（by-author と latest の limit）
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type Comment struct {
+	ID         int    `json:"id"`
+	PostID     int    `json:"post_id"`
+	AuthorName string `json:"author_name"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// commentInput は POST /comments で受け付けるフィールド。id と created_at はサーバーが決める
+type commentInput struct {
+	PostID     int    `json:"post_id"`
+	AuthorName string `json:"author_name"`
+	Content    string `json:"content"`
+}
+
+type CommentService struct {
+	faults  *faultinject.Injector
+	health  *health.Checker
+	store   CommentStore
+	metrics *httpmetrics.Metrics
+	// faultAdmin なら障害注入ルールを変更する API を登録する
+	faultAdmin bool
+}
+
+func initServiceMetrics() (*CommentService, error) {
+	s := &CommentService{}
+	metrics, err := httpmetrics.New(otel.Meter("comment-service"), "comment_service", httpmetrics.Options{
+		// ヘルスチェックは otelhttp と同じくメトリクスにも数えない
+		Filter: func(r *http.Request) bool { return s.health.Filter(r) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.metrics = metrics
+	return s, nil
+}
+
+func initDB(dsn string) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// エラーをスパンに記録するヘルパー関数
+func recordError(span oteltrace.Span, err error, description string) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, description)
+	}
+}
+
+// writeError はスパンにエラーを記録してからレスポンスを返す。5xx の詳細はクライアントに返さない
+func writeError(ctx context.Context, w http.ResponseWriter, status int, err error, description string) {
+	errorType := http.StatusText(status)
+	var cerr *ConstraintError
+	if errors.As(err, &cerr) {
+		errorType = cerr.Code
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCodeKey.Int(status),
+			semconv.ErrorTypeKey.String(errorType),
+		)
+		if cerr != nil {
+			span.SetAttributes(
+				attribute.String("db.response.status_code", cerr.Code),
+				attribute.String("db.postgresql.constraint", cerr.Constraint),
+			)
+		}
+		recordError(span, err, description)
+	}
+
+	if status >= http.StatusInternalServerError {
+		http.Error(w, "internal server error", status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (s *CommentService) writeComments(ctx context.Context, w http.ResponseWriter, comments []Comment, err error) {
+	if err != nil {
+		writeError(ctx, w, http.StatusInternalServerError, err, "Failed to get comments")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("comments.count", len(comments)),
+			serverspan.RowsKey.Int(len(comments)),
+		)
+	}
+
+	// レスポンスヘッダーにトレース情報を注入
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+	// JSONレスポンスを返す
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(comments); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseLimit は limit クエリを 1〜maxLimit に制限する。省略時は defaultLimit
+func parseLimit(r *http.Request) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(limitStr)
+	if err != nil || n <= 0 || n > maxLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	return n, nil
+}
+
+func (s *CommentService) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 投稿IDをクエリパラメータから取得
+	postIDStr := r.URL.Query().Get("post_id")
+	if postIDStr == "" {
+		writeError(ctx, w, http.StatusBadRequest, errors.New("post_id is required"), "Invalid query parameters")
+		return
+	}
+
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil || postID <= 0 {
+		writeError(ctx, w, http.StatusBadRequest, errors.New("invalid post_id"), "Invalid query parameters")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("post.id", postID))
+	}
+
+	comments, err := s.store.PostComments(ctx, postID)
+	s.writeComments(ctx, w, comments, err)
+}
+
+func (s *CommentService) getAuthorCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		writeError(ctx, w, http.StatusBadRequest, errors.New("author is required"), "Invalid query parameters")
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid query parameters")
+		return
+	}
+
+	comments, err := s.store.AuthorComments(ctx, author, limit)
+	s.writeComments(ctx, w, comments, err)
+}
+
+func (s *CommentService) getLatestCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid query parameters")
+		return
+	}
+
+	comments, err := s.store.LatestComments(ctx, limit)
+	s.writeComments(ctx, w, comments, err)
+}
+
+func (s *CommentService) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var in commentInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err), "Invalid comment input")
+		return
+	}
+	if in.PostID <= 0 || in.AuthorName == "" || in.Content == "" {
+		writeError(ctx, w, http.StatusBadRequest, errors.New("post_id, author_name and content are required"), "Invalid comment input")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("post.id", in.PostID))
+	}
+
+	comment := Comment{PostID: in.PostID, AuthorName: in.AuthorName, Content: in.Content}
+	if err := s.store.CreateComment(ctx, &comment); err != nil {
+		var cerr *ConstraintError
+		if errors.As(err, &cerr) && cerr.IsForeignKey() {
+			// 存在しない post_id はクライアントの誤りなので 500 ではなく 422 にする
+			writeError(ctx, w, http.StatusUnprocessableEntity,
+				fmt.Errorf("post %d does not exist: %w", in.PostID, err), "Referenced post does not exist")
+			return
+		}
+		writeError(ctx, w, http.StatusInternalServerError, err, "Failed to create comment")
+		return
+	}
+
+	// レスポンスヘッダーにトレース情報を注入
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		slog.ErrorContext(ctx, "failed to encode response", "error", err)
+	}
+}
+
+// routes はエンドポイントを登録し、otelhttp で計装したハンドラを返す
+func (s *CommentService) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /comments/by-post", s.getPostCommentsHandler)
+	mux.HandleFunc("GET /comments/by-author", s.getAuthorCommentsHandler)
+	mux.HandleFunc("GET /comments/latest", s.getLatestCommentsHandler)
+	mux.HandleFunc("POST /comments", s.createCommentHandler)
+	s.health.Register(mux)
+	if s.faultAdmin {
+		s.faults.Register(mux)
+	}
+
+	// 障害注入はサーバースパンに記録するため otelhttp の内側に置き、
+	// 注入した遅延やエラーもリクエストメトリクスに含まれるようメトリクスの内側に置く
+	handler := s.metrics.Middleware(mux, s.faults.Middleware(mux))
+	return serverspan.NewHandler(mux, handler, "comment-service", otelhttp.WithFilter(s.health.Filter))
+}
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// -h は使い方を表示して正常終了する
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+// run はシグナル受信時やエラー時にも defer（DB クローズ、テレメトリーのフラッシュ）が実行されるよう main から分けている
+func run() error {
+	cfg, err := config.LoadService("comment-service", config.Service{
+		ListenAddr:  ":8082",
+		DatabaseDSN: config.DefaultDatabaseDSN,
+	}, os.Args[1:])
+	if err != nil {
+		return err
+	}
+	cfg.Print(os.Stdout)
+
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{ServiceName: "comment-service"})
+	if err != nil {
+		return err
+	}
+	defer telemetry.Shutdown(shutdown)
+
+	db, err := initDB(cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service, err := initServiceMetrics()
+	if err != nil {
+		return err
+	}
+	service.store = newPostgresCommentStore(db)
+	if service.faults, err = faultinject.Load(cfg.FaultRulesFile); err != nil {
+		return err
+	}
+	service.faultAdmin = cfg.FaultAdmin
+
+	service.health = health.New("comment-service", health.Options{
+		Timeout:     cfg.HealthCheckTimeout,
+		TraceChecks: cfg.TraceHealthChecks,
+	})
+	service.health.Add("database", true, db.PingContext)
+	service.health.Add("otlp_exporter", false, telemetry.CheckExport)
+
+	handler := service.routes()
+
+	fmt.Printf("🚀 Comment service starting on %s\n", cfg.ListenAddr)
+	fmt.Println("📊 Endpoints:")
+	fmt.Println("  GET /comments/by-post?post_id=1 - Get comments of a post")
+	fmt.Println("  GET /comments/by-author?author=Developer123&limit=10 - Get latest N comments by author")
+	fmt.Println("  GET /comments/latest?limit=10 - Get latest N comments")
+	fmt.Println("  POST /comments - Create a comment (422 if post_id does not exist)")
+	fmt.Println("  GET /livez - Liveness probe")
+	fmt.Println("  GET /readyz, GET /health - Readiness with per-component checks")
+	if cfg.FaultAdmin {
+		fmt.Println("  GET|PUT|POST|DELETE /admin/faults - Fault-injection rules (unauthenticated)")
+	}
+	fmt.Println("📈 Traces sent to Jaeger: http://localhost:16686")
+	fmt.Printf("📊 Metrics exported to OTLP: %s\n", telemetry.Target("metrics"))
+	fmt.Printf("📝 Logs (with trace_id/span_id) exported to OTLP: %s\n", telemetry.Target("logs"))
+
+	srv := server.New(cfg.ListenAddr, handler, server.Options{
+		Name:            "comment-service",
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	})
+	// 停止が始まったら readiness を落とす
+	service.health.Add("server", true, srv.CheckReady)
+	return srv.Run(context.Background())
+}
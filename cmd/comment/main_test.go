@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// newTestService は本番と同じルーティングでメモリストアを使うサービスを作る
+func newTestService(t *testing.T, store *memoryCommentStore) (*telemetrytest.Harness, http.Handler) {
+	t.Helper()
+
+	h := telemetrytest.New(t)
+	service, err := initServiceMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.store = store
+	if service.faults, err = faultinject.Load("../../faults/comment-service.json"); err != nil {
+		t.Fatal(err)
+	}
+	service.health = health.New("comment-service", health.Options{})
+	return h, service.routes()
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func seedComments() []Comment {
+	return []Comment{
+		{ID: 1, PostID: 1, AuthorName: "alice", Content: "a", CreatedAt: "2024-01-01T00:00:00Z"},
+		{ID: 2, PostID: 2, AuthorName: "alice", Content: "b", CreatedAt: "2024-02-01T00:00:00Z"},
+		{ID: 3, PostID: 1, AuthorName: "bob", Content: "c", CreatedAt: "2024-03-01T00:00:00Z"},
+		{ID: 4, PostID: 1, AuthorName: "alice", Content: "d", CreatedAt: "2024-03-01T00:00:00Z"},
+	}
+}
+
+// commentIDs は 200 のレスポンスを読んでコメントの ID を並び順のまま返す
+func commentIDs(t *testing.T, w *httptest.ResponseRecorder) []int {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var comments []Comment
+	if err := json.NewDecoder(w.Body).Decode(&comments); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestListOrdering(t *testing.T) {
+	_, handler := newTestService(t, newMemoryCommentStore(nil, seedComments()...))
+
+	tests := []struct {
+		target string
+		want   []int
+	}{
+		// 投稿のコメントは古い順、それ以外は新しい順。同時刻は ID で並べる
+		{"/comments/by-post?post_id=1", []int{1, 3, 4}},
+		{"/comments/by-post?post_id=9", []int{}},
+		{"/comments/by-author?author=alice", []int{4, 2, 1}},
+		{"/comments/by-author?author=alice&limit=2", []int{4, 2}},
+		{"/comments/latest", []int{4, 3, 2, 1}},
+		{"/comments/latest?limit=1", []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got := commentIDs(t, serve(handler, httptest.NewRequest(http.MethodGet, tt.target, nil)))
+			if len(got) != len(tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ids = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestListInvalidQuery(t *testing.T) {
+	_, handler := newTestService(t, newMemoryCommentStore(nil, seedComments()...))
+
+	for _, target := range []string{
+		"/comments/by-post",
+		"/comments/by-post?post_id=abc",
+		"/comments/by-post?post_id=0",
+		"/comments/by-post?post_id=-1",
+		"/comments/by-author",
+		"/comments/by-author?author=alice&limit=abc",
+		"/comments/by-author?author=alice&limit=0",
+		"/comments/by-author?author=alice&limit=101",
+		"/comments/latest?limit=abc",
+		"/comments/latest?limit=0",
+		"/comments/latest?limit=101",
+	} {
+		t.Run(target, func(t *testing.T) {
+			if w := serve(handler, httptest.NewRequest(http.MethodGet, target, nil)); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCreateComment(t *testing.T) {
+	store := newMemoryCommentStore([]int{1}, seedComments()...)
+	_, handler := newTestService(t, store)
+
+	body := strings.NewReader(`{"post_id":1,"author_name":"carol","content":"hello"}`)
+	w := serve(handler, httptest.NewRequest(http.MethodPost, "/comments", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+	}
+	var created Comment
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 5 || created.CreatedAt == "" {
+		t.Errorf("created = %+v, want ID 5 with created_at", created)
+	}
+
+	ids := commentIDs(t, serve(handler, httptest.NewRequest(http.MethodGet, "/comments/latest?limit=1", nil)))
+	if len(ids) != 1 || ids[0] != 5 {
+		t.Errorf("latest = %v, want the new comment first", ids)
+	}
+}
+
+func TestCreateCommentInvalidBody(t *testing.T) {
+	for _, body := range []string{
+		`{"post_id":1,"author_name":"carol","content":"hello","author":"carol"}`,
+		// ID と作成日時はサーバーが決める
+		`{"id":99,"post_id":1,"author_name":"carol","content":"hello"}`,
+		`{"post_id":1,"author_name":"carol","content":"hello","created_at":"2000-01-01T00:00:00Z"}`,
+		`{"post_id":0,"author_name":"carol","content":"hello"}`,
+		`{"post_id":1,"content":"hello"}`,
+		`not json`,
+	} {
+		t.Run(body, func(t *testing.T) {
+			h, handler := newTestService(t, newMemoryCommentStore([]int{1}))
+
+			w := serve(handler, httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(body)))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+			server := h.Span(t, "POST /comments")
+			if server.Status.Code != codes.Error || server.Status.Description != "Invalid comment input" {
+				t.Errorf("status = %+v, want Error/Invalid comment input", server.Status)
+			}
+			if got := telemetrytest.Attr(server, semconv.HTTPResponseStatusCodeKey).AsInt64(); got != 400 {
+				t.Errorf("http.response.status_code = %d, want 400", got)
+			}
+		})
+	}
+}
+
+func TestCreateCommentUnknownPost(t *testing.T) {
+	h, handler := newTestService(t, newMemoryCommentStore([]int{1}))
+
+	body := strings.NewReader(`{"post_id":7,"author_name":"carol","content":"hello"}`)
+	w := serve(handler, httptest.NewRequest(http.MethodPost, "/comments", body))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", w.Code, w.Body)
+	}
+
+	server := h.Span(t, "POST /comments")
+	if server.Status.Code != codes.Error {
+		t.Errorf("status = %+v, want Error", server.Status)
+	}
+	for key, want := range map[attribute.Key]string{
+		"error.type":               pgForeignKeyViolation,
+		"db.response.status_code":  pgForeignKeyViolation,
+		"db.postgresql.constraint": "comments_post_id_fkey",
+	} {
+		if got := telemetrytest.Attr(server, key).AsString(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	requests := telemetrytest.SumPoint[int64](t, h.Metric(t, "comment_service_requests_total"),
+		semconv.HTTPRouteKey.String("/comments"),
+		semconv.HTTPResponseStatusCodeKey.Int(http.StatusUnprocessableEntity),
+	)
+	if requests.Value != 1 {
+		t.Errorf("comment_service_requests_total = %d, want 1", requests.Value)
+	}
+}
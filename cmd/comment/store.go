@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Postgres のエラーコード
+const pgForeignKeyViolation = "23503"
+
+// ConstraintError は Postgres の制約違反を表す型付きエラー
+type ConstraintError struct {
+	// Code は SQLSTATE（例: 23503 foreign_key_violation）
+	Code       string
+	Constraint string
+	Detail     string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %s violated (%s): %s", e.Constraint, e.Code, e.Detail)
+}
+
+func (e *ConstraintError) Unwrap() error { return e.Err }
+
+// IsForeignKey reports whether the violated constraint is a foreign key.
+func (e *ConstraintError) IsForeignKey() bool { return e.Code == pgForeignKeyViolation }
+
+// CommentStore は comments テーブルへのアクセスを抽象化する
+//
+// 一覧は post_id なら古い順、それ以外は新しい順に並べる。制約違反は *ConstraintError を返す。
+type CommentStore interface {
+	PostComments(ctx context.Context, postID int) ([]Comment, error)
+	AuthorComments(ctx context.Context, author string, limit int) ([]Comment, error)
+	LatestComments(ctx context.Context, limit int) ([]Comment, error)
+	// CreateComment は採番した ID と作成日時を c に書き戻す
+	CreateComment(ctx context.Context, c *Comment) error
+}
+
+// postgresCommentStore は otelsql で計装された *sql.DB を使う CommentStore
+type postgresCommentStore struct {
+	db *sql.DB
+}
+
+func newPostgresCommentStore(db *sql.DB) *postgresCommentStore {
+	return &postgresCommentStore{db: db}
+}
+
+func (s *postgresCommentStore) queryComments(ctx context.Context, query string, args ...any) ([]Comment, error) {
+	// SQL操作は otelsql で自動計装されるため、手動スパン不要
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.AuthorName, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+func (s *postgresCommentStore) PostComments(ctx context.Context, postID int) ([]Comment, error) {
+	return s.queryComments(ctx, `
+		SELECT id, post_id, author_name, content, created_at
+		FROM comments
+		WHERE post_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, postID)
+}
+
+func (s *postgresCommentStore) AuthorComments(ctx context.Context, author string, limit int) ([]Comment, error) {
+	return s.queryComments(ctx, `
+		SELECT id, post_id, author_name, content, created_at
+		FROM comments
+		WHERE author_name = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, author, limit)
+}
+
+func (s *postgresCommentStore) LatestComments(ctx context.Context, limit int) ([]Comment, error) {
+	return s.queryComments(ctx, `
+		SELECT id, post_id, author_name, content, created_at
+		FROM comments
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+}
+
+func (s *postgresCommentStore) CreateComment(ctx context.Context, c *Comment) error {
+	query := `
+		INSERT INTO comments (post_id, author_name, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	err := s.db.QueryRowContext(ctx, query, c.PostID, c.AuthorName, c.Content).Scan(&c.ID, &c.CreatedAt)
+	return constraintError(err)
+}
+
+// constraintError は Postgres の整合性制約違反（クラス 23）を ConstraintError に変換する
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "23" {
+		return &ConstraintError{
+			Code:       string(pqErr.Code),
+			Constraint: pqErr.Constraint,
+			Detail:     pqErr.Detail,
+			Err:        err,
+		}
+	}
+	return err
+}
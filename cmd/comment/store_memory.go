@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryCommentStore は DB なしで動く CommentStore。ハンドラのテストやデモに使う
+type memoryCommentStore struct {
+	mu       sync.Mutex
+	comments []Comment
+	posts    map[int]bool // nil なら post_id の外部キーを検査しない
+	nextID   int
+}
+
+// newMemoryCommentStore は seed のコメントを ID そのままで登録する。
+// postIDs を渡すと、それ以外の post_id での作成を外部キー違反にする
+func newMemoryCommentStore(postIDs []int, seed ...Comment) *memoryCommentStore {
+	s := &memoryCommentStore{nextID: 1}
+	if postIDs != nil {
+		s.posts = map[int]bool{}
+		for _, id := range postIDs {
+			s.posts[id] = true
+		}
+	}
+	for _, c := range seed {
+		if c.CreatedAt == "" {
+			c.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		s.comments = append(s.comments, c)
+		if c.ID >= s.nextID {
+			s.nextID = c.ID + 1
+		}
+	}
+	return s
+}
+
+// list は keep に一致するコメントを SQL と同じ並び順（created_at, id）で最大 limit 件（0 なら全件）返す
+func (s *memoryCommentStore) list(keep func(Comment) bool, ascending bool, limit int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments := []Comment{}
+	for _, c := range s.comments {
+		if keep(c) {
+			comments = append(comments, c)
+		}
+	}
+	// created_at は RFC3339 の UTC なので文字列の比較で時刻順になる
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if !ascending {
+			a, b = b, a
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return a.ID < b.ID
+	})
+	if limit > 0 && len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments
+}
+
+func (s *memoryCommentStore) PostComments(ctx context.Context, postID int) ([]Comment, error) {
+	return s.list(func(c Comment) bool { return c.PostID == postID }, true, 0), nil
+}
+
+func (s *memoryCommentStore) AuthorComments(ctx context.Context, author string, limit int) ([]Comment, error) {
+	return s.list(func(c Comment) bool { return c.AuthorName == author }, false, limit), nil
+}
+
+func (s *memoryCommentStore) LatestComments(ctx context.Context, limit int) ([]Comment, error) {
+	return s.list(func(Comment) bool { return true }, false, limit), nil
+}
+
+func (s *memoryCommentStore) CreateComment(ctx context.Context, c *Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.posts != nil && !s.posts[c.PostID] {
+		return &ConstraintError{
+			Code:       pgForeignKeyViolation,
+			Constraint: "comments_post_id_fkey",
+			Detail:     fmt.Sprintf("Key (post_id)=(%d) is not present in table \"posts\".", c.PostID),
+		}
+	}
+	c.ID = s.nextID
+	s.nextID++
+	c.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	s.comments = append(s.comments, *c)
+	return nil
+}
@@ -0,0 +1,252 @@
+// fakeapi は JSONPlaceholder の /posts を真似るローカルのスタブサーバー
+//
+// オーケストレーターの -external-api-url の既定値はこのサーバーなので、
+// ネットワークに出ずにトポロジー全体を動かせる。遅延とエラー率を設定して
+// リトライやサーキットブレーカーの挙動を再現することもできる。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/health"
+	"otel-playground/internal/server"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry"
+)
+
+// Post は JSONPlaceholder の /posts と同じ形
+type Post struct {
+	UserID int    `json:"userId"`
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+type FakeAPI struct {
+	health *health.Checker
+	posts  map[int]Post
+	ids    []int // /posts の並び順
+
+	latency     time.Duration
+	jitter      time.Duration
+	errorRate   float64
+	errorStatus int
+}
+
+func newFakeAPI(cfg *config.FakeAPI, posts []Post) (*FakeAPI, error) {
+	api := &FakeAPI{
+		health: health.New("fakeapi", health.Options{
+			Timeout:     cfg.HealthCheckTimeout,
+			TraceChecks: cfg.TraceHealthChecks,
+		}),
+		posts:       make(map[int]Post, len(posts)),
+		latency:     cfg.Latency,
+		jitter:      cfg.LatencyJitter,
+		errorRate:   cfg.ErrorRate,
+		errorStatus: cfg.ErrorStatus,
+	}
+	for _, p := range posts {
+		if p.ID <= 0 {
+			return nil, fmt.Errorf("fakeapi: post id must be positive, got %d", p.ID)
+		}
+		if _, ok := api.posts[p.ID]; ok {
+			return nil, fmt.Errorf("fakeapi: duplicate post id %d", p.ID)
+		}
+		api.posts[p.ID] = p
+		api.ids = append(api.ids, p.ID)
+	}
+	sort.Ints(api.ids)
+	return api, nil
+}
+
+// generatePosts は JSONPlaceholder と同じく 1 ユーザーあたり 10 件の投稿を作る
+func generatePosts(n int) []Post {
+	posts := make([]Post, n)
+	for i := range posts {
+		id := i + 1
+		posts[i] = Post{
+			UserID: (id-1)/10 + 1,
+			ID:     id,
+			Title:  fmt.Sprintf("fake post %d", id),
+			Body:   fmt.Sprintf("This post is served by cmd/fakeapi in place of JSONPlaceholder post %d.", id),
+		}
+	}
+	return posts
+}
+
+func loadPayloads(path string) ([]Post, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var posts []Post
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, fmt.Errorf("fakeapi: parse %s: %w", path, err)
+	}
+	return posts, nil
+}
+
+// delay は設定された遅延だけ待つ。クライアントが切断したら早めに戻る
+func (a *FakeAPI) delay(ctx context.Context) time.Duration {
+	d := a.latency
+	if a.jitter > 0 {
+		d += time.Duration(rand.Int64N(int64(2*a.jitter+1))) - a.jitter
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return d
+}
+
+// simulate は遅延とエラー注入を行い、エラーを返したら true を返す
+func (a *FakeAPI) simulate(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+	d := a.delay(ctx)
+	injected := a.errorRate > 0 && rand.Float64() < a.errorRate
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int64("fakeapi.latency_ms", d.Milliseconds()),
+			attribute.Bool("fakeapi.injected_error", injected),
+		)
+	}
+	if injected {
+		http.Error(w, http.StatusText(a.errorStatus), a.errorStatus)
+	}
+	return injected
+}
+
+func (a *FakeAPI) getPostHandler(w http.ResponseWriter, r *http.Request) {
+	if a.simulate(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	post, ok := a.posts[id]
+	if err != nil || !ok {
+		// JSONPlaceholder は存在しない投稿に 404 と {} を返す
+		writeJSON(r.Context(), w, http.StatusNotFound, struct{}{})
+		return
+	}
+	writeJSON(r.Context(), w, http.StatusOK, post)
+}
+
+func (a *FakeAPI) listPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if a.simulate(w, r) {
+		return
+	}
+
+	userID, filter := 0, r.URL.Query().Has("userId")
+	if filter {
+		n, err := strconv.Atoi(r.URL.Query().Get("userId"))
+		if err != nil {
+			http.Error(w, "invalid userId", http.StatusBadRequest)
+			return
+		}
+		userID = n
+	}
+
+	posts := []Post{}
+	for _, id := range a.ids {
+		if p := a.posts[id]; !filter || p.UserID == userID {
+			posts = append(posts, p)
+		}
+	}
+	writeJSON(r.Context(), w, http.StatusOK, posts)
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(ctx, "failed to encode response", "error", err)
+	}
+}
+
+// routes はエンドポイントを登録し、HTTP計装でラップしたハンドラーを返す（スパン名は "GET /posts/{id}" のようにルートで付ける）
+func (a *FakeAPI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /posts/{id}", a.getPostHandler)
+	mux.HandleFunc("GET /posts", a.listPostsHandler)
+	a.health.Register(mux)
+
+	return serverspan.NewHandler(mux, mux, "fakeapi", otelhttp.WithFilter(a.health.Filter))
+}
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// -h は使い方を表示して正常終了する
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+// run はシグナル受信時やエラー時にもテレメトリーのフラッシュが実行されるよう main から分けている
+func run() error {
+	cfg, err := config.LoadFakeAPI(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	cfg.Print(os.Stdout)
+
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{ServiceName: "fakeapi"})
+	if err != nil {
+		return err
+	}
+	defer telemetry.Shutdown(shutdown)
+
+	posts := generatePosts(cfg.Posts)
+	if cfg.PayloadsFile != "" {
+		if posts, err = loadPayloads(cfg.PayloadsFile); err != nil {
+			return err
+		}
+	}
+	api, err := newFakeAPI(cfg, posts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🚀 Fake JSONPlaceholder API starting on %s (%d posts)\n", cfg.ListenAddr, len(api.ids))
+	fmt.Println("📊 Endpoints:")
+	fmt.Println("  GET /posts/1 - Get a post")
+	fmt.Println("  GET /posts?userId=1 - List posts, optionally by user")
+	fmt.Println("  GET /livez - Liveness probe")
+	fmt.Println("  GET /readyz, GET /health - Readiness with per-component checks")
+	fmt.Printf("🎲 Latency %s ±%s, error rate %g (status %d)\n", cfg.Latency, cfg.LatencyJitter, cfg.ErrorRate, cfg.ErrorStatus)
+
+	api.health.Add("otlp_exporter", false, telemetry.CheckExport)
+	srv := server.New(cfg.ListenAddr, api.routes(), server.Options{
+		Name:            "fakeapi",
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	})
+	// 停止が始まったら readiness を落とす
+	api.health.Add("server", true, srv.CheckReady)
+	return srv.Run(context.Background())
+}
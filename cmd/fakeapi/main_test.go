@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+func newTestAPI(t *testing.T, mutate func(*config.FakeAPI), posts ...Post) http.Handler {
+	t.Helper()
+
+	cfg := config.DefaultFakeAPI()
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	if posts == nil {
+		posts = generatePosts(cfg.Posts)
+	}
+	api, err := newFakeAPI(&cfg, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api.routes()
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestGetPost(t *testing.T) {
+	telemetrytest.New(t)
+	h := newTestAPI(t, nil)
+
+	w := get(h, "/posts/12")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var post Post
+	if err := json.NewDecoder(w.Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	if post.ID != 12 || post.UserID != 2 || post.Title == "" {
+		t.Errorf("post = %+v, want id 12 of user 2", post)
+	}
+
+	for _, target := range []string{"/posts/101", "/posts/abc"} {
+		if w := get(h, target); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, w.Code)
+		}
+	}
+}
+
+func TestListPostsByUser(t *testing.T) {
+	telemetrytest.New(t)
+	h := newTestAPI(t, nil)
+
+	var posts []Post
+	if err := json.NewDecoder(get(h, "/posts?userId=3").Body).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 10 || posts[0].ID != 21 || posts[9].ID != 30 {
+		t.Errorf("got %d posts starting at %d, want ids 21-30", len(posts), posts[0].ID)
+	}
+}
+
+func TestInjectedErrorsAndLatency(t *testing.T) {
+	harness := telemetrytest.New(t)
+	h := newTestAPI(t, func(c *config.FakeAPI) {
+		c.Latency = 20 * time.Millisecond
+		c.ErrorRate = 1
+		c.ErrorStatus = http.StatusBadGateway
+	})
+
+	start := time.Now()
+	if w := get(h, "/posts/1"); w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("responded after %v, want at least 20ms", elapsed)
+	}
+
+	span := harness.Span(t, "GET /posts/{id}")
+	if !telemetrytest.Attr(span, "fakeapi.injected_error").AsBool() {
+		t.Error("fakeapi.injected_error is not set on the server span")
+	}
+	if got := telemetrytest.Attr(span, "fakeapi.latency_ms").AsInt64(); got != 20 {
+		t.Errorf("fakeapi.latency_ms = %d, want 20", got)
+	}
+}
+
+func TestPayloadsFile(t *testing.T) {
+	telemetrytest.New(t)
+	path := filepath.Join(t.TempDir(), "posts.json")
+	if err := os.WriteFile(path, []byte(`[{"userId": 7, "id": 42, "title": "custom", "body": "from file"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := loadPayloads(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestAPI(t, nil, posts...)
+
+	var post Post
+	if err := json.NewDecoder(get(h, "/posts/42").Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "custom" || post.UserID != 7 {
+		t.Errorf("post = %+v, want the one from the payloads file", post)
+	}
+	if w := get(h, "/posts/1"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /posts/1 = %d, want 404 when not in the payloads file", w.Code)
+	}
+
+	if _, err := newFakeAPI(&config.FakeAPI{}, []Post{{ID: 1}, {ID: 1}}); err == nil {
+		t.Error("duplicate ids were accepted")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"otel-playground/internal/jaegerapi"
+	"otel-playground/internal/promapi"
+	"otel-playground/internal/promtext"
+)
+
+// unavailableError は確認先に到達できなかったことを表す（終了コード 3）
+type unavailableError struct {
+	url string
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%s is unreachable: %v", e.url, e.err)
+}
+
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// statusError は 2xx 以外の応答。本文はエラーメッセージの抽出に使う
+type statusError struct {
+	url  string
+	code int
+	body []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: HTTP %d", e.url, e.code)
+}
+
+// fetch は GET して本文を返す。接続できなければ unavailableError、2xx 以外なら statusError
+func (c *checker) fetch(ctx context.Context, rawURL string, header http.Header) ([]byte, error) {
+	body, _, err := c.fetchWithHeader(ctx, rawURL, header)
+	return body, err
+}
+
+// fetchWithHeader は fetch に加えて応答ヘッダーを返す
+func (c *checker) fetchWithHeader(ctx context.Context, rawURL string, header http.Header) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, &unavailableError{url: rawURL, err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, &unavailableError{url: rawURL, err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, resp.Header, &statusError{url: rawURL, code: resp.StatusCode, body: body}
+	}
+	return body, resp.Header, nil
+}
+
+// getUser は user-service に 1 件リクエストし、ステータスと所要時間を返す
+func (c *checker) getUser(ctx context.Context, id int) (int, time.Duration, error) {
+	start := time.Now()
+	_, err := c.fetch(ctx, fmt.Sprintf("%s/users?id=%d", c.cfg.UserServiceURL, id), nil)
+	elapsed := time.Since(start)
+
+	var se *statusError
+	if errors.As(err, &se) {
+		// 404 などは想定したシナリオなのでエラー扱いしない
+		return se.code, elapsed, nil
+	}
+	if err != nil {
+		return 0, elapsed, err
+	}
+	return http.StatusOK, elapsed, nil
+}
+
+// openMetricsAccept はエクスペンプラーを含む OpenMetrics 形式を優先して要求する
+const openMetricsAccept = promtext.ContentTypeOpenMetrics + ";version=1.0.0,text/plain;version=0.0.4;q=0.5"
+
+// scrapeCollector は Collector の Prometheus エクスポーターの出力を Content-Type に応じてパースする
+func (c *checker) scrapeCollector(ctx context.Context) (promtext.Families, error) {
+	body, header, err := c.fetchWithHeader(ctx, c.cfg.CollectorMetricsURL, http.Header{"Accept": {openMetricsAccept}})
+	if err != nil {
+		return nil, err
+	}
+	families, err := promtext.Parse(bytes.NewReader(body), promtext.FormatFor(header.Get("Content-Type")))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.cfg.CollectorMetricsURL, err)
+	}
+	return families, nil
+}
+
+// queryExemplars は Prometheus の /api/v1/query_exemplars を呼び、警告があれば表示する。
+// start がゼロなら Prometheus の既定の範囲
+func (c *checker) queryExemplars(ctx context.Context, query string, start time.Time) ([]promapi.ExemplarSeries, error) {
+	series, warnings, err := c.prom.QueryExemplars(ctx, query, start, time.Time{})
+	for _, w := range warnings {
+		c.printf("  ⚠️  prometheus: %s\n", w)
+	}
+	if err != nil {
+		return nil, c.unreachable(ctx, c.cfg.PrometheusURL, err)
+	}
+	return series, nil
+}
+
+// query は Prometheus の瞬時クエリを実行し、警告があれば表示する
+func (c *checker) query(ctx context.Context, query string) (promapi.QueryResult, error) {
+	result, warnings, err := c.prom.Query(ctx, query, time.Time{})
+	for _, w := range warnings {
+		c.printf("  ⚠️  prometheus: %s\n", w)
+	}
+	if err != nil {
+		return promapi.QueryResult{}, c.unreachable(ctx, c.cfg.PrometheusURL, err)
+	}
+	return result, nil
+}
+
+// latestExemplar は全シリーズの中で最も新しいエクスペンプラーを返す
+func latestExemplar(series []promapi.ExemplarSeries) (promapi.Exemplar, bool) {
+	var latest promapi.Exemplar
+	found := false
+	for _, s := range series {
+		for _, e := range s.Exemplars {
+			if !found || !e.Timestamp.Before(latest.Timestamp) {
+				latest, found = e, true
+			}
+		}
+	}
+	return latest, found
+}
+
+// jaegerTrace は trace_id のトレースを Jaeger から取得する
+func (c *checker) jaegerTrace(ctx context.Context, traceID string) (*jaegerapi.Trace, error) {
+	trace, err := c.jaeger.Trace(ctx, traceID)
+	if errors.Is(err, jaegerapi.ErrTraceNotFound) {
+		return nil, fmt.Errorf("trace %s not found in Jaeger", traceID)
+	}
+	if err != nil {
+		return nil, c.unreachable(ctx, c.cfg.JaegerURL, err)
+	}
+	return trace, nil
+}
+
+// unreachable は API クライアントの接続エラー（*url.Error）を unavailableError に変換する
+func (c *checker) unreachable(ctx context.Context, baseURL string, err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &unavailableError{url: baseURL, err: err}
+}
+
+// wait はメトリクスがエクスポート・スクレイプされるまで待つ
+func (c *checker) wait(ctx context.Context) error {
+	if c.cfg.Wait <= 0 {
+		return nil
+	}
+	c.printf("⏳ Waiting %s for metrics to be exported and scraped...\n", c.cfg.Wait)
+	t := time.NewTimer(c.cfg.Wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
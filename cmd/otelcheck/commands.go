@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/jaegerapi"
+	"otel-playground/internal/promtext"
+	"otel-playground/internal/telemetry"
+)
+
+// scenarios は faults/user-service.json のルールに合わせたリクエスト
+var scenarios = []struct {
+	name   string
+	userID int
+	expect string
+}{
+	{"Normal request", 1, "fast (<50ms)"},
+	{"Medium latency", 100, "~200ms from the medium-users-100-110 fault rule"},
+	{"High latency", 999, "2s from the slow-user-999 fault rule, a likely exemplar"},
+	{"Not found", 9999, "404"},
+}
+
+func (c *checker) traffic(ctx context.Context) error {
+	c.printf("🚦 Generating traffic against %s\n", c.cfg.UserServiceURL)
+	for _, s := range scenarios {
+		c.printf("  %s (id=%d): expect %s\n", s.name, s.userID, s.expect)
+		status, elapsed, err := c.getUser(ctx, s.userID)
+		if err != nil {
+			return err
+		}
+		c.printf("    ⏱️  %.3fs, HTTP %d\n", elapsed.Seconds(), status)
+	}
+	return nil
+}
+
+// testHistogram は View を通さずにエクスポートする確認用ヒストグラム。
+// 実行ごとに otelcheck.run 属性を変え、前回までの実行と混ざらないシリーズで値を厳密に確認する
+const (
+	testHistogram = "otelcheck_test_duration_seconds"
+	runAttribute  = "otelcheck.run"
+	runLabel      = "otelcheck_run"
+)
+
+func (c *checker) histogram(ctx context.Context) error {
+	c.printf("🧪 Exporting %s over OTLP (no views)...\n", testHistogram)
+	runID, err := c.emitHistogram(ctx)
+	if err != nil {
+		return fmt.Errorf("export %s: %w", testHistogram, err)
+	}
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	families, err := c.scrapeCollector(ctx)
+	if err != nil {
+		return err
+	}
+	c.printf("📈 Histograms in %s:\n", c.cfg.CollectorMetricsURL)
+
+	var errs []error
+	name, series, err := findHistogram(families, testHistogram)
+	if err == nil {
+		err = checkTestHistogram(series, runID)
+	}
+	if err != nil {
+		c.printf("  ❌ %s (%s=%s): %v\n", testHistogram, runLabel, runID, err)
+		errs = append(errs, err)
+	} else {
+		c.printf("  ✅ %s: the 10 recorded values arrived intact\n", name)
+	}
+
+	name, series, err = findHistogram(families, c.cfg.HistogramMetric)
+	if err != nil {
+		c.printf("  ❌ %s: %v\n", c.cfg.HistogramMetric, err)
+		errs = append(errs, err)
+	}
+	for _, h := range series {
+		if err := h.Validate(); err != nil {
+			c.printf("  ❌ %s%s: %v\n", name, h.Labels, err)
+			errs = append(errs, err)
+			continue
+		}
+		c.printf("  ✅ %s%s: count %g, sum %g\n     ", name, h.Labels, h.Count, h.Sum)
+		for _, b := range h.Buckets {
+			c.printf(" le=%g:%g", b.UpperBound, b.Count)
+			if b.Exemplar != nil {
+				c.printf("🔗")
+			}
+		}
+		c.printf("\n")
+	}
+	if len(errs) > 0 {
+		c.printf("  Histograms exposed by the collector: %s\n", strings.Join(histogramNames(families), ", "))
+	}
+	return errors.Join(errs...)
+}
+
+// exportTestHistogram は 0.0〜0.9 秒の 10 個の値を記録し、フラッシュしてから実行 ID を返す。
+// グローバルのプロバイダーや slog の既定のロガーは置き換えず、この関数だけの MeterProvider で送る
+func (c *checker) exportTestHistogram(ctx context.Context) (string, error) {
+	exporter, err := telemetry.NewMetricExporter(ctx)
+	if err != nil {
+		return "", err
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String("otelcheck"))),
+	)
+	shutdown := func(ctx context.Context) error {
+		return errors.Join(mp.ForceFlush(ctx), mp.Shutdown(ctx))
+	}
+
+	runID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	h, err := mp.Meter("otelcheck").Float64Histogram(testHistogram,
+		metric.WithDescription("Values recorded by otelcheck histogram"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return "", errors.Join(err, shutdown(ctx))
+	}
+	for i := range 10 {
+		h.Record(ctx, float64(i)*0.1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			attribute.String(runAttribute, runID),
+		))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, telemetry.DefaultShutdownTimeout)
+	defer cancel()
+	return runID, shutdown(ctx)
+}
+
+// checkTestHistogram は既定のバケット境界（0, 5, 10, ...）で 0.0〜0.9 の 10 個を記録した結果か確認する
+func checkTestHistogram(series []promtext.Histogram, runID string) error {
+	for _, h := range series {
+		if h.Labels[runLabel] != runID {
+			continue
+		}
+		if err := h.Validate(); err != nil {
+			return err
+		}
+		zero, _ := h.Bucket(0)
+		five, _ := h.Bucket(5)
+		if h.Count != 10 || math.Abs(h.Sum-4.5) > 1e-9 || zero.Count != 1 || five.Count != 10 {
+			return fmt.Errorf("got count %g sum %g le=0:%g le=5:%g, want 10 4.5 1 10", h.Count, h.Sum, zero.Count, five.Count)
+		}
+		return nil
+	}
+	return fmt.Errorf("no series with %s=%q", runLabel, runID)
+}
+
+// findHistogram は name で終わる（Collector の namespace が前に付く）ヒストグラムのファミリーを返す
+func findHistogram(families promtext.Families, name string) (string, []promtext.Histogram, error) {
+	for _, f := range families {
+		if f.Type != promtext.TypeHistogram || !strings.HasSuffix(f.Name, name) {
+			continue
+		}
+		series, err := f.Histograms()
+		return f.Name, series, err
+	}
+	return "", nil, errors.New("not exposed by the collector")
+}
+
+func histogramNames(families promtext.Families) []string {
+	var names []string
+	for _, f := range families {
+		if f.Type == promtext.TypeHistogram {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// countExemplars はトレース ID 付きのエクスペンプラーを数える
+func countExemplars(families promtext.Families) int {
+	n := 0
+	for _, s := range families.Exemplars() {
+		if s.Exemplar.Labels["trace_id"] != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *checker) exemplars(ctx context.Context) error {
+	return c.listExemplars(ctx, 0)
+}
+
+// listExemplars は各シリーズのエクスペンプラーを最大 limit 件（0 なら全件）表示する
+func (c *checker) listExemplars(ctx context.Context, limit int) error {
+	c.printf("🔗 Exemplars exposed by the collector: ")
+	switch families, err := c.scrapeCollector(ctx); {
+	case err != nil:
+		// Prometheus に保存されていれば十分なので警告に留める
+		c.printf("⚠️  %v\n", err)
+	case countExemplars(families) == 0:
+		c.printf("⚠️  none (is enable_open_metrics set on the prometheus exporter?)\n")
+	default:
+		c.printf("✅ %d\n", countExemplars(families))
+	}
+
+	c.printf("🔍 Exemplars stored in Prometheus for %s:\n", c.cfg.ExemplarQuery)
+	series, err := c.queryExemplars(ctx, c.cfg.ExemplarQuery, time.Time{})
+	if err != nil {
+		return err
+	}
+	total := 0
+	for i, s := range series {
+		total += len(s.Exemplars)
+		c.printf("  📊 Series %d: route=%s method=%s, %d exemplars\n",
+			i+1, s.SeriesLabels["http_route"], s.SeriesLabels["http_request_method"], len(s.Exemplars))
+		for j, e := range s.Exemplars {
+			if limit > 0 && j == limit {
+				c.printf("      ... %d more\n", len(s.Exemplars)-limit)
+				break
+			}
+			c.printf("      🔗 value %g, trace %s → %s\n", e.Value, e.TraceID(), c.traceURL(e.TraceID()))
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("no exemplars stored in Prometheus for %s", c.cfg.ExemplarQuery)
+	}
+	return nil
+}
+
+func (c *checker) traceURL(traceID string) string {
+	return c.cfg.JaegerURL + "/trace/" + url.PathEscape(traceID)
+}
+
+func (c *checker) verifyLink(ctx context.Context) error {
+	c.printf("1️⃣ Generating a request with trace context...\n")
+	status, _, err := c.getUser(ctx, 1)
+	if err != nil {
+		return err
+	}
+	c.printf("   ✅ GET /users?id=1: HTTP %d\n", status)
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	c.printf("2️⃣ Looking up the latest exemplar of %s...\n", c.cfg.ExemplarQuery)
+	series, err := c.queryExemplars(ctx, c.cfg.ExemplarQuery, time.Time{})
+	if err != nil {
+		return err
+	}
+	latest, ok := latestExemplar(series)
+	if !ok {
+		return fmt.Errorf("no exemplars stored in Prometheus for %s", c.cfg.ExemplarQuery)
+	}
+	if latest.TraceID() == "" {
+		return fmt.Errorf("latest exemplar has no trace_id label: %v", latest.Labels)
+	}
+	c.printf("   ✅ trace_id=%s span_id=%s (%s)\n", latest.TraceID(), latest.Labels["span_id"],
+		latest.Timestamp.Format(time.TimeOnly))
+
+	c.printf("3️⃣ Following the trace to Jaeger...\n")
+	trace, err := c.jaegerTrace(ctx, latest.TraceID())
+	if err != nil {
+		return err
+	}
+	if err := trace.Connected(); err != nil {
+		return fmt.Errorf("trace %s is broken: %w\n%s", trace.TraceID, err, trace.Tree())
+	}
+	// エクスペンプラーはリクエストを処理したスパンを指しているはず
+	span, ok := trace.Span(latest.Labels["span_id"])
+	if !ok {
+		return fmt.Errorf("trace %s has no span %s referenced by the exemplar\n%s", trace.TraceID, latest.Labels["span_id"], trace.Tree())
+	}
+	c.printf("   ✅ %d spans, exemplar span is %s %q: %s\n", len(trace.Spans), span.Service(), span.OperationName, c.traceURL(trace.TraceID))
+	return nil
+}
+
+// coverageRounds は exemplar-coverage が scenarios を繰り返す回数
+const coverageRounds = 5
+
+// decisionsQuery は sampling_decisions_total（parentbased_rules のときだけある）を判定ごとに集計する
+const decisionsQuery = `sum by (sampling_decision) (increase(microservices_sampling_decisions_total[%ds]))`
+
+// exemplarCoverage はトラフィックを送り、その間に保存されたエクスペンプラーのトレースが
+// Jaeger にあるか数える。OTEL_TRACES_SAMPLER を変えてサービスを起動し直して実行すると、
+// サンプリングでエクスペンプラーがどれだけ減るか、リンク切れが出ないかを比べられる
+func (c *checker) exemplarCoverage(ctx context.Context) error {
+	start := time.Now()
+	c.printf("🚦 Sending %d rounds of %d requests to %s\n", coverageRounds, len(scenarios), c.cfg.UserServiceURL)
+	requests := 0
+	for range coverageRounds {
+		for _, s := range scenarios {
+			if _, _, err := c.getUser(ctx, s.userID); err != nil {
+				return err
+			}
+			requests++
+		}
+	}
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	series, err := c.queryExemplars(ctx, c.cfg.ExemplarQuery, start)
+	if err != nil {
+		return err
+	}
+	var traceIDs []string
+	exemplars, seen := 0, map[string]bool{}
+	for _, s := range series {
+		for _, e := range s.Exemplars {
+			exemplars++
+			if id := e.TraceID(); id != "" && !seen[id] {
+				seen[id] = true
+				traceIDs = append(traceIDs, id)
+			}
+		}
+	}
+	c.printf("📊 %d requests → %d exemplars of %s in %d series, %d traces\n",
+		requests, exemplars, c.cfg.ExemplarQuery, len(series), len(traceIDs))
+	if len(traceIDs) == 0 {
+		return fmt.Errorf("no exemplars with a trace_id stored in Prometheus for %s since %s", c.cfg.ExemplarQuery, start.Format(time.TimeOnly))
+	}
+
+	var missing []string
+	for _, id := range traceIDs {
+		_, err := c.jaeger.Trace(ctx, id)
+		if errors.Is(err, jaegerapi.ErrTraceNotFound) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			return c.unreachable(ctx, c.cfg.JaegerURL, err)
+		}
+	}
+	found := len(traceIDs) - len(missing)
+	c.printf("🔗 %d/%d traces found in Jaeger (%.0f%%)\n", found, len(traceIDs), 100*float64(found)/float64(len(traceIDs)))
+	for _, id := range missing {
+		c.printf("   ❌ %s\n", c.traceURL(id))
+	}
+
+	c.printDecisions(ctx, time.Since(start))
+	if len(missing) > 0 {
+		return fmt.Errorf("%d of %d exemplar traces are missing from Jaeger (dropped by the sampler, or not exported yet: try a longer -wait)", len(missing), len(traceIDs))
+	}
+	return nil
+}
+
+// printDecisions は期間中のサンプリングの判定を表示する。無くても計測の失敗にはしない
+func (c *checker) printDecisions(ctx context.Context, window time.Duration) {
+	result, err := c.query(ctx, fmt.Sprintf(decisionsQuery, int(window.Seconds())+1))
+	if err != nil || len(result.Vector) == 0 {
+		c.printf("🎲 No sampling decisions recorded (only OTEL_TRACES_SAMPLER=parentbased_rules records them)\n")
+		return
+	}
+	c.printf("🎲 Sampling decisions:")
+	for _, s := range result.Vector {
+		c.printf(" %s=%.0f", s.Metric["sampling_decision"], s.Point.Value)
+	}
+	c.printf("\n")
+}
+
+// propagationPaths は orchestrator の GET /users/{id}/profile 1 回のトレースに必要な親子関係
+var propagationPaths = []string{
+	"orchestrator → user-service → SELECT users",
+	"orchestrator → post-service → SELECT posts",
+	"orchestrator → comment-service → SELECT comments",
+}
+
+// propagation は traceparent 付きで orchestrator を呼び、全サービスのスパンが
+// 1 本のトレースにつながって Jaeger に届いたか確認する
+func (c *checker) propagation(ctx context.Context) error {
+	traceID, traceparent, err := newTraceparent()
+	if err != nil {
+		return err
+	}
+	c.printf("1️⃣ GET %s/users/1/profile with traceparent %s\n", c.cfg.OrchestratorURL, traceparent)
+	if _, err := c.fetch(ctx, c.cfg.OrchestratorURL+"/users/1/profile", http.Header{"Traceparent": {traceparent}}); err != nil {
+		return err
+	}
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	c.printf("2️⃣ Checking the shape of trace %s in Jaeger...\n", traceID)
+	trace, err := c.jaegerTrace(ctx, traceID)
+	if err != nil {
+		return err
+	}
+	if err := trace.Expect(propagationPaths...); err != nil {
+		return err
+	}
+	for _, p := range propagationPaths {
+		c.printf("   ✅ %s\n", p)
+	}
+	c.printf("%s   %s\n", indent(trace.Tree(), "   "), c.traceURL(traceID))
+	return nil
+}
+
+// newTraceparent はサンプリングフラグ付きの W3C traceparent をランダムな ID で作る
+func newTraceparent() (traceID, header string, err error) {
+	var ids [24]byte
+	if _, err := rand.Read(ids[:]); err != nil {
+		return "", "", err
+	}
+	traceID = hex.EncodeToString(ids[:16])
+	return traceID, "00-" + traceID + "-" + hex.EncodeToString(ids[16:]) + "-01", nil
+}
+
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func (c *checker) demo(ctx context.Context) error {
+	c.printf("🎬 OpenTelemetry Exemplars Demo\n\n")
+	if err := c.traffic(ctx); err != nil {
+		return err
+	}
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	if err := c.listExemplars(ctx, 3); err != nil {
+		return err
+	}
+
+	c.printf("\n🎯 Where to look:\n")
+	c.printf("   A) 📊 Grafana: http://localhost:3000 (admin/admin)\n")
+	c.printf("      → 'OpenTelemetry Exemplars Demo' dashboard, click an exemplar dot to jump to Jaeger\n")
+	c.printf("   B) 📈 Prometheus: %s/graph?g0.expr=%s\n", c.cfg.PrometheusURL, url.QueryEscape(c.cfg.ExemplarQuery))
+	c.printf("      → Graph view with 'Show exemplars' enabled\n")
+	c.printf("   C) 🔍 Jaeger: %s/search?service=user-service\n", c.cfg.JaegerURL)
+	return nil
+}
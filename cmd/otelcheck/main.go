@@ -0,0 +1,138 @@
+// otelcheck はローカル環境の Views・Exemplars・メトリクス→トレースのリンクを確認する CLI
+//
+// 以前はリポジトリ直下に別々の package main として置かれていた確認用プログラムを
+// サブコマンドにまとめたもの。終了コードでスクリプトから結果を判定できる:
+//
+//	0 すべてのチェックが成功した
+//	1 チェックが失敗した（エクスペンプラーが無い、トレースが見つからない等）
+//	2 使い方や設定が不正（-h で使い方を表示したときも）
+//	3 確認先（サービス、Collector、Prometheus、Jaeger）に接続できなかった
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/jaegerapi"
+	"otel-playground/internal/promapi"
+)
+
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitUnavailable = 3
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(*checker, context.Context) error
+}
+
+var commands = []command{
+	{"traffic", "send requests that exercise fast, slow and failing code paths of user-service", (*checker).traffic},
+	{"histogram", "export a test histogram and check the custom histogram buckets in the collector output", (*checker).histogram},
+	{"exemplars", "list the exemplars stored in Prometheus and exposed by the collector", (*checker).exemplars},
+	{"verify-link", "follow the latest exemplar's trace_id to Jaeger", (*checker).verifyLink},
+	{"exemplar-coverage", "send traffic, then count its exemplars and how many of their traces Jaeger has (compare samplers)", (*checker).exemplarCoverage},
+	{"propagation", "call the orchestrator with a traceparent and check the trace spans every service", (*checker).propagation},
+	{"demo", "traffic, then exemplars, then where to look in Grafana, Prometheus and Jaeger", (*checker).demo},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run はサブコマンドを実行して終了コードを返す
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return exitUsage
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "otelcheck: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	cfg, err := config.LoadOtelCheck(cmd.name, args[1:])
+	if err != nil {
+		// -h の使い方は FlagSet が表示済み。引数なしのときと同じく使い方の終了コードにする
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, err)
+		}
+		return exitUsage
+	}
+
+	if err := cmd.run(newChecker(cfg, stdout), ctx); err != nil {
+		fmt.Fprintf(stderr, "❌ %s: %v\n", cmd.name, err)
+		var unavailable *unavailableError
+		if errors.As(err, &unavailable) {
+			return exitUnavailable
+		}
+		return exitFailed
+	}
+	return exitOK
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: otelcheck <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'otelcheck <command> -h' for the flags shared by every command.")
+	fmt.Fprintln(w, "Exit codes: 0 ok, 1 check failed, 2 usage error, 3 endpoint unreachable.")
+}
+
+// checker は全サブコマンドで共有する設定と HTTP クライアント
+type checker struct {
+	cfg    *config.OtelCheck
+	http   *http.Client
+	prom   *promapi.Client
+	jaeger *jaegerapi.Client
+	out    io.Writer
+
+	// emitHistogram はテストで OTLP エクスポートを差し替えるためのフック。実行 ID を返す
+	emitHistogram func(context.Context) (string, error)
+}
+
+func newChecker(cfg *config.OtelCheck, out io.Writer) *checker {
+	httpClient := &http.Client{Timeout: cfg.Timeout}
+	c := &checker{
+		cfg:    cfg,
+		http:   httpClient,
+		prom:   promapi.New(cfg.PrometheusURL, httpClient),
+		jaeger: jaegerapi.New(cfg.JaegerURL, httpClient),
+		out:    out,
+	}
+	c.emitHistogram = c.exportTestHistogram
+	return c
+}
+
+func (c *checker) printf(format string, args ...any) {
+	fmt.Fprintf(c.out, format, args...)
+}
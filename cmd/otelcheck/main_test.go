@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"otel-playground/internal/config"
+)
+
+const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// collectorOutput は Collector の Prometheus エクスポーターが OpenMetrics で返す形
+const collectorOutput = `# TYPE microservices_user_service_response_time_custom histogram
+microservices_user_service_response_time_custom_bucket{http_route="/users",le="0.005"} 3 # {trace_id="` + traceID + `",span_id="00f067aa0ba902b7"} 0.002 1.7e+09
+microservices_user_service_response_time_custom_bucket{http_route="/users",le="+Inf"} 4
+microservices_user_service_response_time_custom_sum{http_route="/users"} 2.01
+microservices_user_service_response_time_custom_count{http_route="/users"} 4
+# TYPE microservices_otelcheck_test_duration_seconds histogram
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="previous",le="0"} 1
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="previous",le="5"} 20
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="previous",le="+Inf"} 20
+microservices_otelcheck_test_duration_seconds_sum{otelcheck_run="previous"} 9
+microservices_otelcheck_test_duration_seconds_count{otelcheck_run="previous"} 20
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="current",le="0"} 1
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="current",le="5"} 10
+microservices_otelcheck_test_duration_seconds_bucket{otelcheck_run="current",le="+Inf"} 10
+microservices_otelcheck_test_duration_seconds_sum{otelcheck_run="current"} 4.5
+microservices_otelcheck_test_duration_seconds_count{otelcheck_run="current"} 10
+# EOF
+`
+
+// fakeBackend は user-service・Collector・Prometheus・Jaeger をまとめて真似る
+type fakeBackend struct {
+	exemplars string            // query_exemplars の data
+	traces    map[string]string // trace ID → /api/traces/{id} の data[0]
+	requests  []string
+
+	// lostService はトレースコンテキストを引き継がずに別トレースを始めるサービス
+	lostService string
+}
+
+func (f *fakeBackend) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		f.requests = append(f.requests, r.URL.Query().Get("id"))
+		if r.URL.Query().Get("id") == "9999" {
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("GET /users/{id}/profile", func(w http.ResponseWriter, r *http.Request) {
+		// traceparent: 00-<trace id>-<parent span id>-01
+		parts := strings.Split(r.Header.Get("Traceparent"), "-")
+		if len(parts) != 4 {
+			http.Error(w, "missing traceparent", http.StatusBadRequest)
+			return
+		}
+		if f.traces == nil {
+			f.traces = map[string]string{}
+		}
+		f.traces[parts[1]] = profileTrace(parts[1], parts[2], f.lostService)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), "openmetrics") {
+			http.Error(w, "test backend only speaks OpenMetrics", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		io.WriteString(w, collectorOutput)
+	})
+	mux.HandleFunc("GET /api/v1/query_exemplars", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") == "bad(" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, f.exemplars)
+	})
+	mux.HandleFunc("GET /api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		// exemplar-coverage が集計する parentbased_rules の判定
+		io.WriteString(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+			`{"metric":{"sampling_decision":"sampled"},"value":[1700000000,"3"]},`+
+			`{"metric":{"sampling_decision":"dropped"},"value":[1700000000,"12"]}]}}`)
+	})
+	mux.HandleFunc("GET /api/traces/{id}", func(w http.ResponseWriter, r *http.Request) {
+		trace, ok := f.traces[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"data":null,"errors":[{"code":404,"msg":"trace not found"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, trace)
+	})
+	return mux
+}
+
+// profileTrace は orchestrator の GET /users/{id}/profile が Jaeger に残すトレースを作る。
+// lost のサービスは伝播に失敗して別トレースを始めるので、このトレースには現れない
+func profileTrace(traceID, parentID, lost string) string {
+	var spans []string
+	span := func(id, parent, process, operation, statement string) {
+		if process == lost {
+			return
+		}
+		tags := "[]"
+		if statement != "" {
+			tags = fmt.Sprintf(`[{"key":"db.statement","type":"string","value":%q}]`, statement)
+		}
+		spans = append(spans, fmt.Sprintf(`{"traceID":"%[1]s","spanID":"%[2]s","operationName":%[3]q,`+
+			`"references":[{"refType":"CHILD_OF","traceID":"%[1]s","spanID":"%[4]s"}],`+
+			`"processID":"%[5]s","tags":%[6]s,"startTime":1700000000000000,"duration":1000}`,
+			traceID, id, operation, parent, process, tags))
+	}
+	span("a1", parentID, "orchestrator", "GET /users/{id}/profile", "")
+	span("b1", "a1", "user-service", "GET /users/{id}", "")
+	span("b2", "b1", "user-service", "db.Query", "SELECT id, name, email, created_at FROM users WHERE id = $1")
+	span("c1", "a1", "post-service", "GET /posts", "")
+	span("c2", "c1", "post-service", "db.Query", "SELECT id, user_id, title, content, created_at FROM posts WHERE user_id = $1")
+	span("d1", "a1", "comment-service", "GET /comments", "")
+	span("d2", "d1", "comment-service", "db.Query", "SELECT id, post_id, author_name, content FROM comments WHERE post_id = $1")
+	return fmt.Sprintf(`{"traceID":"%s","spans":[%s],"processes":{`+
+		`"orchestrator":{"serviceName":"orchestrator"},"user-service":{"serviceName":"user-service"},`+
+		`"post-service":{"serviceName":"post-service"},"comment-service":{"serviceName":"comment-service"}}}`,
+		traceID, strings.Join(spans, ","))
+}
+
+const storedExemplars = `[{"seriesLabels":{"http_route":"/users","http_request_method":"GET"},"exemplars":[
+	{"labels":{"trace_id":"older","span_id":"1"},"value":"1","timestamp":100},
+	{"labels":{"trace_id":"` + traceID + `","span_id":"b1"},"value":"1","timestamp":200}]}]`
+
+func runCheck(t *testing.T, f *fakeBackend, args ...string) (int, string, string) {
+	t.Helper()
+
+	srv := httptest.NewServer(f.handler())
+	defer srv.Close()
+
+	args = append(args,
+		"-user-service-url", srv.URL,
+		"-orchestrator-url", srv.URL,
+		"-collector-metrics-url", srv.URL+"/metrics",
+		"-prometheus-url", srv.URL,
+		"-jaeger-url", srv.URL,
+		"-wait", "0",
+	)
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestTrafficRunsEveryScenario(t *testing.T) {
+	f := &fakeBackend{}
+	if code, _, stderr := runCheck(t, f, "traffic"); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if got := strings.Join(f.requests, ","); got != "1,100,999,9999" {
+		t.Errorf("requested ids %s, want 1,100,999,9999", got)
+	}
+}
+
+func TestVerifyLinkFollowsLatestExemplar(t *testing.T) {
+	f := &fakeBackend{exemplars: storedExemplars, traces: map[string]string{traceID: profileTrace(traceID, "ff", "")}}
+	code, stdout, stderr := runCheck(t, f, "verify-link")
+	if code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "trace_id="+traceID) || !strings.Contains(stdout, `7 spans, exemplar span is user-service "GET /users/{id}"`) {
+		t.Errorf("output does not show the latest exemplar's trace:\n%s", stdout)
+	}
+
+	f.traces = nil
+	if code, _, stderr := runCheck(t, f, "verify-link"); code != exitFailed || !strings.Contains(stderr, "not found in Jaeger") {
+		t.Errorf("missing trace: exit %d %q, want %d", code, stderr, exitFailed)
+	}
+}
+
+func TestExemplarCoverageReportsMissingTraces(t *testing.T) {
+	f := &fakeBackend{exemplars: storedExemplars, traces: map[string]string{traceID: profileTrace(traceID, "ff", "")}}
+	code, stdout, stderr := runCheck(t, f, "exemplar-coverage")
+	if code != exitFailed || !strings.Contains(stderr, "1 of 2 exemplar traces are missing from Jaeger") {
+		t.Fatalf("exit %d %q, want %d", code, stderr, exitFailed)
+	}
+	for _, want := range []string{"20 requests → 2 exemplars", "1/2 traces found in Jaeger (50%)", "/trace/older", "sampled=3 dropped=12"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+	if len(f.requests) != coverageRounds*len(scenarios) {
+		t.Errorf("sent %d requests, want %d", len(f.requests), coverageRounds*len(scenarios))
+	}
+
+	f.exemplars = `[{"seriesLabels":{},"exemplars":[{"labels":{"trace_id":"` + traceID + `"},"value":"1","timestamp":200}]}]`
+	if code, stdout, stderr := runCheck(t, f, "exemplar-coverage"); code != exitOK || !strings.Contains(stdout, "1/1 traces found in Jaeger (100%)") {
+		t.Errorf("exit %d, stdout:\n%s\nstderr: %s", code, stdout, stderr)
+	}
+}
+
+func TestPropagationChecksTraceShape(t *testing.T) {
+	code, stdout, stderr := runCheck(t, &fakeBackend{}, "propagation")
+	if code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "✅ orchestrator → comment-service → SELECT comments") ||
+		!strings.Contains(stdout, "      user-service: db.Query [SELECT users]") {
+		t.Errorf("output lacks the checked paths or the span tree:\n%s", stdout)
+	}
+
+	code, _, stderr = runCheck(t, &fakeBackend{lostService: "comment-service"}, "propagation")
+	if code != exitFailed {
+		t.Fatalf("exit %d, want %d: %s", code, exitFailed, stderr)
+	}
+	if !strings.Contains(stderr, `found orchestrator, but no "comment-service" below it`) {
+		t.Errorf("stderr does not name the missing hop:\n%s", stderr)
+	}
+}
+
+func TestExemplarsExitCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		exemplars string
+		args      []string
+		want      int
+	}{
+		{"stored", storedExemplars, nil, exitOK},
+		{"none stored", `[]`, nil, exitFailed},
+		{"prometheus error", storedExemplars, []string{"-exemplar-query", "bad("}, exitFailed},
+		{"invalid flag value", storedExemplars, []string{"-timeout", "0s"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"exemplars"}, tt.args...)
+			code, stdout, stderr := runCheck(t, &fakeBackend{exemplars: tt.exemplars}, args...)
+			if code != tt.want {
+				t.Fatalf("exit %d, want %d\nstdout: %s\nstderr: %s", code, tt.want, stdout, stderr)
+			}
+			if tt.name == "prometheus error" && !strings.Contains(stderr, "bad_data (HTTP 400): parse error") {
+				t.Errorf("stderr %q does not carry the Prometheus error", stderr)
+			}
+			if tt.want == exitOK && !strings.Contains(stdout, "Exemplars exposed by the collector: ✅ 1") {
+				t.Errorf("collector exemplar not counted:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestUnreachableEndpointExitCode(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"traffic", "-user-service-url", srv.URL}, &stdout, &stderr)
+	if code != exitUnavailable {
+		t.Errorf("exit %d, want %d: %s", code, exitUnavailable, stderr.String())
+	}
+}
+
+func TestUnknownCommandIsUsageError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"nope"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("exit %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr.String(), "verify-link") {
+		t.Errorf("usage does not list the commands:\n%s", stderr.String())
+	}
+}
+
+func TestCommandHelpIsUsageExit(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"exemplars", "-h"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("exit %d, want %d", code, exitUsage)
+	}
+	if strings.Contains(stderr.String(), "help requested") {
+		t.Errorf("help is reported as an error:\n%s", stderr.String())
+	}
+}
+
+func TestHistogramChecksExactValues(t *testing.T) {
+	srv := httptest.NewServer((&fakeBackend{}).handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		runID   string
+		metric  string
+		wantErr string
+	}{
+		{"current run", "current", "user_service_response_time_custom", ""},
+		// 前回の実行のシリーズは件数が合わない
+		{"previous run", "previous", "user_service_response_time_custom", "got count 20 sum 9"},
+		{"run not scraped yet", "next", "user_service_response_time_custom", `no series with otelcheck_run="next"`},
+		{"custom histogram missing", "current", "post_service_response_time_custom", "not exposed by the collector"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.LoadOtelCheck("histogram", []string{
+				"-collector-metrics-url", srv.URL + "/metrics", "-wait", "0", "-histogram-metric", tt.metric,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			c := newChecker(cfg, &out)
+			c.emitHistogram = func(context.Context) (string, error) { return tt.runID, nil }
+
+			err = c.histogram(context.Background())
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want %q\n%s", err, tt.wantErr, out.String())
+			}
+			if tt.wantErr == "" && !strings.Contains(out.String(), "le=0.005:3🔗 le=+Inf:4") {
+				t.Errorf("custom histogram buckets missing from output:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestExportTestHistogramLeavesGlobalsAlone(t *testing.T) {
+	var requests atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/metrics" {
+			requests.Add(1)
+		}
+	}))
+	defer collector.Close()
+	for _, name := range []string{"PROTOCOL", "ENDPOINT", "COMPRESSION", "TIMEOUT"} {
+		t.Setenv("OTEL_EXPORTER_OTLP_"+name, "")
+		t.Setenv("OTEL_EXPORTER_OTLP_METRICS_"+name, "")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+
+	logger, meterProvider := slog.Default(), otel.GetMeterProvider()
+	runID, err := (&checker{}).exportTestHistogram(context.Background())
+	if err != nil || runID == "" {
+		t.Fatalf("exportTestHistogram = %q, %v", runID, err)
+	}
+	if requests.Load() == 0 {
+		t.Error("nothing was exported to the collector")
+	}
+	// 呼び出し元のロガーやプロバイダーを差し替えない
+	if slog.Default() != logger || otel.GetMeterProvider() != meterProvider {
+		t.Error("exportTestHistogram replaced the default logger or the global meter provider")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/httpmetrics"
+)
+
+const maxTitleLength = 200 // posts.title VARCHAR(200)
+
+// Postgres のエラーコード
+const pgForeignKeyViolation = "23503"
+
+var errInvalidPostID = errors.New("invalid post id")
+
+// ConstraintError は Postgres の制約違反を表す型付きエラー
+type ConstraintError struct {
+	// Code は SQLSTATE（例: 23503 foreign_key_violation）
+	Code       string
+	Constraint string
+	Detail     string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %s violated (%s): %s", e.Constraint, e.Code, e.Detail)
+}
+
+func (e *ConstraintError) Unwrap() error { return e.Err }
+
+// IsForeignKey reports whether the violated constraint is a foreign key.
+func (e *ConstraintError) IsForeignKey() bool { return e.Code == pgForeignKeyViolation }
+
+// postInput は作成・更新リクエストのボディ。PATCH では省略されたフィールドを更新しない
+type postInput struct {
+	UserID  *int    `json:"user_id"`
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+func (in postInput) validate(partial bool) error {
+	if !partial && (in.UserID == nil || in.Title == nil || in.Content == nil) {
+		return errors.New("user_id, title and content are required")
+	}
+	if partial && in.UserID == nil && in.Title == nil && in.Content == nil {
+		return errors.New("at least one of user_id, title or content is required")
+	}
+	if in.UserID != nil && *in.UserID <= 0 {
+		return errors.New("user_id must be a positive integer")
+	}
+	if in.Title != nil {
+		if title := strings.TrimSpace(*in.Title); title == "" || len(title) > maxTitleLength {
+			return fmt.Errorf("title must be 1-%d characters", maxTitleLength)
+		}
+	}
+	if in.Content != nil && strings.TrimSpace(*in.Content) == "" {
+		return errors.New("content must not be empty")
+	}
+	return nil
+}
+
+// writeError はスパンとエラーメトリクスにエラーを記録してからレスポンスを返す
+func (s *PostService) writeError(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, err error, description string) {
+	errorType := http.StatusText(status)
+	var cerr *ConstraintError
+	if errors.As(err, &cerr) {
+		errorType = cerr.Code
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCodeKey.Int(status),
+			semconv.ErrorTypeKey.String(errorType),
+		)
+		if cerr != nil {
+			span.SetAttributes(
+				attribute.String("db.response.status_code", cerr.Code),
+				attribute.String("db.postgresql.constraint", cerr.Constraint),
+			)
+		}
+		recordError(span, err, description)
+	}
+
+	s.errorCounter.Add(ctx, 1, metric.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.HTTPRouteKey.String(httpmetrics.Route(r.Pattern)),
+		semconv.HTTPResponseStatusCodeKey.Int(status),
+		semconv.ErrorTypeKey.String(errorType),
+	))
+
+	if status >= http.StatusInternalServerError {
+		http.Error(w, "internal server error", status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeStoreError はストアのエラーを 404/409/422/500 に振り分ける
+func (s *PostService) writeStoreError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	var cerr *ConstraintError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.writeError(ctx, w, r, http.StatusNotFound, errors.New("post not found"), "Post not found")
+	case errors.As(err, &cerr) && cerr.IsForeignKey() && r.Method == http.MethodDelete:
+		// 削除時の外部キー違反はコメントから参照されている場合
+		s.writeError(ctx, w, r, http.StatusConflict, err, "Post is referenced by comments")
+	case errors.As(err, &cerr) && cerr.IsForeignKey():
+		// 作成・更新時の外部キー違反は存在しない user_id を指定した場合
+		s.writeError(ctx, w, r, http.StatusUnprocessableEntity, err, "Referenced user does not exist")
+	case errors.As(err, &cerr):
+		s.writeError(ctx, w, r, http.StatusConflict, err, "Constraint violation")
+	default:
+		s.writeError(ctx, w, r, http.StatusInternalServerError, err, "Database error")
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	// レスポンスヘッダーにトレース情報を注入
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(ctx, "failed to encode response", "error", err)
+	}
+}
+
+func pathPostID(r *http.Request) (int, error) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || postID <= 0 {
+		return 0, errInvalidPostID
+	}
+	return postID, nil
+}
+
+func decodePostInput(r *http.Request, partial bool) (postInput, error) {
+	var in postInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return in, fmt.Errorf("invalid request body: %w", err)
+	}
+	return in, in.validate(partial)
+}
+
+func (s *PostService) createPostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	in, err := decodePostInput(r, false)
+	if err != nil {
+		s.writeError(ctx, w, r, http.StatusBadRequest, err, "Invalid post input")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("user.id", *in.UserID))
+	}
+
+	post, err := s.store.CreatePost(ctx, in)
+	if err != nil {
+		s.writeStoreError(ctx, w, r, err)
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("post.id", post.ID))
+	}
+	w.Header().Set("Location", fmt.Sprintf("/posts/%d", post.ID))
+	writeJSON(ctx, w, http.StatusCreated, post)
+}
+
+// updatePostHandler は PUT（全項目必須）と PATCH（部分更新）の両方を処理する
+func (s *PostService) updatePostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	postID, err := pathPostID(r)
+	if err != nil {
+		s.writeError(ctx, w, r, http.StatusBadRequest, err, "Invalid post id")
+		return
+	}
+
+	in, err := decodePostInput(r, r.Method == http.MethodPatch)
+	if err != nil {
+		s.writeError(ctx, w, r, http.StatusBadRequest, err, "Invalid post input")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("post.id", postID))
+	}
+
+	post, err := s.store.UpdatePost(ctx, postID, in)
+	if err != nil {
+		s.writeStoreError(ctx, w, r, err)
+		return
+	}
+	writeJSON(ctx, w, http.StatusOK, post)
+}
+
+func (s *PostService) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	postID, err := pathPostID(r)
+	if err != nil {
+		s.writeError(ctx, w, r, http.StatusBadRequest, err, "Invalid post id")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("post.id", postID))
+	}
+
+	if err := s.store.DeletePost(ctx, postID); err != nil {
+		s.writeStoreError(ctx, w, r, err)
+		return
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,26 +4,32 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
-	"time"
 
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
 	_ "github.com/lib/pq"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
-	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/httpmetrics"
+	"otel-playground/internal/server"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry"
 )
 
 type Post struct {
@@ -35,102 +41,52 @@ type Post struct {
 }
 
 type PostService struct {
-	db                *sql.DB
-	requestCounter    metric.Int64Counter
-	responseTime      metric.Float64Histogram
-	activeConnections metric.Int64UpDownCounter
-}
-
-func initTracer() (*trace.TracerProvider, error) {
-	exporter, err := otlptracehttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("post-service"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(res),
-	)
-	otel.SetTracerProvider(tp)
-	
-	// トレースコンテキストの伝播設定
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp, nil
-}
-
-func initMetrics() (*sdkmetric.MeterProvider, error) {
-	exporter, err := otlpmetrichttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("post-service"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(5*time.Second))),
-		sdkmetric.WithResource(res),
-	)
-	otel.SetMeterProvider(mp)
-
-	return mp, nil
+	faults       *faultinject.Injector
+	health       *health.Checker
+	store        PostStore
+	metrics      *httpmetrics.Metrics
+	errorCounter metric.Int64Counter
+	pageSize     metric.Int64Histogram
+	// faultAdmin なら障害注入ルールを変更する API を登録する
+	faultAdmin bool
 }
 
 func initServiceMetrics() (*PostService, error) {
 	meter := otel.Meter("post-service")
+	s := &PostService{}
 
-	requestCounter, err := meter.Int64Counter(
-		"post_service_requests_total",
-		metric.WithDescription("Total number of requests to post service"),
-	)
+	metrics, err := httpmetrics.New(meter, "post_service", httpmetrics.Options{
+		// ヘルスチェックは otelhttp と同じくメトリクスにも数えない
+		Filter: func(r *http.Request) bool { return s.health.Filter(r) },
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	responseTime, err := meter.Float64Histogram(
-		"post_service_request_duration_seconds",
-		metric.WithDescription("Duration of requests to post service"),
-		metric.WithUnit("s"),
+	errorCounter, err := meter.Int64Counter(
+		"post_service_errors_total",
+		metric.WithDescription("Total number of failed requests to post service by error type"),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	activeConnections, err := meter.Int64UpDownCounter(
-		"post_service_active_connections",
-		metric.WithDescription("Number of active connections to post service"),
+	pageSize, err := meter.Int64Histogram(
+		"post_service_page_size",
+		metric.WithDescription("Number of posts returned per page"),
+		metric.WithUnit("{post}"),
+		metric.WithExplicitBucketBoundaries(0, 1, 5, 10, 20, 50, 100),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PostService{
-		requestCounter:    requestCounter,
-		responseTime:      responseTime,
-		activeConnections: activeConnections,
-	}, nil
+	s.metrics, s.errorCounter, s.pageSize = metrics, errorCounter, pageSize
+	return s, nil
 }
 
-func initDB() (*sql.DB, error) {
-	db, err := otelsql.Open("postgres", "host=localhost port=5432 user=postgres password=otelpass dbname=oteldb sslmode=disable")
+func initDB(dsn string) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -150,108 +106,38 @@ func recordError(span oteltrace.Span, err error, description string) {
 	}
 }
 
-func (s *PostService) getPost(ctx context.Context, postID int) (*Post, error) {
-	// SQL操作は otelsql で自動計装されるため、手動スパン不要
-	query := "SELECT id, user_id, title, content, created_at FROM posts WHERE id = $1"
-	row := s.db.QueryRowContext(ctx, query, postID)
-
-	var post Post
-	if err := row.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt); err != nil {
-		// 現在のスパンがあればエラーを記録
-		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-			recordError(span, err, "Failed to scan post data")
-		}
-		return nil, err
-	}
-
-	return &post, nil
-}
-
-func (s *PostService) getUserPosts(ctx context.Context, userID int) ([]Post, error) {
-	// SQL操作は otelsql で自動計装されるため、手動スパン不要
-	query := `
-		SELECT id, user_id, title, content, created_at 
-		FROM posts 
-		WHERE user_id = $1 
-		ORDER BY created_at DESC
-	`
-
-	rows, err := s.db.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt); err != nil {
-			return nil, err
-		}
-		posts = append(posts, post)
-	}
-
-	return posts, nil
-}
-
 func (s *PostService) getPostHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
+	// サーバースパンは otelhttp.NewHandler が開始済みなので、ハンドラはそこに属性を足すだけ
+	ctx := r.Context()
 
-	// トレースコンテキストをヘッダーから抽出
-	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-	
-	// ヘッダーにトレースコンテキストが存在するかチェック
-	spanCtx := oteltrace.SpanContextFromContext(ctx)
-	if !spanCtx.IsValid() {
-		// 新しいトレースを開始（親トレースが存在しない場合）
-		tracer := otel.Tracer("post-service")
-		var span oteltrace.Span
-		ctx, span = tracer.Start(ctx, "getPostHandler")
-		defer span.End()
+	// 投稿IDをパスパラメータ（/posts/{id}）またはクエリパラメータ（/posts?id=）から取得
+	postIDStr := r.PathValue("id")
+	if postIDStr == "" {
+		postIDStr = r.URL.Query().Get("id")
 	}
-
-	// リクエスト処理の最後にメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		s.requestCounter.Add(ctx, 1, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/posts"),
-		))
-		s.responseTime.Record(ctx, duration, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/posts"),
-		))
-	}()
-
-	// 投稿IDをクエリパラメータから取得
-	postIDStr := r.URL.Query().Get("id")
 	if postIDStr == "" {
-		http.Error(w, "post id is required", http.StatusBadRequest)
+		s.writeError(ctx, w, r, http.StatusBadRequest, errors.New("post id is required"), "Invalid post id")
 		return
 	}
 
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "invalid post id", http.StatusBadRequest)
+		s.writeError(ctx, w, r, http.StatusBadRequest, errInvalidPostID, "Invalid post id")
 		return
 	}
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("post.id", postID))
 
 	// 投稿情報を取得
-	post, err := s.getPost(ctx, postID)
+	post, err := s.store.GetPost(ctx, postID)
 	if err != nil {
 		// エラーをスパンに記録
-		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-			if err == sql.ErrNoRows {
-				recordError(span, err, "Post not found")
-			} else {
-				recordError(span, err, "Failed to get post")
-			}
+		if err == sql.ErrNoRows {
+			recordError(span, err, "Post not found")
+		} else {
+			recordError(span, err, "Failed to get post")
 		}
-		
+
 		if err == sql.ErrNoRows {
 			http.Error(w, "post not found", http.StatusNotFound)
 			return
@@ -260,6 +146,8 @@ func (s *PostService) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	span.SetAttributes(serverspan.RowsKey.Int(1))
+
 	// レスポンスヘッダーにトレース情報を注入
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
 	
@@ -272,57 +160,49 @@ func (s *PostService) getPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *PostService) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// トレースコンテキストをヘッダーから抽出
-	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-	
-	// ヘッダーにトレースコンテキストが存在するかチェック
-	spanCtx := oteltrace.SpanContextFromContext(ctx)
-	if !spanCtx.IsValid() {
-		// 新しいトレースを開始（親トレースが存在しない場合）
-		tracer := otel.Tracer("post-service")
-		var span oteltrace.Span
-		ctx, span = tracer.Start(ctx, "getUserPostsHandler")
-		defer span.End()
-	}
+	// サーバースパンは otelhttp.NewHandler が開始済みなので、ハンドラはそこに属性を足すだけ
+	ctx := r.Context()
 
-	// リクエスト処理の最後にメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		s.requestCounter.Add(ctx, 1, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/posts/by-user"),
-		))
-		s.responseTime.Record(ctx, duration, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/posts/by-user"),
-		))
-	}()
-
-	// ユーザーIDをクエリパラメータから取得
-	userIDStr := r.URL.Query().Get("user_id")
-	if userIDStr == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
+	// ページング・ソート・期間指定をクエリパラメータから取得
+	q, err := parsePostPageQuery(r)
 	if err != nil {
-		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		s.writeError(ctx, w, r, http.StatusBadRequest, err, "Invalid query parameters")
 		return
 	}
 
 	// ユーザーの投稿一覧を取得
-	posts, err := s.getUserPosts(ctx, userID)
+	page, err := s.store.ListUserPosts(ctx, q)
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		s.writeError(ctx, w, r, http.StatusInternalServerError, err, "Failed to get user posts")
 		return
 	}
+	posts := page.Posts
+
+	// ページサイズをスパンとヒストグラムに記録し、大きなレスポンスを可視化
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("user.id", q.UserID),
+			attribute.Int("page.limit", q.Limit),
+			attribute.Int("page.size", len(posts)),
+			serverspan.RowsKey.Int(len(posts)),
+			attribute.String("page.mode", q.mode()),
+			attribute.String("page.sort", q.sort()),
+			attribute.Bool("page.has_next", page.Next != nil),
+		)
+	}
+	s.pageSize.Record(ctx, int64(len(posts)), metric.WithAttributes(
+		semconv.HTTPRouteKey.String("/posts/by-user"),
+		attribute.String("page.mode", q.mode()),
+	))
+
+	// 次ページのメタデータをヘッダーで返す（ボディは従来通り投稿の配列）。
+	// オフセット指定のクライアントにカーソルを混ぜないよう、X-Next-Cursor はカーソル方式のときだけ付ける
+	if page.Next != nil {
+		if q.mode() != "offset" {
+			w.Header().Set("X-Next-Cursor", page.Next.encode())
+		}
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextPageURL(r, q, page)))
+	}
 
 	// レスポンスヘッダーにトレース情報を注入
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
@@ -335,124 +215,102 @@ func (s *PostService) getUserPostsHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
-func (s *PostService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// ヘルスチェックのメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		s.requestCounter.Add(r.Context(), 1, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/health"),
-		))
-		s.responseTime.Record(r.Context(), duration, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/health"),
-		))
-	}()
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"service": "post-service",
-	})
+// routes はエンドポイントを登録し、otelhttp で計装したハンドラを返す
+func (s *PostService) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /posts", s.getPostHandler)
+	mux.HandleFunc("POST /posts", s.createPostHandler)
+	mux.HandleFunc("GET /posts/{id}", s.getPostHandler)
+	mux.HandleFunc("PUT /posts/{id}", s.updatePostHandler)
+	mux.HandleFunc("PATCH /posts/{id}", s.updatePostHandler)
+	mux.HandleFunc("DELETE /posts/{id}", s.deletePostHandler)
+	mux.HandleFunc("GET /posts/by-user", s.getUserPostsHandler)
+	s.health.Register(mux)
+	if s.faultAdmin {
+		s.faults.Register(mux)
+	}
+
+	// 障害注入はサーバースパンに記録するため otelhttp の内側に置き、
+	// 注入した遅延やエラーもリクエストメトリクスに含まれるようメトリクスの内側に置く
+	handler := s.metrics.Middleware(mux, s.faults.Middleware(mux))
+	return serverspan.NewHandler(mux, handler, "post-service", otelhttp.WithFilter(s.health.Filter))
 }
 
-func (s *PostService) errorHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// エラー検証用エンドポイント
-	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-
-	// エラーメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		s.requestCounter.Add(ctx, 1, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/error"),
-			semconv.HTTPResponseStatusCodeKey.Int(503),
-		))
-		s.responseTime.Record(ctx, duration, metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/error"),
-		))
-	}()
-	
-	// 意図的にエラーを発生させる
-	err := fmt.Errorf("intentional database connection error")
-	
-	// エラーをスパンに記録
-	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-		recordError(span, err, "Database connection failed")
-		span.SetAttributes(
-			semconv.HTTPResponseStatusCodeKey.Int(503),
-			semconv.ErrorTypeKey.String("database_error"),
-		)
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// -h は使い方を表示して正常終了する
+			return
+		}
+		log.Fatal(err)
 	}
-	
-	http.Error(w, "Database temporarily unavailable", http.StatusServiceUnavailable)
 }
 
-func main() {
-	tp, err := initTracer()
+// run はシグナル受信時やエラー時にも defer（DB クローズ、テレメトリーのフラッシュ）が実行されるよう main から分けている
+func run() error {
+	cfg, err := config.LoadService("post-service", config.Service{
+		ListenAddr:  ":8081",
+		DatabaseDSN: config.DefaultDatabaseDSN,
+	}, os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}()
+	cfg.Print(os.Stdout)
 
-	mp, err := initMetrics()
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{ServiceName: "post-service"})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if err := mp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down meter provider: %v", err)
-		}
-	}()
+	defer telemetry.Shutdown(shutdown)
 
-	db, err := initDB()
+	db, err := initDB(cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer db.Close()
 
 	service, err := initServiceMetrics()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	service.store = newPostgresPostStore(db)
+	if service.faults, err = faultinject.Load(cfg.FaultRulesFile); err != nil {
+		return err
 	}
-	service.db = db
+	service.faultAdmin = cfg.FaultAdmin
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/posts", service.getPostHandler)
-	mux.HandleFunc("/posts/by-user", service.getUserPostsHandler)
-	mux.HandleFunc("/health", service.healthHandler)
-	mux.HandleFunc("/error", service.errorHandler)
+	service.health = health.New("post-service", health.Options{
+		Timeout:     cfg.HealthCheckTimeout,
+		TraceChecks: cfg.TraceHealthChecks,
+	})
+	service.health.Add("database", true, db.PingContext)
+	service.health.Add("otlp_exporter", false, telemetry.CheckExport)
 
-	// HTTP計装でラップ
-	handler := otelhttp.NewHandler(mux, "post-service")
+	handler := service.routes()
 
-	fmt.Println("🚀 Post service starting on :8081")
+	fmt.Printf("🚀 Post service starting on %s\n", cfg.ListenAddr)
 	fmt.Println("📊 Endpoints:")
-	fmt.Println("  GET /posts?id=1 - Get post by ID")
+	fmt.Println("  GET /posts?id=1, GET /posts/1 - Get post by ID")
+	fmt.Println("  POST /posts - Create post (422 if user_id does not exist)")
+	fmt.Println("  PUT /posts/1, PATCH /posts/1 - Update post")
+	fmt.Println("  DELETE /posts/1 - Delete post")
 	fmt.Println("  GET /posts/by-user?user_id=1 - Get posts by user ID")
-	fmt.Println("  GET /health - Health check")
-	fmt.Println("  GET /error - Test error endpoint")
+	fmt.Println("      &limit=20 &cursor=<X-Next-Cursor> | &offset=20 &sort=created_at_asc &from=2024-01-01 &to=2024-12-31")
+	fmt.Println("  GET /livez - Liveness probe")
+	fmt.Println("  GET /readyz, GET /health - Readiness with per-component checks")
+	if cfg.FaultAdmin {
+		fmt.Println("  GET|PUT|POST|DELETE /admin/faults - Fault-injection rules (unauthenticated)")
+	}
 	fmt.Println("📈 Traces sent to Jaeger: http://localhost:16686")
-	fmt.Println("📊 Metrics exported to OTLP: http://localhost:4318")
+	fmt.Printf("📊 Metrics exported to OTLP: %s\n", telemetry.Target("metrics"))
+	fmt.Printf("📝 Logs (with trace_id/span_id) exported to OTLP: %s\n", telemetry.Target("logs"))
 
-	if err := http.ListenAndServe(":8081", handler); err != nil {
-		log.Fatal(err)
-	}
+	srv := server.New(cfg.ListenAddr, handler, server.Options{
+		Name:            "post-service",
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	})
+	// 停止が始まったら readiness を落とす
+	service.health.Add("server", true, srv.CheckReady)
+	return srv.Run(context.Background())
 }
\ No newline at end of file
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// newTestService は本番と同じルーティングでメモリストアを使うサービスを作る
+func newTestService(t *testing.T, store *memoryPostStore) (*telemetrytest.Harness, http.Handler) {
+	t.Helper()
+
+	h := telemetrytest.New(t)
+	service, err := initServiceMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.store = store
+	if service.faults, err = faultinject.Load("../../faults/post-service.json"); err != nil {
+		t.Fatal(err)
+	}
+	service.health = health.New("post-service", health.Options{})
+	return h, service.routes()
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func seedPosts() []Post {
+	return []Post{
+		{ID: 1, UserID: 1, Title: "first", Content: "a", CreatedAt: "2024-01-01T00:00:00Z"},
+		{ID: 2, UserID: 1, Title: "second", Content: "b", CreatedAt: "2024-02-01T00:00:00Z"},
+		{ID: 3, UserID: 1, Title: "third", Content: "c", CreatedAt: "2024-03-01T00:00:00Z"},
+		{ID: 4, UserID: 2, Title: "other", Content: "d", CreatedAt: "2024-03-01T00:00:00Z"},
+	}
+}
+
+func TestGetPostPropagatesParent(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore(nil, seedPosts()...))
+
+	ctx, client := otel.Tracer("test").Start(context.Background(), "client", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	r := httptest.NewRequest(http.MethodGet, "/posts/2", nil)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	w := serve(handler, r)
+	client.End()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	// ハンドラは otelhttp のサーバースパンを複製せず、ルート名のスパンに属性を足す
+	if spans := h.Spans(); len(spans) != 2 {
+		t.Fatalf("got %d spans %v, want the client and one server span", len(spans), spans)
+	}
+	server := h.Span(t, "GET /posts/{id}")
+	if server.Parent.SpanID() != client.SpanContext().SpanID() || !server.Parent.IsRemote() {
+		t.Errorf("parent = %v, want remote client span %v", server.Parent.SpanID(), client.SpanContext().SpanID())
+	}
+	for key, want := range map[attribute.Key]int64{"post.id": 2, serverspan.RowsKey: 1} {
+		if got := telemetrytest.Attr(server, key).AsInt64(); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+	if got := telemetrytest.Attr(server, semconv.HTTPRouteKey).AsString(); got != "/posts/{id}" {
+		t.Errorf("http.route = %q, want /posts/{id}", got)
+	}
+	if server.SpanContext.TraceID() != client.SpanContext().TraceID() {
+		t.Errorf("trace id = %v, want %v", server.SpanContext.TraceID(), client.SpanContext().TraceID())
+	}
+
+	duration := telemetrytest.HistogramPoint[float64](t, h.Metric(t, "post_service_request_duration_seconds"),
+		semconv.HTTPRequestMethodKey.String("GET"),
+		semconv.HTTPRouteKey.String("/posts/{id}"),
+	)
+	if !telemetrytest.HasExemplarFor(duration.Exemplars, server) {
+		t.Errorf("no exemplar for trace %v in %v", server.SpanContext.TraceID(), duration.Exemplars)
+	}
+}
+
+func TestGetUserPostsPaginates(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore(nil, seedPosts()...))
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/posts/by-user?user_id=1&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var posts []Post
+	if err := json.NewDecoder(w.Body).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].ID != 3 || posts[1].ID != 2 {
+		t.Fatalf("posts = %+v, want ids [3 2]", posts)
+	}
+	cursor := w.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("X-Next-Cursor is empty")
+	}
+
+	server := h.Span(t, "GET /posts/by-user")
+	for key, want := range map[attribute.Key]int64{"user.id": 1, "page.limit": 2, "page.size": 2, serverspan.RowsKey: 2} {
+		if got := telemetrytest.Attr(server, key).AsInt64(); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+	if !telemetrytest.Attr(server, "page.has_next").AsBool() {
+		t.Error("page.has_next = false, want true")
+	}
+
+	pageSize := telemetrytest.HistogramPoint[int64](t, h.Metric(t, "post_service_page_size"),
+		semconv.HTTPRouteKey.String("/posts/by-user"),
+		attribute.String("page.mode", "cursor"),
+	)
+	if pageSize.Count != 1 || pageSize.Sum != 2 {
+		t.Errorf("page size count=%d sum=%d, want 1/2", pageSize.Count, pageSize.Sum)
+	}
+
+	// 2 ページ目は残りの 1 件で終わる
+	w = serve(handler, httptest.NewRequest(http.MethodGet, "/posts/by-user?user_id=1&limit=2&cursor="+cursor, nil))
+	posts = nil
+	if err := json.NewDecoder(w.Body).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != 1 || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("second page = %+v (next %q), want [1] without cursor", posts, w.Header().Get("X-Next-Cursor"))
+	}
+}
+
+func TestGetUserPostsOffsetModeHasNoCursor(t *testing.T) {
+	_, handler := newTestService(t, newMemoryPostStore(nil, seedPosts()...))
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/posts/by-user?user_id=1&limit=2&offset=0", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if cursor := w.Header().Get("X-Next-Cursor"); cursor != "" {
+		t.Errorf("X-Next-Cursor = %q in offset mode, want none", cursor)
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, "offset=2") || strings.Contains(link, "cursor=") {
+		t.Errorf("Link = %q, want the next offset only", link)
+	}
+}
+
+func TestGetUserPostsInvalidQuery(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore(nil))
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/posts/by-user?user_id=1&cursor=x&offset=1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+
+	server := h.Span(t, "GET /posts/by-user")
+	if server.Status.Code != codes.Error || server.Status.Description != "Invalid query parameters" {
+		t.Errorf("status = %+v, want Error/Invalid query parameters", server.Status)
+	}
+	errors := telemetrytest.SumPoint[int64](t, h.Metric(t, "post_service_errors_total"),
+		semconv.HTTPRouteKey.String("/posts/by-user"),
+		semconv.HTTPResponseStatusCodeKey.Int(400),
+	)
+	if errors.Value != 1 {
+		t.Errorf("post_service_errors_total = %d, want 1", errors.Value)
+	}
+}
+
+func TestGetPostInvalidIDMarksSpanError(t *testing.T) {
+	for _, target := range []string{"/posts", "/posts?id=abc", "/posts/abc"} {
+		t.Run(target, func(t *testing.T) {
+			h, handler := newTestService(t, newMemoryPostStore(nil))
+
+			if w := serve(handler, httptest.NewRequest(http.MethodGet, target, nil)); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			server := h.Spans()[0]
+			if server.Status.Code != codes.Error || server.Status.Description != "Invalid post id" {
+				t.Errorf("status = %+v, want Error/Invalid post id", server.Status)
+			}
+			if got := telemetrytest.Attr(server, semconv.HTTPResponseStatusCodeKey).AsInt64(); got != 400 {
+				t.Errorf("http.response.status_code = %d, want 400", got)
+			}
+			telemetrytest.SumPoint[int64](t, h.Metric(t, "post_service_errors_total"), semconv.HTTPResponseStatusCodeKey.Int(400))
+		})
+	}
+}
+
+func TestCreatePostUnknownUser(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore([]int{1}))
+
+	body := strings.NewReader(`{"user_id":7,"title":"hello","content":"world"}`)
+	w := serve(handler, httptest.NewRequest(http.MethodPost, "/posts", body))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", w.Code, w.Body)
+	}
+
+	server := h.Span(t, "POST /posts")
+	if server.Status.Code != codes.Error {
+		t.Errorf("status = %+v, want Error", server.Status)
+	}
+	if got := telemetrytest.Attr(server, "db.response.status_code").AsString(); got != pgForeignKeyViolation {
+		t.Errorf("db.response.status_code = %q, want %s", got, pgForeignKeyViolation)
+	}
+	if got := telemetrytest.Attr(server, "db.postgresql.constraint").AsString(); got != "posts_user_id_fkey" {
+		t.Errorf("db.postgresql.constraint = %q, want posts_user_id_fkey", got)
+	}
+	telemetrytest.SumPoint[int64](t, h.Metric(t, "post_service_errors_total"),
+		semconv.HTTPRequestMethodKey.String("POST"),
+		semconv.ErrorTypeKey.String(pgForeignKeyViolation),
+	)
+}
+
+func TestUpdateAndDeletePost(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore([]int{1}, seedPosts()...))
+
+	w := serve(handler, httptest.NewRequest(http.MethodPatch, "/posts/1", strings.NewReader(`{"title":"renamed"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var post Post
+	if err := json.NewDecoder(w.Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "renamed" || post.Content != "a" {
+		t.Errorf("post = %+v, want title renamed and content kept", post)
+	}
+
+	if w := serve(handler, httptest.NewRequest(http.MethodDelete, "/posts/1", nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, want 204", w.Code)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodDelete, "/posts/1", nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("second delete status = %d, want 404", w.Code)
+	}
+
+	spans := h.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	if spans[2].Status.Code != codes.Error {
+		t.Errorf("404 span status = %+v, want Error", spans[2].Status)
+	}
+	// 実際のステータスコードごとに数える
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		deletes := telemetrytest.SumPoint[int64](t, h.Metric(t, "post_service_requests_total"),
+			semconv.HTTPRequestMethodKey.String("DELETE"),
+			semconv.HTTPRouteKey.String("/posts/{id}"),
+			semconv.HTTPResponseStatusCodeKey.Int(status),
+		)
+		if deletes.Value != 1 {
+			t.Errorf("DELETE %d count = %d, want 1", status, deletes.Value)
+		}
+	}
+}
+
+func TestErrorEndpointIsInjectedFault(t *testing.T) {
+	h, handler := newTestService(t, newMemoryPostStore(nil))
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/error", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+
+	// 注入した障害は例外イベントを持たず、fault.* 属性で区別できる
+	server := h.Span(t, "GET")
+	if server.Status.Code != codes.Error || telemetrytest.HasEvent(server, "exception") {
+		t.Errorf("status = %+v, events = %v, want Error without exception event", server.Status, server.Events)
+	}
+	if got := telemetrytest.Attr(server, faultinject.AttrType).AsString(); got != "status_503" {
+		t.Errorf("fault.type = %q, want status_503", got)
+	}
+}
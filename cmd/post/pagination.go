@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	sortCreatedAtDesc = "created_at_desc"
+	sortCreatedAtAsc  = "created_at_asc"
+)
+
+// postCursor はキーセットページネーションの位置 (created_at, id)
+type postCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// encode は created_at と id を不透明な文字列にする
+func (c postCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(s string) (*postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &postCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// postPageQuery は GET /posts/by-user の検索条件
+//
+// Cursor と Offset は排他で、offset パラメータが指定された場合のみ
+// オフセット、それ以外はキーセットでページングする。
+type postPageQuery struct {
+	UserID    int
+	Limit     int
+	Offset    int
+	UseOffset bool
+	Cursor    *postCursor
+	Ascending bool
+	// From/To はゼロ値なら無制限。From は含み、To は含まない
+	From time.Time
+	To   time.Time
+}
+
+// postPage は 1 ページ分の結果。Next は次ページが無ければ nil
+type postPage struct {
+	Posts []Post
+	Next  *postCursor
+}
+
+// newPostPage は Limit+1 件取得した結果から 1 ページ分を切り出す。
+// Limit+1 件目があれば次ページあり
+func newPostPage(posts []Post, limit int) (*postPage, error) {
+	page := &postPage{Posts: posts}
+	if len(posts) <= limit {
+		return page, nil
+	}
+
+	page.Posts = posts[:limit]
+	last := page.Posts[len(page.Posts)-1]
+	createdAt, err := time.Parse(time.RFC3339Nano, last.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	page.Next = &postCursor{CreatedAt: createdAt, ID: last.ID}
+	return page, nil
+}
+
+func (q postPageQuery) sort() string {
+	if q.Ascending {
+		return sortCreatedAtAsc
+	}
+	return sortCreatedAtDesc
+}
+
+func (q postPageQuery) mode() string {
+	if q.UseOffset {
+		return "offset"
+	}
+	return "cursor"
+}
+
+// sql は検索条件から SELECT 文と引数を組み立てる。次ページ判定のため Limit+1 件取得する
+func (q postPageQuery) sql() (string, []any) {
+	args := []any{q.UserID}
+	where := []string{"user_id = $1"}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if !q.From.IsZero() {
+		where = append(where, "created_at >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "created_at < "+arg(q.To))
+	}
+
+	order, cmp := "DESC", "<"
+	if q.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	if q.Cursor != nil {
+		where = append(where, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(q.Cursor.CreatedAt), arg(q.Cursor.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, title, content, created_at
+		FROM posts
+		WHERE %s
+		ORDER BY created_at %s, id %s
+		LIMIT %s`, strings.Join(where, " AND "), order, order, arg(q.Limit+1))
+	if q.UseOffset && q.Offset > 0 {
+		query += " OFFSET " + arg(q.Offset)
+	}
+	return query, args
+}
+
+// parsePostPageQuery はクエリパラメータを検証して postPageQuery にする
+func parsePostPageQuery(r *http.Request) (postPageQuery, error) {
+	params := r.URL.Query()
+	q := postPageQuery{Limit: defaultPageLimit}
+
+	userIDStr := params.Get("user_id")
+	if userIDStr == "" {
+		return q, errors.New("user_id is required")
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return q, errors.New("invalid user_id")
+	}
+	q.UserID = userID
+
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > maxPageLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+
+	switch params.Get("sort") {
+	case "", sortCreatedAtDesc:
+	case sortCreatedAtAsc:
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("sort must be %s or %s", sortCreatedAtDesc, sortCreatedAtAsc)
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		if params.Has("offset") {
+			return q, errors.New("cursor and offset cannot be combined")
+		}
+		if q.Cursor, err = decodePostCursor(v); err != nil {
+			return q, err
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, errors.New("offset must be a non-negative integer")
+		}
+		q.UseOffset = true
+	}
+
+	if q.From, err = parseDateParam(params, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseDateParam(params, "to"); err != nil {
+		return q, err
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, errors.New("from must be before to")
+	}
+
+	return q, nil
+}
+
+// parseDateParam は RFC3339 もしくは YYYY-MM-DD を受け付ける
+func parseDateParam(params url.Values, name string) (time.Time, error) {
+	v := params.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be RFC3339 or YYYY-MM-DD", name)
+}
+
+// nextPageURL は同じ検索条件で次ページを指す URL を返す
+func nextPageURL(r *http.Request, q postPageQuery, page *postPage) string {
+	params := r.URL.Query()
+	params.Set("limit", strconv.Itoa(q.Limit))
+	if q.mode() == "offset" {
+		params.Set("offset", strconv.Itoa(q.Offset+len(page.Posts)))
+	} else {
+		params.Set("cursor", page.Next.encode())
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+	return u.String()
+}
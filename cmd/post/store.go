@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// PostStore は posts テーブルへのアクセスを抽象化する
+//
+// 見つからない場合は sql.ErrNoRows、制約違反は *ConstraintError を返す。
+type PostStore interface {
+	GetPost(ctx context.Context, postID int) (*Post, error)
+	// ListUserPosts は q に従って 1 ページ分の投稿と次ページのカーソルを返す
+	ListUserPosts(ctx context.Context, q postPageQuery) (*postPage, error)
+	CreatePost(ctx context.Context, in postInput) (*Post, error)
+	// UpdatePost は nil のフィールドを現在の値のまま残す（PUT/PATCH 共通）
+	UpdatePost(ctx context.Context, postID int, in postInput) (*Post, error)
+	DeletePost(ctx context.Context, postID int) error
+}
+
+// postgresPostStore は otelsql で計装された *sql.DB を使う PostStore
+type postgresPostStore struct {
+	db *sql.DB
+}
+
+func newPostgresPostStore(db *sql.DB) *postgresPostStore {
+	return &postgresPostStore{db: db}
+}
+
+func (s *postgresPostStore) GetPost(ctx context.Context, postID int) (*Post, error) {
+	// SQL操作は otelsql で自動計装されるため、手動スパン不要
+	query := "SELECT id, user_id, title, content, created_at FROM posts WHERE id = $1"
+	row := s.db.QueryRowContext(ctx, query, postID)
+
+	var post Post
+	if err := row.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt); err != nil {
+		// 現在のスパンがあればエラーを記録
+		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+			recordError(span, err, "Failed to scan post data")
+		}
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+func (s *postgresPostStore) ListUserPosts(ctx context.Context, q postPageQuery) (*postPage, error) {
+	// SQL操作は otelsql で自動計装されるため、手動スパン不要
+	query, args := q.sql()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPostPage(posts, q.Limit)
+}
+
+func (s *postgresPostStore) CreatePost(ctx context.Context, in postInput) (*Post, error) {
+	query := `
+		INSERT INTO posts (user_id, title, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, title, content, created_at
+	`
+	var post Post
+	err := s.db.QueryRowContext(ctx, query, *in.UserID, strings.TrimSpace(*in.Title), *in.Content).
+		Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	return &post, nil
+}
+
+func (s *postgresPostStore) UpdatePost(ctx context.Context, postID int, in postInput) (*Post, error) {
+	query := `
+		UPDATE posts
+		SET user_id = COALESCE($2, user_id),
+			title = COALESCE($3, title),
+			content = COALESCE($4, content)
+		WHERE id = $1
+		RETURNING id, user_id, title, content, created_at
+	`
+	var userID sql.NullInt64
+	if in.UserID != nil {
+		userID = sql.NullInt64{Int64: int64(*in.UserID), Valid: true}
+	}
+	var title, content sql.NullString
+	if in.Title != nil {
+		title = sql.NullString{String: strings.TrimSpace(*in.Title), Valid: true}
+	}
+	if in.Content != nil {
+		content = sql.NullString{String: *in.Content, Valid: true}
+	}
+
+	var post Post
+	err := s.db.QueryRowContext(ctx, query, postID, userID, title, content).
+		Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	return &post, nil
+}
+
+func (s *postgresPostStore) DeletePost(ctx context.Context, postID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", postID)
+	if err != nil {
+		return constraintError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// constraintError は Postgres の整合性制約違反（クラス 23）を ConstraintError に変換する
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "23" {
+		return &ConstraintError{
+			Code:       string(pqErr.Code),
+			Constraint: pqErr.Constraint,
+			Detail:     pqErr.Detail,
+			Err:        err,
+		}
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryPostStore は DB なしで動く PostStore。ハンドラのテストやデモに使う
+type memoryPostStore struct {
+	mu     sync.Mutex
+	posts  map[int]Post
+	users  map[int]bool // nil なら user_id の外部キーを検査しない
+	nextID int
+}
+
+// newMemoryPostStore は seed の投稿を ID そのままで登録する。
+// userIDs を渡すと、それ以外の user_id での作成・更新を外部キー違反にする
+func newMemoryPostStore(userIDs []int, seed ...Post) *memoryPostStore {
+	s := &memoryPostStore{posts: map[int]Post{}, nextID: 1}
+	if userIDs != nil {
+		s.users = map[int]bool{}
+		for _, id := range userIDs {
+			s.users[id] = true
+		}
+	}
+	for _, p := range seed {
+		if p.CreatedAt == "" {
+			p.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		s.posts[p.ID] = p
+		if p.ID >= s.nextID {
+			s.nextID = p.ID + 1
+		}
+	}
+	return s
+}
+
+func (s *memoryPostStore) GetPost(ctx context.Context, postID int) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &post, nil
+}
+
+// ListUserPosts は postPageQuery.sql と同じ条件・並び順をメモリ上で再現する
+func (s *memoryPostStore) ListUserPosts(ctx context.Context, q postPageQuery) (*postPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type row struct {
+		post      Post
+		createdAt time.Time
+	}
+	var rows []row
+	for _, p := range s.posts {
+		if p.UserID != q.UserID {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if !q.From.IsZero() && createdAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !createdAt.Before(q.To) {
+			continue
+		}
+		rows = append(rows, row{post: p, createdAt: createdAt})
+	}
+
+	// (created_at, id) の昇順で比較する
+	less := func(a, b row) bool {
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.Before(b.createdAt)
+		}
+		return a.post.ID < b.post.ID
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if q.Ascending {
+			return less(rows[i], rows[j])
+		}
+		return less(rows[j], rows[i])
+	})
+
+	posts := []Post{}
+	skipped := 0
+	for _, r := range rows {
+		if q.Cursor != nil {
+			cur := row{post: Post{ID: q.Cursor.ID}, createdAt: q.Cursor.CreatedAt}
+			if q.Ascending && !less(cur, r) || !q.Ascending && !less(r, cur) {
+				continue
+			}
+		}
+		if q.UseOffset && skipped < q.Offset {
+			skipped++
+			continue
+		}
+		posts = append(posts, r.post)
+		if len(posts) > q.Limit {
+			break
+		}
+	}
+
+	return newPostPage(posts, q.Limit)
+}
+
+func (s *memoryPostStore) CreatePost(ctx context.Context, in postInput) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUser(*in.UserID); err != nil {
+		return nil, err
+	}
+
+	post := Post{
+		ID:        s.nextID,
+		UserID:    *in.UserID,
+		Title:     strings.TrimSpace(*in.Title),
+		Content:   *in.Content,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	s.posts[post.ID] = post
+	s.nextID++
+	return &post, nil
+}
+
+func (s *memoryPostStore) UpdatePost(ctx context.Context, postID int, in postInput) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if in.UserID != nil {
+		if err := s.checkUser(*in.UserID); err != nil {
+			return nil, err
+		}
+		post.UserID = *in.UserID
+	}
+	if in.Title != nil {
+		post.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Content != nil {
+		post.Content = *in.Content
+	}
+	s.posts[postID] = post
+	return &post, nil
+}
+
+func (s *memoryPostStore) DeletePost(ctx context.Context, postID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.posts, postID)
+	return nil
+}
+
+// checkUser は posts.user_id の外部キー制約を再現する
+func (s *memoryPostStore) checkUser(userID int) error {
+	if s.users == nil || s.users[userID] {
+		return nil
+	}
+	return &ConstraintError{
+		Code:       pgForeignKeyViolation,
+		Constraint: "posts_user_id_fkey",
+		Detail:     fmt.Sprintf(`Key (user_id)=(%d) is not present in table "users".`, userID),
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// memoryPostStore のページングが postPageQuery.sql と同じ結果になることを確認する
+func TestMemoryPostStoreListUserPosts(t *testing.T) {
+	store := newMemoryPostStore(nil, seedPosts()...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		q    postPageQuery
+		want []int
+		next bool
+	}{
+		{"desc", postPageQuery{UserID: 1, Limit: 10}, []int{3, 2, 1}, false},
+		{"asc", postPageQuery{UserID: 1, Limit: 10, Ascending: true}, []int{1, 2, 3}, false},
+		{"limit", postPageQuery{UserID: 1, Limit: 2}, []int{3, 2}, true},
+		{"offset", postPageQuery{UserID: 1, Limit: 1, Offset: 1, UseOffset: true}, []int{2}, true},
+		{"cursor", postPageQuery{UserID: 1, Limit: 10, Cursor: &postCursor{CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), ID: 2}}, []int{1}, false},
+		{"range", postPageQuery{UserID: 1, Limit: 10, From: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, []int{2}, false},
+		{"other user", postPageQuery{UserID: 3, Limit: 10}, []int{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := store.ListUserPosts(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []int{}
+			for _, p := range page.Posts {
+				got = append(got, p.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ids = %v, want %v", got, tt.want)
+				}
+			}
+			if (page.Next != nil) != tt.next {
+				t.Errorf("next = %v, want %v", page.Next, tt.next)
+			}
+		})
+	}
+}
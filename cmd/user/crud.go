@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/serverspan"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	maxNameLength  = 100 // users.name VARCHAR(100)
+	maxEmailLength = 150 // users.email VARCHAR(150)
+)
+
+// Postgres のエラーコード
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+var (
+	errEmailTaken    = errors.New("email already exists")
+	errUserReferred  = errors.New("user is still referenced by posts")
+	errInvalidUserID = errors.New("invalid user id")
+)
+
+// userInput は作成・更新リクエストのボディ。PATCH では省略されたフィールドを更新しない
+type userInput struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+type userList struct {
+	Users  []User `json:"users"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Total  int    `json:"total"`
+}
+
+// validate は partial が false の場合すべてのフィールドを必須とする
+func (in userInput) validate(partial bool) error {
+	if !partial && (in.Name == nil || in.Email == nil) {
+		return errors.New("name and email are required")
+	}
+	if partial && in.Name == nil && in.Email == nil {
+		return errors.New("at least one of name or email is required")
+	}
+	if in.Name != nil {
+		if name := strings.TrimSpace(*in.Name); name == "" || len(name) > maxNameLength {
+			return fmt.Errorf("name must be 1-%d characters", maxNameLength)
+		}
+	}
+	if in.Email != nil {
+		if email := strings.TrimSpace(*in.Email); !strings.Contains(email, "@") || len(email) > maxEmailLength {
+			return fmt.Errorf("email must be a valid address of at most %d characters", maxEmailLength)
+		}
+	}
+	return nil
+}
+
+// writeError はステータスコードに応じてスパンにエラーを記録してからレスポンスを返す
+func writeError(ctx context.Context, w http.ResponseWriter, status int, err error, description string) {
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(status))
+		recordError(span, err, description)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeStoreError はストアのエラーを 404/409/500 に振り分ける
+func writeStoreError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(ctx, w, http.StatusNotFound, errors.New("user not found"), "User not found")
+	case errors.Is(err, errEmailTaken):
+		writeError(ctx, w, http.StatusConflict, err, "Duplicate email")
+	case errors.Is(err, errUserReferred):
+		writeError(ctx, w, http.StatusConflict, err, "User is referenced by posts")
+	default:
+		// 内部のエラーはレスポンスに出さない
+		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+			span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(http.StatusInternalServerError))
+			recordError(span, err, "Database error")
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	// レスポンスヘッダーにトレース情報を注入
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(ctx, "failed to encode response", "error", err)
+	}
+}
+
+func pathUserID(r *http.Request) (int, error) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		return 0, errInvalidUserID
+	}
+	return userID, nil
+}
+
+func decodeUserInput(r *http.Request, partial bool) (userInput, error) {
+	var in userInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return in, fmt.Errorf("invalid request body: %w", err)
+	}
+	return in, in.validate(partial)
+}
+
+func (s *UserService) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid pagination")
+		return
+	}
+
+	list, err := s.store.ListUsers(ctx, limit, offset)
+	if err != nil {
+		writeStoreError(ctx, w, err)
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("users.limit", limit),
+			attribute.Int("users.offset", offset),
+			attribute.Int("users.returned", len(list.Users)),
+			serverspan.RowsKey.Int(len(list.Users)),
+		)
+	}
+	writeJSON(ctx, w, http.StatusOK, list)
+}
+
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	limit, offset = defaultPageLimit, 0
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+func (s *UserService) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	in, err := decodeUserInput(r, false)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid user input")
+		return
+	}
+
+	user, err := s.store.CreateUser(ctx, in)
+	if err != nil {
+		writeStoreError(ctx, w, err)
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("user.id", user.ID))
+	}
+	w.Header().Set("Location", fmt.Sprintf("/users/%d", user.ID))
+	writeJSON(ctx, w, http.StatusCreated, user)
+}
+
+// updateUserHandler は PUT（全項目必須）と PATCH（部分更新）の両方を処理する
+func (s *UserService) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := pathUserID(r)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid user id")
+		return
+	}
+
+	in, err := decodeUserInput(r, r.Method == http.MethodPatch)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid user input")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("user.id", userID))
+	}
+
+	user, err := s.store.UpdateUser(ctx, userID, in)
+	if err != nil {
+		writeStoreError(ctx, w, err)
+		return
+	}
+	writeJSON(ctx, w, http.StatusOK, user)
+}
+
+func (s *UserService) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := pathUserID(r)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err, "Invalid user id")
+		return
+	}
+
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Int("user.id", userID))
+	}
+
+	if err := s.store.DeleteUser(ctx, userID); err != nil {
+		writeStoreError(ctx, w, err)
+		return
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+	w.WriteHeader(http.StatusNoContent)
+}
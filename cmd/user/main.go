@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -14,17 +17,20 @@ import (
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/exemplar"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/httpmetrics"
+	"otel-playground/internal/server"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry"
 )
 
 type User struct {
@@ -35,61 +41,18 @@ type User struct {
 }
 
 type UserService struct {
-	db                *sql.DB
-	requestCounter    metric.Int64Counter
-	responseTime      metric.Float64Histogram
-	activeConnections metric.Int64UpDownCounter
+	store   UserStore
+	faults  *faultinject.Injector
+	health  *health.Checker
+	metrics *httpmetrics.Metrics
+	// faultAdmin なら障害注入ルールを変更する API を登録する
+	faultAdmin bool
 }
 
-func initTracer() (*trace.TracerProvider, error) {
-	exporter, err := otlptracehttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("user-service"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(res),
-	)
-	otel.SetTracerProvider(tp)
-
-	// トレースコンテキストの伝播設定
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp, nil
-}
-
-func initMetrics() (*sdkmetric.MeterProvider, error) {
-	exporter, err := otlpmetrichttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("user-service"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	// 🎯 研究に基づく正しいViews & Exemplars実装
-	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(5*time.Second))
-	
+// 🎯 研究に基づく正しいViews & Exemplars実装
+func customHistogramView() sdkmetric.View {
 	// Custom histogram view with custom buckets
-	customHistogramView := sdkmetric.NewView(
+	return sdkmetric.NewView(
 		sdkmetric.Instrument{
 			Name: "user_service_request_duration_seconds",
 		},
@@ -110,56 +73,24 @@ func initMetrics() (*sdkmetric.MeterProvider, error) {
 			},
 		},
 	)
-
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(reader),
-		sdkmetric.WithResource(res),
-		sdkmetric.WithView(customHistogramView),
-		// 🔗 Enable trace-based exemplar filtering
-		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
-	)
-	otel.SetMeterProvider(mp)
-
-	return mp, nil
 }
 
 func initServiceMetrics() (*UserService, error) {
-	meter := otel.Meter("user-service")
-
-	requestCounter, err := meter.Int64Counter(
-		"user_service_requests_total",
-		metric.WithDescription("Total number of requests to user service"),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	responseTime, err := meter.Float64Histogram(
-		"user_service_request_duration_seconds",
-		metric.WithDescription("Duration of requests to user service"),
-		metric.WithUnit("s"),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	activeConnections, err := meter.Int64UpDownCounter(
-		"user_service_active_connections",
-		metric.WithDescription("Number of active connections to user service"),
-	)
+	s := &UserService{}
+	metrics, err := httpmetrics.New(otel.Meter("user-service"), "user_service", httpmetrics.Options{
+		// ヘルスチェックは otelhttp と同じくメトリクスにも数えない
+		Filter:      func(r *http.Request) bool { return s.health.Filter(r) },
+		SlowRequest: 100 * time.Millisecond,
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return &UserService{
-		requestCounter:    requestCounter,
-		responseTime:      responseTime,
-		activeConnections: activeConnections,
-	}, nil
+	s.metrics = metrics
+	return s, nil
 }
 
-func initDB() (*sql.DB, error) {
-	db, err := otelsql.Open("postgres", "host=localhost port=5432 user=postgres password=otelpass dbname=oteldb sslmode=disable")
+func initDB(dsn string) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -179,101 +110,38 @@ func recordError(span oteltrace.Span, err error, description string) {
 	}
 }
 
-func (s *UserService) getUser(ctx context.Context, userID int) (*User, error) {
-	// SQL操作は otelsql で自動計装されるため、手動スパン不要
-	query := "SELECT id, name, email, created_at FROM users WHERE id = $1"
-	row := s.db.QueryRowContext(ctx, query, userID)
-
-	var user User
-	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt); err != nil {
-		// 現在のスパンがあればエラーを記録
-		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-			recordError(span, err, "Failed to scan user data")
-		}
-		return nil, err
-	}
-
-	return &user, nil
-}
-
 func (s *UserService) getUserHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// トレースコンテキストをヘッダーから抽出
-	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-
-	// ヘッダーにトレースコンテキストが存在するかチェック
-	spanCtx := oteltrace.SpanContextFromContext(ctx)
-	if !spanCtx.IsValid() {
-		// 新しいトレースを開始（親トレースが存在しない場合）
-		tracer := otel.Tracer("user-service")
-		var span oteltrace.Span
-		ctx, span = tracer.Start(ctx, "getUserHandler")
-		defer span.End()
+	// ユーザーIDはパスパラメータ（/users/{id}）またはクエリパラメータ（/users?id=）から取得
+	userIDStr := r.PathValue("id")
+	if userIDStr == "" {
+		userIDStr = r.URL.Query().Get("id")
 	}
-	// HTTP操作は otelhttp.NewHandler で自動計装されるため、通常は手動スパン不要
-
-	// リクエスト処理の最後にメトリクスを記録（Exemplar対応）
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		
-		// Exemplar: トレースコンテキストを含むメトリクス記録
-		// これによりPrometheusでメトリクスからトレースにジャンプできる
-		attrs := metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/users"),
-		)
-		
-		s.requestCounter.Add(ctx, 1, attrs)
-		s.responseTime.Record(ctx, duration, attrs)
-		
-		// 🔍 Debug: Confirm histogram recording
-		fmt.Printf("📊 Recorded histogram: duration=%.3fs, method=%s, route=%s\n", 
-			duration, r.Method, "/users")
-		
-		// 特別なメトリクス：時間のかかるリクエストを記録
-		if duration > 0.1 { // 100ms以上
-			fmt.Printf("🐌 Slow request detected: %.3fs for %s %s\n", 
-				duration, r.Method, r.URL.Path)
-		}
-	}()
-
-	// ユーザーIDをパスパラメータから取得
-	userIDStr := r.URL.Query().Get("id")
+	// ID指定が無ければ一覧を返す
 	if userIDStr == "" {
-		http.Error(w, "user id is required", http.StatusBadRequest)
+		s.listUsersHandler(w, r)
 		return
 	}
 
+	// サーバースパンは otelhttp.NewHandler が開始済みなので、ハンドラはそこに属性を足すだけ
+	// リクエストメトリクス（Exemplar付き）は httpmetrics のミドルウェアが記録する
+	ctx := r.Context()
+
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
+		writeError(ctx, w, http.StatusBadRequest, errInvalidUserID, "Invalid user id")
 		return
 	}
-
-	// 🎯 デモ用：意図的に遅延を追加（ViewとExemplarの体験用）
-	if userID == 999 {
-		fmt.Printf("🐌 Simulating slow database query for user %d...\n", userID)
-		time.Sleep(2 * time.Second) // 2秒の遅延
-	} else if userID >= 100 && userID <= 110 {
-		fmt.Printf("⏱️ Medium delay for user %d...\n", userID)
-		time.Sleep(200 * time.Millisecond) // 200msの遅延
-	}
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("user.id", userID))
 
 	// ユーザー情報を取得
-	user, err := s.getUser(ctx, userID)
+	user, err := s.store.GetUser(ctx, userID)
 	if err != nil {
 		// エラーをスパンに記録
-		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-			if err == sql.ErrNoRows {
-				recordError(span, err, "User not found")
-			} else {
-				recordError(span, err, "Failed to get user")
-			}
+		if err == sql.ErrNoRows {
+			recordError(span, err, "User not found")
+		} else {
+			recordError(span, err, "Failed to get user")
 		}
 
 		if err == sql.ErrNoRows {
@@ -284,6 +152,8 @@ func (s *UserService) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	span.SetAttributes(serverspan.RowsKey.Int(1))
+
 	// レスポンスヘッダーにトレース情報を注入
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
 
@@ -295,121 +165,104 @@ func (s *UserService) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *UserService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// ヘルスチェックのメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		attrs := metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/health"),
-		)
-		s.requestCounter.Add(r.Context(), 1, attrs)
-		s.responseTime.Record(r.Context(), duration, attrs)
-	}()
+// routes はエンドポイントを登録し、otelhttp で計装したハンドラを返す
+func (s *UserService) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", s.getUserHandler)
+	mux.HandleFunc("POST /users", s.createUserHandler)
+	mux.HandleFunc("GET /users/{id}", s.getUserHandler)
+	mux.HandleFunc("PUT /users/{id}", s.updateUserHandler)
+	mux.HandleFunc("PATCH /users/{id}", s.updateUserHandler)
+	mux.HandleFunc("DELETE /users/{id}", s.deleteUserHandler)
+	s.health.Register(mux)
+	if s.faultAdmin {
+		s.faults.Register(mux)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"service": "user-service",
-	})
+	// 障害注入はサーバースパンに記録するため otelhttp の内側に置き、
+	// 注入した遅延やエラーもリクエストメトリクスに含まれるようメトリクスの内側に置く
+	handler := s.metrics.Middleware(mux, s.faults.Middleware(mux))
+	return serverspan.NewHandler(mux, handler, "user-service", otelhttp.WithFilter(s.health.Filter))
 }
 
-func (s *UserService) errorHandler(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	
-	// アクティブ接続数を増加
-	s.activeConnections.Add(r.Context(), 1)
-	defer s.activeConnections.Add(r.Context(), -1)
-
-	// エラー検証用エンドポイント
-	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-
-	// エラーメトリクスを記録
-	defer func() {
-		duration := time.Since(startTime).Seconds()
-		attrs := metric.WithAttributes(
-			semconv.HTTPRequestMethodKey.String(r.Method),
-			semconv.HTTPRouteKey.String("/error"),
-			semconv.HTTPResponseStatusCodeKey.Int(500),
-		)
-		s.requestCounter.Add(ctx, 1, attrs)
-		s.responseTime.Record(ctx, duration, attrs)
-	}()
-
-	// 意図的にエラーを発生させる
-	err := fmt.Errorf("intentional error for testing")
-
-	// エラーをスパンに記録
-	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-		recordError(span, err, "Intentional test error")
-		span.SetAttributes(
-			semconv.HTTPResponseStatusCodeKey.Int(500),
-			semconv.ErrorTypeKey.String("test_error"),
-		)
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// -h は使い方を表示して正常終了する
+			return
+		}
+		log.Fatal(err)
 	}
-
-	defer otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
-
-	http.Error(w, "This is a test error endpoint", http.StatusInternalServerError)
 }
 
-func main() {
-	tp, err := initTracer()
+// run はシグナル受信時やエラー時にも defer（DB クローズ、テレメトリーのフラッシュ）が実行されるよう main から分けている
+func run() error {
+	cfg, err := config.LoadService("user-service", config.Service{
+		ListenAddr:  ":8080",
+		DatabaseDSN: config.DefaultDatabaseDSN,
+	}, os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}()
+	cfg.Print(os.Stdout)
 
-	mp, err := initMetrics()
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{
+		ServiceName: "user-service",
+		Views:       []sdkmetric.View{customHistogramView()},
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if err := mp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down meter provider: %v", err)
-		}
-	}()
+	defer telemetry.Shutdown(shutdown)
 
-	db, err := initDB()
+	db, err := initDB(cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer db.Close()
 
 	service, err := initServiceMetrics()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	service.store = newPostgresUserStore(db)
+	if service.faults, err = faultinject.Load(cfg.FaultRulesFile); err != nil {
+		return err
 	}
-	service.db = db
+	service.faultAdmin = cfg.FaultAdmin
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/users", service.getUserHandler)
-	mux.HandleFunc("/health", service.healthHandler)
-	mux.HandleFunc("/error", service.errorHandler)
+	service.health = health.New("user-service", health.Options{
+		Timeout:     cfg.HealthCheckTimeout,
+		TraceChecks: cfg.TraceHealthChecks,
+	})
+	service.health.Add("database", true, db.PingContext)
+	service.health.Add("otlp_exporter", false, telemetry.CheckExport)
 
-	// HTTP計装でラップ
-	handler := otelhttp.NewHandler(mux, "user-service")
+	handler := service.routes()
 
-	fmt.Println("🚀 User service starting on :8080")
+	fmt.Printf("🚀 User service starting on %s\n", cfg.ListenAddr)
 	fmt.Println("📊 Endpoints:")
-	fmt.Println("  GET /users?id=1 - Get user by ID")
-	fmt.Println("  GET /health - Health check")
-	fmt.Println("  GET /error - Test error endpoint")
+	fmt.Println("  GET /users?id=1, GET /users/1 - Get user by ID")
+	fmt.Println("  GET /users?limit=20&offset=0 - List users")
+	fmt.Println("  POST /users - Create user")
+	fmt.Println("  PUT /users/1, PATCH /users/1 - Update user")
+	fmt.Println("  DELETE /users/1 - Delete user")
+	fmt.Println("  GET /livez - Liveness probe")
+	fmt.Println("  GET /readyz, GET /health - Readiness with per-component checks")
+	if cfg.FaultAdmin {
+		fmt.Println("  GET|PUT|POST|DELETE /admin/faults - Fault-injection rules (unauthenticated)")
+	}
 	fmt.Println("📈 Traces sent to Jaeger: http://localhost:16686")
-	fmt.Println("📊 Metrics exported to OTLP: http://localhost:4318")
+	fmt.Printf("📊 Metrics exported to OTLP: %s\n", telemetry.Target("metrics"))
+	fmt.Printf("📝 Logs (with trace_id/span_id) exported to OTLP: %s\n", telemetry.Target("logs"))
 
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatal(err)
-	}
+	srv := server.New(cfg.ListenAddr, handler, server.Options{
+		Name:            "user-service",
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	})
+	// 停止が始まったら readiness を落とす
+	service.health.Add("server", true, srv.CheckReady)
+	return srv.Run(context.Background())
 }
 
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/faultinject"
+	"otel-playground/internal/health"
+	"otel-playground/internal/httpmetrics"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// newTestService は本番と同じビュー・ルーティング・障害注入ルールでメモリストアを使うサービスを作る
+func newTestService(t *testing.T, seed ...User) (*telemetrytest.Harness, http.Handler) {
+	t.Helper()
+	h, service := newUserService(t, seed...)
+	return h, service.routes()
+}
+
+// newUserService は routes を呼ぶ前に設定を変えたいテスト向けに newTestService のサービスを返す
+func newUserService(t *testing.T, seed ...User) (*telemetrytest.Harness, *UserService) {
+	t.Helper()
+
+	h := telemetrytest.New(t, customHistogramView())
+	service, err := initServiceMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.store = newMemoryUserStore(seed...)
+	if service.faults, err = faultinject.Load("../../faults/user-service.json"); err != nil {
+		t.Fatal(err)
+	}
+	service.health = health.New("user-service", health.Options{})
+	return h, service
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestGetUserPropagatesParentAndRecordsExemplar(t *testing.T) {
+	h, handler := newTestService(t, User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+
+	// クライアント側のスパンを traceparent で渡す
+	ctx, client := otel.Tracer("test").Start(context.Background(), "client", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	w := serve(handler, r)
+	client.End()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	server := h.Span(t, "GET /users/{id}")
+	if server.SpanKind != oteltrace.SpanKindServer {
+		t.Errorf("span kind = %v, want server", server.SpanKind)
+	}
+	if server.Parent.SpanID() != client.SpanContext().SpanID() || !server.Parent.IsRemote() {
+		t.Errorf("parent = %v, want remote client span %v", server.Parent.SpanID(), client.SpanContext().SpanID())
+	}
+	if server.SpanContext.TraceID() != client.SpanContext().TraceID() {
+		t.Errorf("trace id = %v, want %v", server.SpanContext.TraceID(), client.SpanContext().TraceID())
+	}
+	if server.Status.Code != codes.Unset {
+		t.Errorf("status = %v, want unset", server.Status)
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String("GET"),
+		semconv.HTTPRouteKey.String("/users/{id}"),
+	}
+	requests := telemetrytest.SumPoint[int64](t, h.Metric(t, "user_service_requests_total"), attrs...)
+	if requests.Value != 1 {
+		t.Errorf("user_service_requests_total = %d, want 1", requests.Value)
+	}
+
+	// ビューで名前とバケットが差し替えられ、Exemplar がトレースを指すこと
+	duration := telemetrytest.HistogramPoint[float64](t, h.Metric(t, "user_service_response_time_custom"), attrs...)
+	if want := []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0}; !slices.Equal(duration.Bounds, want) {
+		t.Errorf("bounds = %v, want %v", duration.Bounds, want)
+	}
+	if duration.Count != 1 {
+		t.Errorf("count = %d, want 1", duration.Count)
+	}
+	if !telemetrytest.HasExemplarFor(duration.Exemplars, server) {
+		t.Errorf("no exemplar for trace %v in %v", server.SpanContext.TraceID(), duration.Exemplars)
+	}
+}
+
+func TestGetUserNotFoundMarksSpanError(t *testing.T) {
+	h, handler := newTestService(t)
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/users?id=42", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+
+	server := h.Span(t, "GET /users")
+	if server.Status.Code != codes.Error || server.Status.Description != "User not found" {
+		t.Errorf("status = %+v, want Error/User not found", server.Status)
+	}
+	if !telemetrytest.HasEvent(server, "exception") {
+		t.Errorf("no exception event recorded: %v", server.Events)
+	}
+	if got := telemetrytest.Attr(server, semconv.HTTPResponseStatusCodeKey).AsInt64(); got != 404 {
+		t.Errorf("http.response.status_code = %d, want 404", got)
+	}
+	telemetrytest.SumPoint[int64](t, h.Metric(t, "user_service_requests_total"), semconv.HTTPRouteKey.String("/users"))
+}
+
+func TestGetUserInvalidIDMarksSpanError(t *testing.T) {
+	h, handler := newTestService(t)
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/users?id=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+
+	server := h.Span(t, "GET /users")
+	if server.Status.Code != codes.Error || server.Status.Description != "Invalid user id" {
+		t.Errorf("status = %+v, want Error/Invalid user id", server.Status)
+	}
+	if got := telemetrytest.Attr(server, semconv.HTTPResponseStatusCodeKey).AsInt64(); got != 400 {
+		t.Errorf("http.response.status_code = %d, want 400", got)
+	}
+}
+
+func TestListUsersRecordsPageAttributes(t *testing.T) {
+	h, handler := newTestService(t,
+		User{ID: 1, Name: "Alice", Email: "alice@example.com"},
+		User{ID: 2, Name: "Bob", Email: "bob@example.com"},
+		User{ID: 3, Name: "Carol", Email: "carol@example.com"},
+	)
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/users?limit=2&offset=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	server := h.Span(t, "GET /users")
+	if got := telemetrytest.Attr(server, "users.returned").AsInt64(); got != 2 {
+		t.Errorf("users.returned = %d, want 2", got)
+	}
+	if got := telemetrytest.Attr(server, "users.offset").AsInt64(); got != 1 {
+		t.Errorf("users.offset = %d, want 1", got)
+	}
+}
+
+func TestCreateUserDuplicateEmailConflict(t *testing.T) {
+	h, handler := newTestService(t, User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+
+	body := strings.NewReader(`{"name":"Another Alice","email":"alice@example.com"}`)
+	w := serve(handler, httptest.NewRequest(http.MethodPost, "/users", body))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+
+	server := h.Span(t, "POST /users")
+	if server.Status.Code != codes.Error || server.Status.Description != "Duplicate email" {
+		t.Errorf("status = %+v, want Error/Duplicate email", server.Status)
+	}
+	telemetrytest.SumPoint[int64](t, h.Metric(t, "user_service_requests_total"),
+		semconv.HTTPRequestMethodKey.String("POST"),
+		semconv.HTTPRouteKey.String("/users"),
+	)
+}
+
+func TestCreateThenDeleteUser(t *testing.T) {
+	h, handler := newTestService(t)
+
+	body := strings.NewReader(`{"name":"Dave","email":"dave@example.com"}`)
+	w := serve(handler, httptest.NewRequest(http.MethodPost, "/users", body))
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/users/1" {
+		t.Fatalf("status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = serve(handler, httptest.NewRequest(http.MethodDelete, "/users/1", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, want 204", w.Code)
+	}
+
+	if spans := h.Spans(); len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	deletes := telemetrytest.SumPoint[int64](t, h.Metric(t, "user_service_requests_total"),
+		semconv.HTTPRequestMethodKey.String("DELETE"),
+		semconv.HTTPRouteKey.String("/users/{id}"),
+	)
+	if deletes.Value != 1 {
+		t.Errorf("DELETE count = %d, want 1", deletes.Value)
+	}
+}
+
+func TestErrorEndpointIsInjectedFault(t *testing.T) {
+	h, handler := newTestService(t)
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/error", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+
+	// 注入した障害は fault.* 属性で本物の障害と区別できる
+	server := h.Span(t, "GET")
+	if server.Status.Code != codes.Error {
+		t.Errorf("status = %+v, want Error", server.Status)
+	}
+	if !telemetrytest.Attr(server, faultinject.AttrInjected).AsBool() || telemetrytest.Attr(server, faultinject.AttrRule).AsString() != "error-endpoint" {
+		t.Errorf("attributes = %v, want fault.injected by error-endpoint", server.Attributes)
+	}
+	if telemetrytest.HasEvent(server, "exception") {
+		t.Error("injected fault recorded an exception")
+	}
+}
+
+func TestFaultAdminIsOffByDefault(t *testing.T) {
+	_, handler := newTestService(t)
+
+	// 認証の無い管理 API は -fault-admin を付けたときだけ公開する
+	body := strings.NewReader(`{"name": "all-down", "percentage": 100, "status": 503}`)
+	if w := serve(handler, httptest.NewRequest(http.MethodPost, faultinject.AdminPath, body)); w.Code != http.StatusNotFound {
+		t.Fatalf("POST %s = %d, want 404", faultinject.AdminPath, w.Code)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/livez", nil)); w.Code != http.StatusOK {
+		t.Errorf("livez = %d after the admin request, want 200", w.Code)
+	}
+}
+
+func TestFaultRulesCanBeChangedAtRuntime(t *testing.T) {
+	h, service := newUserService(t, User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+	service.faultAdmin = true
+	handler := service.routes()
+
+	body := strings.NewReader(`{"name": "user-1-down", "route": "GET /users/{id}", "path_values": {"id": "1"}, "percentage": 100, "status": 503}`)
+	if w := serve(handler, httptest.NewRequest(http.MethodPost, faultinject.AdminPath, body)); w.Code != http.StatusCreated {
+		t.Fatalf("POST %s = %d: %s", faultinject.AdminPath, w.Code, w.Body)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 from the new rule", w.Code)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodDelete, faultinject.AdminPath+"/user-1-down", nil)); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after removing the rule", w.Code)
+	}
+
+	var faulted int
+	for _, s := range h.Spans() {
+		if telemetrytest.Attr(s, faultinject.AttrInjected).AsBool() {
+			faulted++
+		}
+	}
+	if faulted != 1 {
+		t.Errorf("%d spans tagged with fault.injected, want 1", faulted)
+	}
+}
+
+func TestOneServerSpanPerRequestNamedByRoute(t *testing.T) {
+	h, handler := newTestService(t, User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+
+	ctx, client := otel.Tracer("test").Start(context.Background(), "client", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	requests := []struct {
+		method, target, body string
+		want                 string
+	}{
+		{http.MethodGet, "/users/1", "", "GET /users/{id}"},
+		{http.MethodGet, "/users?limit=1", "", "GET /users"},
+		{http.MethodPost, "/users", `{"name":"Bob","email":"bob@example.com"}`, "POST /users"},
+		{http.MethodPatch, "/users/2", `{"name":"Robert"}`, "PATCH /users/{id}"},
+		{http.MethodDelete, "/users/2", "", "DELETE /users/{id}"},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+		if w := serve(handler, r); w.Code >= 300 {
+			t.Fatalf("%s %s = %d: %s", req.method, req.target, w.Code, w.Body)
+		}
+	}
+	client.End()
+
+	// ハンドラは otelhttp のサーバースパンを複製せず、属性を足すだけ
+	spans := h.Spans()
+	if len(spans) != len(requests)+1 {
+		t.Fatalf("got %d spans %v, want one server span per request plus the client", len(spans), spans)
+	}
+	for i, req := range requests {
+		server := spans[i]
+		if server.Name != req.want || server.SpanKind != oteltrace.SpanKindServer {
+			t.Errorf("span %d = %s (%v), want server span %q", i, server.Name, server.SpanKind, req.want)
+		}
+		if server.Parent.SpanID() != client.SpanContext().SpanID() {
+			t.Errorf("%s parent = %v, want the client span", server.Name, server.Parent.SpanID())
+		}
+		if got := telemetrytest.Attr(server, semconv.HTTPRouteKey).AsString(); got != httpmetrics.Route(req.want) {
+			t.Errorf("%s http.route = %q", server.Name, got)
+		}
+	}
+	get := h.Span(t, "GET /users/{id}")
+	if telemetrytest.Attr(get, "user.id").AsInt64() != 1 || telemetrytest.Attr(get, serverspan.RowsKey).AsInt64() != 1 {
+		t.Errorf("GET /users/{id} attributes = %v, want user.id and db.rows", get.Attributes)
+	}
+}
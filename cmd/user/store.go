@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// UserStore は users テーブルへのアクセスを抽象化する
+//
+// 見つからない場合は sql.ErrNoRows、メールアドレス重複は errEmailTaken、
+// 投稿から参照されている場合は errUserReferred を返す。
+type UserStore interface {
+	GetUser(ctx context.Context, userID int) (*User, error)
+	ListUsers(ctx context.Context, limit, offset int) (*userList, error)
+	CreateUser(ctx context.Context, in userInput) (*User, error)
+	// UpdateUser は nil のフィールドを現在の値のまま残す（PUT/PATCH 共通）
+	UpdateUser(ctx context.Context, userID int, in userInput) (*User, error)
+	DeleteUser(ctx context.Context, userID int) error
+}
+
+// postgresUserStore は otelsql で計装された *sql.DB を使う UserStore
+type postgresUserStore struct {
+	db *sql.DB
+}
+
+func newPostgresUserStore(db *sql.DB) *postgresUserStore {
+	return &postgresUserStore{db: db}
+}
+
+func (s *postgresUserStore) GetUser(ctx context.Context, userID int) (*User, error) {
+	// SQL操作は otelsql で自動計装されるため、手動スパン不要
+	query := "SELECT id, name, email, created_at FROM users WHERE id = $1"
+	row := s.db.QueryRowContext(ctx, query, userID)
+
+	var user User
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt); err != nil {
+		// 現在のスパンがあればエラーを記録
+		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+			recordError(span, err, "Failed to scan user data")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *postgresUserStore) ListUsers(ctx context.Context, limit, offset int) (*userList, error) {
+	list := &userList{Users: []User{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&list.Total); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, name, email, created_at
+		FROM users
+		ORDER BY id
+		LIMIT $1 OFFSET $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		list.Users = append(list.Users, user)
+	}
+	return list, rows.Err()
+}
+
+func (s *postgresUserStore) CreateUser(ctx context.Context, in userInput) (*User, error) {
+	query := `
+		INSERT INTO users (name, email)
+		VALUES ($1, $2)
+		RETURNING id, name, email, created_at
+	`
+	var user User
+	err := s.db.QueryRowContext(ctx, query, strings.TrimSpace(*in.Name), strings.TrimSpace(*in.Email)).
+		Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+	if err != nil {
+		return nil, pgError(err)
+	}
+	return &user, nil
+}
+
+func (s *postgresUserStore) UpdateUser(ctx context.Context, userID int, in userInput) (*User, error) {
+	query := `
+		UPDATE users
+		SET name = COALESCE($2, name), email = COALESCE($3, email)
+		WHERE id = $1
+		RETURNING id, name, email, created_at
+	`
+	var user User
+	err := s.db.QueryRowContext(ctx, query, userID, nullString(in.Name), nullString(in.Email)).
+		Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+	if err != nil {
+		return nil, pgError(err)
+	}
+	return &user, nil
+}
+
+func (s *postgresUserStore) DeleteUser(ctx context.Context, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return pgError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// pgError は Postgres の制約違反をドメインエラーに変換する
+func pgError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %s", errEmailTaken, pqErr.Detail)
+	case pgForeignKeyViolation:
+		return fmt.Errorf("%w: %s", errUserReferred, pqErr.Detail)
+	}
+	return err
+}
+
+func nullString(p *string) sql.NullString {
+	if p == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.TrimSpace(*p), Valid: true}
+}
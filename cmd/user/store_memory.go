@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUserStore は DB なしで動く UserStore。ハンドラのテストやデモに使う
+type memoryUserStore struct {
+	mu     sync.Mutex
+	users  map[int]User
+	nextID int
+}
+
+// newMemoryUserStore は seed のユーザーを ID そのままで登録する
+func newMemoryUserStore(seed ...User) *memoryUserStore {
+	s := &memoryUserStore{users: map[int]User{}, nextID: 1}
+	for _, u := range seed {
+		if u.CreatedAt == "" {
+			u.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		s.users[u.ID] = u
+		if u.ID >= s.nextID {
+			s.nextID = u.ID + 1
+		}
+	}
+	return s
+}
+
+func (s *memoryUserStore) GetUser(ctx context.Context, userID int) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user, nil
+}
+
+func (s *memoryUserStore) ListUsers(ctx context.Context, limit, offset int) (*userList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	list := &userList{Users: []User{}, Limit: limit, Offset: offset, Total: len(ids)}
+	for i := offset; i < len(ids) && i < offset+limit; i++ {
+		list.Users = append(list.Users, s.users[ids[i]])
+	}
+	return list, nil
+}
+
+func (s *memoryUserStore) CreateUser(ctx context.Context, in userInput) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.TrimSpace(*in.Email)
+	if err := s.checkEmail(0, email); err != nil {
+		return nil, err
+	}
+
+	user := User{
+		ID:        s.nextID,
+		Name:      strings.TrimSpace(*in.Name),
+		Email:     email,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	s.users[user.ID] = user
+	s.nextID++
+	return &user, nil
+}
+
+func (s *memoryUserStore) UpdateUser(ctx context.Context, userID int, in userInput) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if in.Name != nil {
+		user.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Email != nil {
+		email := strings.TrimSpace(*in.Email)
+		if err := s.checkEmail(userID, email); err != nil {
+			return nil, err
+		}
+		user.Email = email
+	}
+	s.users[userID] = user
+	return &user, nil
+}
+
+func (s *memoryUserStore) DeleteUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.users, userID)
+	return nil
+}
+
+// checkEmail は users.email の UNIQUE 制約を再現する
+func (s *memoryUserStore) checkEmail(selfID int, email string) error {
+	for id, u := range s.users {
+		if id != selfID && u.Email == email {
+			return fmt.Errorf("%w: Key (email)=(%s) already exists.", errEmailTaken, email)
+		}
+	}
+	return nil
+}
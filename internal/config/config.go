@@ -0,0 +1,177 @@
+// Package config はフラグ・環境変数・YAML ファイルから各バイナリの設定を読み込むパッケージ
+//
+// 優先順位は 既定値 < YAML ファイル < 環境変数 < コマンドラインフラグ。
+// 環境変数名はフラグ名を大文字にして "-" を "_" に置き換え、他のツールの変数と
+// 衝突しないよう OTELPG_ を付けたもの (例: -listen-addr → OTELPG_LISTEN_ADDR)。
+// YAML のキーはフラグ名と同じ。
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDatabaseDSN is the Postgres DSN used by docker-compose.yml.
+const DefaultDatabaseDSN = "host=localhost port=5432 user=postgres password=otelpass dbname=oteldb sslmode=disable"
+
+// EnvPrefix is prepended to the environment variable of every flag.
+const EnvPrefix = "OTELPG_"
+
+const (
+	configFlag = "config"
+	configEnv  = EnvPrefix + "CONFIG_FILE"
+)
+
+const (
+	originDefault = "default"
+	originFile    = "file"
+	originEnv     = "env"
+	originFlag    = "flag"
+)
+
+// effective remembers where each value came from so it can be printed.
+type effective struct {
+	name   string
+	fs     *flag.FlagSet
+	origin map[string]string
+}
+
+// Print writes the effective configuration and the origin of each value.
+// Secrets inside DSNs are masked.
+func (e *effective) Print(w io.Writer) {
+	if e == nil {
+		return
+	}
+	fmt.Fprintf(w, "⚙️  Effective config (%s):\n", e.name)
+	var names []string
+	e.fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	sort.Strings(names)
+	for _, name := range names {
+		value := e.fs.Lookup(name).Value.String()
+		if strings.Contains(name, "dsn") {
+			value = maskDSN(value)
+		}
+		fmt.Fprintf(w, "  %-24s %-8s %s\n", name, "["+e.origin[name]+"]", value)
+	}
+}
+
+// load は register で定義されたフラグに対して 既定値 → YAML → 環境変数 → フラグ の順に値を適用する
+func load(name string, args []string, register func(fs *flag.FlagSet)) (*effective, error) {
+	// 不明なフラグや不正な値は終了せずにエラーとして返す（使い方は FlagSet が表示する）
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String(configFlag, os.Getenv(configEnv), "path to an optional YAML config file (env "+configEnv+")")
+	register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		// -h のときは flag.ErrHelp を包んで返す。終了コードは各 main が決める
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	e := &effective{name: name, fs: fs, origin: map[string]string{}}
+	fs.VisitAll(func(f *flag.Flag) {
+		e.origin[f.Name] = originDefault
+	})
+	fs.Visit(func(f *flag.Flag) {
+		e.origin[f.Name] = originFlag
+	})
+	if _, ok := os.LookupEnv(configEnv); ok && e.origin[configFlag] == originDefault {
+		e.origin[configFlag] = originEnv
+	}
+
+	if *configPath != "" {
+		values, err := readFile(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			if key == configFlag || fs.Lookup(key) == nil {
+				return nil, fmt.Errorf("config: unknown key %q in %s", key, *configPath)
+			}
+			if err := e.set(key, value, originFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			errs = append(errs, e.set(f.Name, value, originEnv))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// set はコマンドラインで明示された値を上書きしない
+func (e *effective) set(name, value, origin string) error {
+	if e.origin[name] == originFlag {
+		return nil
+	}
+	if err := e.fs.Set(name, value); err != nil {
+		return fmt.Errorf("config: invalid %s value %q from %s: %w", name, value, origin, err)
+	}
+	e.origin[name] = origin
+	return nil
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	values := map[string]string{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+var dsnPassword = regexp.MustCompile(`password=\S+`)
+
+func maskDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password=xxxxx")
+}
+
+func validateListenAddr(name, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("config: %s %q: %w", name, addr, err)
+	}
+	return nil
+}
+
+func validateURL(name, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("config: %s %q: %w", name, raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("config: %s %q must be an absolute http(s) URL", name, raw)
+	}
+	return nil
+}
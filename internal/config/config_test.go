@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeYAML(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadTestService(args ...string) (*Service, error) {
+	return LoadService("test-service", Service{ListenAddr: ":8080", DatabaseDSN: DefaultDatabaseDSN}, args)
+}
+
+func TestPrecedence(t *testing.T) {
+	file := writeYAML(t, "listen-addr: \":7001\"\ndrain-delay: 3s\n")
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		wantAddr   string
+		wantOrigin string
+	}{
+		{"default", nil, nil, ":8080", originDefault},
+		{"file over default", nil, []string{"-config", file}, ":7001", originFile},
+		{"file from OTELPG_CONFIG_FILE", map[string]string{"OTELPG_CONFIG_FILE": file}, nil, ":7001", originFile},
+		{"env over file", map[string]string{"OTELPG_LISTEN_ADDR": ":7002"}, []string{"-config", file}, ":7002", originEnv},
+		{"flag over env", map[string]string{"OTELPG_LISTEN_ADDR": ":7002"}, []string{"-config", file, "-listen-addr", ":7003"}, ":7003", originFlag},
+		// 他のツール向けの接頭辞の無い変数は読まない
+		{"unprefixed env ignored", map[string]string{"LISTEN_ADDR": ":7002"}, nil, ":8080", originDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := loadTestService(tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.ListenAddr != tt.wantAddr || cfg.origin["listen-addr"] != tt.wantOrigin {
+				t.Errorf("listen-addr = %q [%s], want %q [%s]", cfg.ListenAddr, cfg.origin["listen-addr"], tt.wantAddr, tt.wantOrigin)
+			}
+			// ファイルにしか無い値はどの経路でも残る
+			if tt.wantOrigin != originDefault && cfg.DrainDelay != 3*time.Second {
+				t.Errorf("drain-delay = %s, want 3s from the file", cfg.DrainDelay)
+			}
+		})
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{"bad duration flag", nil, []string{"-shutdown-timeout", "soon"}, `invalid value "soon" for flag -shutdown-timeout`},
+		{"bad duration env", map[string]string{"OTELPG_DRAIN_DELAY": "soon"}, nil, `invalid drain-delay value "soon" from env`},
+		{"negative duration", nil, []string{"-drain-delay", "-1s"}, "drain-delay must not be negative"},
+		{"zero timeout", map[string]string{"OTELPG_HEALTH_CHECK_TIMEOUT": "0s"}, nil, "health-check-timeout must be positive"},
+		{"empty dsn", nil, []string{"-database-dsn", ""}, "database-dsn is required"},
+		{"bad listen addr", nil, []string{"-listen-addr", "8080"}, `listen-addr "8080"`},
+		{"unknown flag", nil, []string{"-no-such-flag"}, "flag provided but not defined: -no-such-flag"},
+		{"unknown file key", nil, []string{"-config", writeYAML(t, "no-such-key: 1\n")}, `unknown key "no-such-key"`},
+		{"missing file", nil, []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := loadTestService(tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHelpIsReturned(t *testing.T) {
+	// 終了するかどうかは呼び出し側が決める
+	if _, err := loadTestService("-h"); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("err = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestValidationReportsEveryField(t *testing.T) {
+	_, err := LoadOrchestrator([]string{
+		"-user-service-url", "localhost:8080",
+		"-retry-max-attempts", "0",
+		"-orchestration-mode", "random",
+	})
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, want := range []string{"user-service-url", "retry-max-attempts must be at least 1", `orchestration-mode must be "sequential" or "parallel"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestPrintMasksDSN(t *testing.T) {
+	cfg, err := loadTestService("-database-dsn", "postgres://app:secret@db:5432/oteldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cfg.Print(&buf)
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "[flag]") {
+		t.Errorf("output = %s", buf.String())
+	}
+	if got := maskDSN(DefaultDatabaseDSN); strings.Contains(got, "otelpass") {
+		t.Errorf("maskDSN = %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// FakeAPI is the configuration of cmd/fakeapi, the local stand-in for
+// JSONPlaceholder.
+type FakeAPI struct {
+	*effective
+	Lifecycle
+
+	ListenAddr string
+
+	// 応答ごとに Latency ± LatencyJitter だけ待つ
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// ErrorRate の割合のリクエストに ErrorStatus を返す
+	ErrorRate   float64
+	ErrorStatus int
+
+	// PayloadsFile は /posts の JSON 配列。空なら Posts 件を生成する
+	PayloadsFile string
+	Posts        int
+}
+
+// DefaultFakeAPI serves 100 generated posts on :8084 with no latency or errors.
+func DefaultFakeAPI() FakeAPI {
+	return FakeAPI{
+		Lifecycle:   DefaultLifecycle(),
+		ListenAddr:  ":8084",
+		ErrorStatus: 503,
+		Posts:       100,
+	}
+}
+
+func (c *FakeAPI) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.ListenAddr, "listen-addr", c.ListenAddr, "HTTP listen address")
+	c.Lifecycle.register(fs)
+	fs.DurationVar(&c.Latency, "latency", c.Latency, "delay added to every response")
+	fs.DurationVar(&c.LatencyJitter, "latency-jitter", c.LatencyJitter, "random +/- spread around -latency")
+	fs.Float64Var(&c.ErrorRate, "error-rate", c.ErrorRate, "fraction of requests (0-1) answered with -error-status")
+	fs.IntVar(&c.ErrorStatus, "error-status", c.ErrorStatus, "status code of injected errors")
+	fs.StringVar(&c.PayloadsFile, "payloads-file", c.PayloadsFile, "JSON array of posts to serve instead of generated ones")
+	fs.IntVar(&c.Posts, "posts", c.Posts, "number of posts to generate when -payloads-file is empty")
+}
+
+// Validate reports every invalid field at once.
+func (c *FakeAPI) Validate() error {
+	var errs []error
+	errs = append(errs, validateListenAddr("listen-addr", c.ListenAddr), c.Lifecycle.validate())
+	if c.Latency < 0 || c.LatencyJitter < 0 {
+		errs = append(errs, fmt.Errorf("config: latency %s and latency-jitter %s must not be negative", c.Latency, c.LatencyJitter))
+	}
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		errs = append(errs, fmt.Errorf("config: error-rate must be between 0 and 1, got %g", c.ErrorRate))
+	}
+	if c.ErrorStatus < 400 || c.ErrorStatus > 599 {
+		errs = append(errs, fmt.Errorf("config: error-status must be a 4xx or 5xx code, got %d", c.ErrorStatus))
+	}
+	if c.PayloadsFile == "" && c.Posts < 1 {
+		errs = append(errs, errors.New("config: posts must be at least 1 when payloads-file is empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadFakeAPI loads the fakeapi config on top of DefaultFakeAPI.
+func LoadFakeAPI(args []string) (*FakeAPI, error) {
+	cfg := DefaultFakeAPI()
+	e, err := load("fakeapi", args, cfg.register)
+	if err != nil {
+		return nil, err
+	}
+	cfg.effective = e
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
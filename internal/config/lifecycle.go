@@ -0,0 +1,51 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Lifecycle controls the health probes of a server and how it shuts down
+// on SIGINT/SIGTERM. It is embedded in the config of every binary that
+// serves HTTP.
+type Lifecycle struct {
+	// DrainDelay は readiness を落としてからリスナーを閉じるまで待つ時間
+	DrainDelay time.Duration
+	// ShutdownTimeout は処理中のリクエストの完了を待つ上限
+	ShutdownTimeout time.Duration
+	// HealthCheckTimeout は /readyz の各コンポーネントのチェックにかける上限
+	HealthCheckTimeout time.Duration
+	// TraceHealthChecks が false の間はプローブとチェック中のスパンを記録しない
+	TraceHealthChecks bool
+}
+
+// DefaultLifecycle keeps serving for 2s after readiness flips, gives
+// in-flight requests 10s to finish and bounds each readiness check to 1s.
+func DefaultLifecycle() Lifecycle {
+	return Lifecycle{
+		DrainDelay:         2 * time.Second,
+		ShutdownTimeout:    10 * time.Second,
+		HealthCheckTimeout: time.Second,
+	}
+}
+
+func (c *Lifecycle) register(fs *flag.FlagSet) {
+	fs.DurationVar(&c.DrainDelay, "drain-delay", c.DrainDelay, "time to keep serving after readiness turns false on shutdown")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "upper bound for in-flight requests to finish on shutdown")
+	fs.DurationVar(&c.HealthCheckTimeout, "health-check-timeout", c.HealthCheckTimeout, "upper bound for each dependency check behind /readyz")
+	fs.BoolVar(&c.TraceHealthChecks, "trace-health-checks", c.TraceHealthChecks, "record spans for /livez, /readyz and /health and the checks behind them")
+}
+
+func (c *Lifecycle) validate() error {
+	if c.DrainDelay < 0 {
+		return fmt.Errorf("config: drain-delay must not be negative, got %s", c.DrainDelay)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("config: shutdown-timeout must be positive, got %s", c.ShutdownTimeout)
+	}
+	if c.HealthCheckTimeout <= 0 {
+		return fmt.Errorf("config: health-check-timeout must be positive, got %s", c.HealthCheckTimeout)
+	}
+	return nil
+}
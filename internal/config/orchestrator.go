@@ -0,0 +1,166 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Orchestrator is the configuration of the orchestrator binary.
+type Orchestrator struct {
+	*effective
+	Lifecycle
+
+	UserServiceURL      string
+	PostServiceURL      string
+	CommentServiceURL   string
+	ExternalAPIURL      string
+	CollectorMetricsURL string
+	PrometheusURL       string
+	JaegerURL           string
+
+	// 下流サービス呼び出しのリトライ設定
+	RetryMaxAttempts    int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+
+	// 接続先ごとのサーキットブレーカー設定
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+
+	// OrchestrationMode は独立した下流呼び出しを sequential か parallel で行うか
+	OrchestrationMode string
+	MaxConcurrency    int
+
+	// Serve が true なら一度きりのデモではなく ListenAddr で集約 API を提供する
+	Serve      bool
+	ListenAddr string
+}
+
+// DefaultExternalAPIURL is cmd/fakeapi on its default port, so the demo
+// never calls the internet unless -external-api-url is set, e.g. to the
+// public JSONPlaceholder API at https://jsonplaceholder.typicode.com.
+const DefaultExternalAPIURL = "http://localhost:8084"
+
+// Orchestration modes accepted by -orchestration-mode.
+const (
+	ModeSequential = "sequential"
+	ModeParallel   = "parallel"
+)
+
+// DefaultOrchestrator matches the ports published by docker-compose.yml and the Makefile.
+func DefaultOrchestrator() Orchestrator {
+	return Orchestrator{
+		UserServiceURL:      "http://localhost:8080",
+		PostServiceURL:      "http://localhost:8081",
+		CommentServiceURL:   "http://localhost:8082",
+		ExternalAPIURL:      DefaultExternalAPIURL,
+		CollectorMetricsURL: "http://localhost:8889/metrics",
+		PrometheusURL:       "http://localhost:9090",
+		JaegerURL:           "http://localhost:16686",
+		RetryMaxAttempts:    3,
+		RetryInitialBackoff: 100 * time.Millisecond,
+		RetryMaxBackoff:     2 * time.Second,
+
+		BreakerFailureThreshold: 5,
+		BreakerOpenTimeout:      10 * time.Second,
+
+		OrchestrationMode: ModeParallel,
+		MaxConcurrency:    4,
+
+		ListenAddr: ":8083",
+		Lifecycle:  DefaultLifecycle(),
+	}
+}
+
+func (c *Orchestrator) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.UserServiceURL, "user-service-url", c.UserServiceURL, "base URL of user-service")
+	fs.StringVar(&c.PostServiceURL, "post-service-url", c.PostServiceURL, "base URL of post-service")
+	fs.StringVar(&c.CommentServiceURL, "comment-service-url", c.CommentServiceURL, "base URL of comment-service")
+	fs.StringVar(&c.ExternalAPIURL, "external-api-url", c.ExternalAPIURL, "base URL of the JSONPlaceholder-compatible external API (default: cmd/fakeapi)")
+	fs.StringVar(&c.CollectorMetricsURL, "collector-metrics-url", c.CollectorMetricsURL, "Prometheus exporter endpoint of the OTEL Collector")
+	fs.StringVar(&c.PrometheusURL, "prometheus-url", c.PrometheusURL, "base URL of Prometheus")
+	fs.StringVar(&c.JaegerURL, "jaeger-url", c.JaegerURL, "base URL of the Jaeger UI/query API")
+	fs.IntVar(&c.RetryMaxAttempts, "retry-max-attempts", c.RetryMaxAttempts, "attempts per downstream call including the first (1 disables retries)")
+	fs.DurationVar(&c.RetryInitialBackoff, "retry-initial-backoff", c.RetryInitialBackoff, "delay before the first retry; doubles on every retry")
+	fs.DurationVar(&c.RetryMaxBackoff, "retry-max-backoff", c.RetryMaxBackoff, "upper bound of the retry delay, including one asked for by Retry-After")
+	fs.IntVar(&c.BreakerFailureThreshold, "breaker-failure-threshold", c.BreakerFailureThreshold, "consecutive 5xx/transport failures that open a downstream's circuit")
+	fs.DurationVar(&c.BreakerOpenTimeout, "breaker-open-timeout", c.BreakerOpenTimeout, "how long an open circuit rejects requests before a half-open probe")
+	fs.StringVar(&c.OrchestrationMode, "orchestration-mode", c.OrchestrationMode, "issue independent downstream calls \"sequential\" or \"parallel\"")
+	fs.IntVar(&c.MaxConcurrency, "max-concurrency", c.MaxConcurrency, "upper bound of concurrent downstream calls in parallel mode")
+	fs.BoolVar(&c.Serve, "serve", c.Serve, "run as a long-lived HTTP aggregation API instead of the one-shot demo")
+	fs.StringVar(&c.ListenAddr, "listen-addr", c.ListenAddr, "address the aggregation API listens on (with -serve)")
+	c.Lifecycle.register(fs)
+}
+
+// Validate reports every invalid field at once.
+func (c *Orchestrator) Validate() error {
+	return errors.Join(
+		validateURL("user-service-url", c.UserServiceURL),
+		validateURL("post-service-url", c.PostServiceURL),
+		validateURL("comment-service-url", c.CommentServiceURL),
+		validateURL("external-api-url", c.ExternalAPIURL),
+		validateURL("collector-metrics-url", c.CollectorMetricsURL),
+		validateURL("prometheus-url", c.PrometheusURL),
+		validateURL("jaeger-url", c.JaegerURL),
+		c.validateRetry(),
+		c.validateBreaker(),
+		c.validateOrchestration(),
+		validateListenAddr("listen-addr", c.ListenAddr),
+		c.Lifecycle.validate(),
+	)
+}
+
+func (c *Orchestrator) validateRetry() error {
+	if c.RetryMaxAttempts < 1 {
+		return fmt.Errorf("config: retry-max-attempts must be at least 1, got %d", c.RetryMaxAttempts)
+	}
+	if c.RetryInitialBackoff <= 0 || c.RetryMaxBackoff < c.RetryInitialBackoff {
+		return fmt.Errorf("config: retry-initial-backoff %s and retry-max-backoff %s must satisfy 0 < initial <= max", c.RetryInitialBackoff, c.RetryMaxBackoff)
+	}
+	return nil
+}
+
+func (c *Orchestrator) validateBreaker() error {
+	if c.BreakerFailureThreshold < 1 {
+		return fmt.Errorf("config: breaker-failure-threshold must be at least 1, got %d", c.BreakerFailureThreshold)
+	}
+	if c.BreakerOpenTimeout <= 0 {
+		return fmt.Errorf("config: breaker-open-timeout must be positive, got %s", c.BreakerOpenTimeout)
+	}
+	return nil
+}
+
+func (c *Orchestrator) validateOrchestration() error {
+	if c.OrchestrationMode != ModeSequential && c.OrchestrationMode != ModeParallel {
+		return fmt.Errorf("config: orchestration-mode must be %q or %q, got %q", ModeSequential, ModeParallel, c.OrchestrationMode)
+	}
+	if c.MaxConcurrency < 1 {
+		return fmt.Errorf("config: max-concurrency must be at least 1, got %d", c.MaxConcurrency)
+	}
+	return nil
+}
+
+// Concurrency returns the fan-out limit implied by the mode (1 when sequential).
+func (c *Orchestrator) Concurrency() int {
+	if c.OrchestrationMode == ModeSequential {
+		return 1
+	}
+	return c.MaxConcurrency
+}
+
+// LoadOrchestrator loads the orchestrator config on top of DefaultOrchestrator.
+func LoadOrchestrator(args []string) (*Orchestrator, error) {
+	cfg := DefaultOrchestrator()
+	e, err := load("orchestrator", args, cfg.register)
+	if err != nil {
+		return nil, err
+	}
+	cfg.effective = e
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// OtelCheck is the configuration of cmd/otelcheck, the CLI that generates
+// traffic and verifies histograms, exemplars, metric→trace links and
+// cross-service trace propagation.
+type OtelCheck struct {
+	*effective
+
+	UserServiceURL      string
+	OrchestratorURL     string
+	CollectorMetricsURL string
+	PrometheusURL       string
+	JaegerURL           string
+
+	// Timeout は 1 回の HTTP リクエストの上限
+	Timeout time.Duration
+	// Wait はトラフィック生成後、メトリクスが収集・スクレイプされるまで待つ時間
+	Wait time.Duration
+
+	// HistogramMetric は histogram サブコマンドがバケットを確認するメトリクス
+	HistogramMetric string
+	// ExemplarQuery は Prometheus の query_exemplars に渡す PromQL
+	ExemplarQuery string
+}
+
+// DefaultOtelCheck matches the ports published by docker-compose.yml, the
+// orchestrator's -serve listen address and the views registered by
+// user-service.
+func DefaultOtelCheck() OtelCheck {
+	return OtelCheck{
+		UserServiceURL:      "http://localhost:8080",
+		OrchestratorURL:     "http://localhost:8083",
+		CollectorMetricsURL: "http://localhost:8889/metrics",
+		PrometheusURL:       "http://localhost:9090",
+		JaegerURL:           "http://localhost:16686",
+		Timeout:             10 * time.Second,
+		Wait:                10 * time.Second,
+		HistogramMetric:     "user_service_response_time_custom",
+		ExemplarQuery:       "microservices_user_service_requests_total",
+	}
+}
+
+func (c *OtelCheck) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.UserServiceURL, "user-service-url", c.UserServiceURL, "base URL of user-service")
+	fs.StringVar(&c.OrchestratorURL, "orchestrator-url", c.OrchestratorURL, "base URL of the orchestrator aggregation API (go run . -serve)")
+	fs.StringVar(&c.CollectorMetricsURL, "collector-metrics-url", c.CollectorMetricsURL, "Prometheus exporter endpoint of the OTEL Collector")
+	fs.StringVar(&c.PrometheusURL, "prometheus-url", c.PrometheusURL, "base URL of Prometheus")
+	fs.StringVar(&c.JaegerURL, "jaeger-url", c.JaegerURL, "base URL of the Jaeger UI/query API")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "timeout of every HTTP request")
+	fs.DurationVar(&c.Wait, "wait", c.Wait, "time to wait after generating traffic for metrics to be exported and scraped")
+	fs.StringVar(&c.HistogramMetric, "histogram-metric", c.HistogramMetric, "histogram whose buckets the histogram command looks for in the collector output")
+	fs.StringVar(&c.ExemplarQuery, "exemplar-query", c.ExemplarQuery, "PromQL passed to Prometheus' query_exemplars API")
+}
+
+// Validate reports every invalid field at once.
+func (c *OtelCheck) Validate() error {
+	errs := []error{
+		validateURL("user-service-url", c.UserServiceURL),
+		validateURL("orchestrator-url", c.OrchestratorURL),
+		validateURL("collector-metrics-url", c.CollectorMetricsURL),
+		validateURL("prometheus-url", c.PrometheusURL),
+		validateURL("jaeger-url", c.JaegerURL),
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("config: timeout must be positive, got %s", c.Timeout))
+	}
+	if c.Wait < 0 {
+		errs = append(errs, fmt.Errorf("config: wait must not be negative, got %s", c.Wait))
+	}
+	if c.HistogramMetric == "" {
+		errs = append(errs, errors.New("config: histogram-metric is required"))
+	}
+	if c.ExemplarQuery == "" {
+		errs = append(errs, errors.New("config: exemplar-query is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadOtelCheck loads the config of one otelcheck subcommand on top of
+// DefaultOtelCheck. Every subcommand accepts the same flags.
+func LoadOtelCheck(command string, args []string) (*OtelCheck, error) {
+	cfg := DefaultOtelCheck()
+	e, err := load("otelcheck "+command, args, cfg.register)
+	if err != nil {
+		return nil, err
+	}
+	cfg.effective = e
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
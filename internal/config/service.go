@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"flag"
+)
+
+// Service is the configuration shared by the database backed services.
+type Service struct {
+	*effective
+	Lifecycle
+
+	ListenAddr  string
+	DatabaseDSN string
+
+	// FaultRulesFile は起動時に読み込む障害注入ルール（JSON）。空ならルールなし
+	FaultRulesFile string
+	// FaultAdmin は障害注入ルールを変更する /admin/faults を公開するか。
+	// 認証が無く同じポートで受けるので、信頼できるネットワークでだけ有効にする
+	FaultAdmin bool
+}
+
+func (c *Service) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.ListenAddr, "listen-addr", c.ListenAddr, "HTTP listen address")
+	fs.StringVar(&c.DatabaseDSN, "database-dsn", c.DatabaseDSN, "Postgres DSN")
+	c.Lifecycle.register(fs)
+	fs.StringVar(&c.FaultRulesFile, "fault-rules-file", c.FaultRulesFile, "JSON file with the initial fault-injection rules (empty disables)")
+	fs.BoolVar(&c.FaultAdmin, "fault-admin", c.FaultAdmin, "serve the unauthenticated fault-injection admin API on the listen address")
+}
+
+// Validate reports every invalid field at once.
+func (c *Service) Validate() error {
+	var errs []error
+	errs = append(errs, validateListenAddr("listen-addr", c.ListenAddr), c.Lifecycle.validate())
+	if c.DatabaseDSN == "" {
+		errs = append(errs, errors.New("config: database-dsn is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadService loads a Service config for the named binary, starting from
+// defaults. A zero Lifecycle in defaults means DefaultLifecycle.
+func LoadService(name string, defaults Service, args []string) (*Service, error) {
+	cfg := defaults
+	if cfg.Lifecycle == (Lifecycle{}) {
+		cfg.Lifecycle = DefaultLifecycle()
+	}
+	e, err := load(name, args, cfg.register)
+	if err != nil {
+		return nil, err
+	}
+	cfg.effective = e
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
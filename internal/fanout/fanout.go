@@ -0,0 +1,107 @@
+// Package fanout は独立した処理を並行に実行する errgroup 風のヘルパーを提供するパッケージ
+//
+// 同時実行数の上限、最初のエラーでの残りのキャンセル、処理ごとの子スパンを備える。
+// 上限を 1 にすると Go の呼び出し順にその場で実行する（逐次モード）ため、
+// Jaeger で並行・逐次のウォーターフォールを比較できる。
+package fanout
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "otel-playground/internal/fanout"
+
+// Group runs named branches with at most limit in flight. The zero value is
+// not usable; create one with WithContext.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	sem    chan struct{} // nil なら逐次モード
+	tracer oteltrace.Tracer
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// WithContext returns a Group whose branches run under ctx, and the derived
+// context that is canceled as soon as a branch fails. A limit of 1 (or less)
+// runs every branch inline, in the order Go is called.
+func WithContext(ctx context.Context, limit int) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	g := &Group{
+		ctx:    ctx,
+		cancel: cancel,
+		tracer: otel.Tracer(instrumentationName),
+	}
+	if limit > 1 {
+		g.sem = make(chan struct{}, limit)
+	}
+	return g, ctx
+}
+
+// Sequential reports whether branches run inline.
+func (g *Group) Sequential() bool { return g.sem == nil }
+
+// Go runs fn in a child span called name. Branches that have not started
+// when another branch fails or the parent context is done are skipped.
+func (g *Group) Go(name string, fn func(ctx context.Context) error, attrs ...attribute.KeyValue) {
+	if g.Sequential() {
+		g.run(name, fn, attrs)
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		// 空きを待つ間にキャンセルされたら実行しない
+		select {
+		case g.sem <- struct{}{}:
+			defer func() { <-g.sem }()
+		case <-g.ctx.Done():
+			return
+		}
+		g.run(name, fn, attrs)
+	}()
+}
+
+// Wait blocks until every started branch returns and reports the first
+// error. If no branch failed but the parent context is done, branches may
+// have been skipped, so it returns the parent's cause instead: a canceled
+// group never looks like a successful one.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	// 処理のエラー以外で ctx が終わっているなら親のキャンセルか期限切れ。
+	// 自分の cancel(nil) の後では原因が context.Canceled になるので先に読む
+	cause := context.Cause(g.ctx)
+	g.cancel(nil)
+	if g.err == nil && cause != nil {
+		return cause
+	}
+	return g.err
+}
+
+func (g *Group) run(name string, fn func(ctx context.Context) error, attrs []attribute.KeyValue) {
+	if g.ctx.Err() != nil {
+		return
+	}
+
+	ctx, span := g.tracer.Start(g.ctx, name, oteltrace.WithAttributes(attrs...))
+	defer span.End()
+
+	if err := fn(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		g.errOnce.Do(func() {
+			g.err = err
+			g.cancel(err)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+func TestGroupBoundsConcurrency(t *testing.T) {
+	telemetrytest.New(t)
+	g, _ := WithContext(context.Background(), 2)
+
+	var inFlight, peak atomic.Int32
+	for range 6 {
+		g.Go("branch", func(ctx context.Context) error {
+			n := inFlight.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			inFlight.Add(-1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak.Load())
+	}
+}
+
+func TestGroupCancelsOnFirstError(t *testing.T) {
+	h := telemetrytest.New(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "orchestrate")
+	g, _ := WithContext(ctx, 4)
+
+	boom := errors.New("boom")
+	var canceled atomic.Bool
+	started := make(chan struct{})
+	g.Go("slow", func(ctx context.Context) error {
+		close(started)
+		select {
+		case <-ctx.Done():
+			canceled.Store(true)
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	// slow が始まる前に失敗すると slow はスキップされるので、開始を待ってから失敗させる
+	g.Go("failing", func(ctx context.Context) error {
+		<-started
+		return boom
+	})
+
+	if err := g.Wait(); !errors.Is(err, boom) {
+		t.Fatalf("Wait = %v, want boom", err)
+	}
+	parent.End()
+	if !canceled.Load() {
+		t.Error("slow branch was not canceled")
+	}
+
+	// 各ブランチは親スパンの子で、失敗したものはエラーになる
+	failing := h.Span(t, "failing")
+	if failing.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("branch parent = %v, want %v", failing.Parent.SpanID(), parent.SpanContext().SpanID())
+	}
+	if failing.Status.Code != codes.Error {
+		t.Errorf("failing status = %+v, want Error", failing.Status)
+	}
+	if h.Span(t, "slow").Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("slow branch is not a child of the parent span")
+	}
+}
+
+func TestSequentialRunsInOrderAndStopsAfterError(t *testing.T) {
+	h := telemetrytest.New(t)
+	g, _ := WithContext(context.Background(), 1)
+	if !g.Sequential() {
+		t.Fatal("limit 1 should be sequential")
+	}
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return err
+		}
+	}
+	g.Go("a", record("a", nil))
+	g.Go("b", record("b", errors.New("b failed")))
+	g.Go("c", record("c", nil))
+
+	if err := g.Wait(); err == nil {
+		t.Fatal("Wait = nil, want b's error")
+	}
+	if len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Errorf("order = %v, want [a b]", order)
+	}
+	if spans := h.Spans(); len(spans) != 2 {
+		t.Errorf("got %d spans, want 2 (c skipped)", len(spans))
+	}
+}
+
+func TestCanceledParentSkipsBranchesAndFailsWait(t *testing.T) {
+	for _, limit := range []int{1, 4} {
+		h := telemetrytest.New(t)
+		parent, cancel := context.WithCancelCause(context.Background())
+		shutdown := errors.New("shutting down")
+		cancel(shutdown)
+
+		g, _ := WithContext(parent, limit)
+		var ran atomic.Int32
+		for range 3 {
+			g.Go("branch", func(ctx context.Context) error {
+				ran.Add(1)
+				return nil
+			})
+		}
+
+		// 何も実行しなかったグループを成功として扱わない
+		if err := g.Wait(); !errors.Is(err, shutdown) {
+			t.Errorf("limit %d: Wait() = %v, want the parent's cause", limit, err)
+		}
+		if ran.Load() != 0 || len(h.Spans()) != 0 {
+			t.Errorf("limit %d: %d branches ran and %d spans were recorded, want none", limit, ran.Load(), len(h.Spans()))
+		}
+	}
+}
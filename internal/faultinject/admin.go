@@ -0,0 +1,89 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Register mounts the admin API on mux:
+//
+//	GET    /admin/faults         list the active rules
+//	PUT    /admin/faults         replace every rule (JSON array)
+//	POST   /admin/faults         append one rule (JSON object)
+//	DELETE /admin/faults         remove every rule
+//	DELETE /admin/faults/{name}  remove one rule
+func (in *Injector) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+AdminPath, in.listHandler)
+	mux.HandleFunc("PUT "+AdminPath, in.replaceHandler)
+	mux.HandleFunc("POST "+AdminPath, in.appendHandler)
+	mux.HandleFunc("DELETE "+AdminPath, in.clearHandler)
+	mux.HandleFunc("DELETE "+AdminPath+"/{name}", in.deleteHandler)
+}
+
+func (in *Injector) listHandler(w http.ResponseWriter, r *http.Request) {
+	writeRules(w, http.StatusOK, in.Rules())
+}
+
+func (in *Injector) replaceHandler(w http.ResponseWriter, r *http.Request) {
+	var rules []Rule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.respond(w, http.StatusOK, func([]Rule) ([]Rule, error) { return rules, nil })
+}
+
+func (in *Injector) appendHandler(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.respond(w, http.StatusCreated, func(current []Rule) ([]Rule, error) {
+		return append(current, rule), nil
+	})
+}
+
+func (in *Injector) clearHandler(w http.ResponseWriter, r *http.Request) {
+	in.respond(w, http.StatusOK, func([]Rule) ([]Rule, error) { return nil, nil })
+}
+
+func (in *Injector) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	in.respond(w, http.StatusOK, func(current []Rule) ([]Rule, error) {
+		i := slices.IndexFunc(current, func(rule Rule) bool { return rule.Name == name })
+		if i < 0 {
+			return nil, errNotFound(name)
+		}
+		return slices.Delete(current, i, i+1), nil
+	})
+}
+
+// respond はルールを更新し、更新後のルールか 400/404 を返す
+func (in *Injector) respond(w http.ResponseWriter, status int, fn func([]Rule) ([]Rule, error)) {
+	rules, err := in.update(fn)
+	if err != nil {
+		code := http.StatusBadRequest
+		if _, ok := err.(errNotFound); ok {
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	writeRules(w, status, rules)
+}
+
+type errNotFound string
+
+func (e errNotFound) Error() string { return fmt.Sprintf("faultinject: no rule named %q", string(e)) }
+
+func writeRules(w http.ResponseWriter, status int, rules []Rule) {
+	if rules == nil {
+		rules = []Rule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rules)
+}
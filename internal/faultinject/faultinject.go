@@ -0,0 +1,205 @@
+// Package faultinject はルールに基づいて遅延・エラー・切断を注入する HTTP ミドルウェアを提供するパッケージ
+//
+// ルールはルート・ヘッダー・クエリで対象を絞り、一致したリクエストの一定割合に
+// 障害を注入する。注入した障害はサーバースパンに fault.* 属性として記録されるので、
+// 本物の障害と Jaeger 上で区別できる。ルールは管理エンドポイントから実行中に差し替えられる。
+package faultinject
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "otel-playground/internal/faultinject"
+
+// AdminPath is where Register mounts the admin API. Requests under it are
+// never faulted, so a catch-all rule cannot lock the admin out.
+const AdminPath = "/admin/faults"
+
+// Span attributes recorded on injected faults.
+const (
+	AttrInjected  = attribute.Key("fault.injected")
+	AttrRule      = attribute.Key("fault.rule")
+	AttrType      = attribute.Key("fault.type")
+	AttrLatencyMS = attribute.Key("fault.latency_ms")
+	AttrStatus    = attribute.Key("fault.status")
+)
+
+// Injector holds the active rules. It is safe for concurrent use.
+type Injector struct {
+	mu    sync.RWMutex
+	rules []*compiledRule
+
+	injections metric.Int64Counter
+	// roll は 0 以上 100 未満の乱数を返す。テストで差し替える
+	roll func() float64
+}
+
+// New returns an Injector with the given rules.
+func New(rules ...Rule) (*Injector, error) {
+	injections, err := otel.Meter(instrumentationName).Int64Counter(
+		"fault_injections_total",
+		metric.WithDescription("Number of requests that received an injected fault"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &Injector{
+		injections: injections,
+		roll:       func() float64 { return rand.Float64() * 100 },
+	}
+	if err := in.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// Rules returns a copy of the active rules in evaluation order.
+func (in *Injector) Rules() []Rule {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	rules := make([]Rule, len(in.rules))
+	for i, c := range in.rules {
+		rules[i] = c.Rule
+	}
+	return rules
+}
+
+// SetRules validates rules and replaces the active ones atomically.
+func (in *Injector) SetRules(rules []Rule) error {
+	_, err := in.update(func([]Rule) ([]Rule, error) { return rules, nil })
+	return err
+}
+
+// update は現在のルールから新しいルールを作って差し替える。管理 API の追加・削除が競合しないよう書き込みロック中に行う
+func (in *Injector) update(fn func(current []Rule) ([]Rule, error)) ([]Rule, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	current := make([]Rule, len(in.rules))
+	for i, c := range in.rules {
+		current[i] = c.Rule
+	}
+	rules, err := fn(current)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	in.rules = compiled
+	return rules, nil
+}
+
+// Middleware injects the fault of the first rule that matches the request
+// and wins its percentage roll. Wrap it inside otelhttp so the server span
+// is in the request context.
+func (in *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, AdminPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule := in.pick(r)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		var delay time.Duration
+		if rule.Latency != nil {
+			delay = rule.Latency.sample()
+		}
+		in.record(ctx, rule, delay)
+		if delay > 0 && !sleep(ctx, delay) {
+			return
+		}
+
+		switch {
+		case rule.Drop:
+			// サーバーはレスポンスを書かずに接続を閉じる
+			panic(http.ErrAbortHandler)
+		case rule.Status != 0:
+			http.Error(w, "injected fault: "+rule.Name, rule.Status)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (in *Injector) pick(r *http.Request) *compiledRule {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	for _, rule := range in.rules {
+		if rule.match(r) && in.roll() < rule.Percentage {
+			return rule
+		}
+	}
+	return nil
+}
+
+// record は注入内容をサーバースパンとメトリクスに残す
+func (in *Injector) record(ctx context.Context, rule *compiledRule, delay time.Duration) {
+	attrs := []attribute.KeyValue{
+		AttrInjected.Bool(true),
+		AttrRule.String(rule.Name),
+		AttrType.String(faultType(rule)),
+	}
+	if rule.Latency != nil {
+		attrs = append(attrs, AttrLatencyMS.Int64(delay.Milliseconds()))
+	}
+	if rule.Status != 0 {
+		attrs = append(attrs, AttrStatus.Int(rule.Status))
+	}
+
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs...)
+	span.AddEvent("fault.injected", oteltrace.WithAttributes(attrs[1:]...))
+
+	in.injections.Add(ctx, 1, metric.WithAttributes(
+		AttrRule.String(rule.Name),
+		AttrType.String(faultType(rule)),
+	))
+}
+
+// faultType は "latency", "status_503", "drop", "latency+status_503" のような値を返す
+func faultType(rule *compiledRule) string {
+	var parts []string
+	if rule.Latency != nil {
+		parts = append(parts, "latency")
+	}
+	if rule.Status != 0 {
+		parts = append(parts, "status_"+strconv.Itoa(rule.Status))
+	}
+	if rule.Drop {
+		parts = append(parts, "drop")
+	}
+	return strings.Join(parts, "+")
+}
+
+// sleep は d だけ待つ。クライアントが切断したら false を返す
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,253 @@
+package faultinject
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// newTestServer は本番と同じく mux → Middleware → otelhttp の順でラップしたハンドラーを返す
+func newTestServer(t *testing.T, rules ...Rule) (*Injector, http.Handler) {
+	t.Helper()
+
+	in, err := New(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+r.PathValue("id"))
+	})
+	in.Register(mux)
+	return in, otelhttp.NewHandler(in.Middleware(mux), "server")
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRuleMatching(t *testing.T) {
+	rule := Rule{
+		Name:       "slow-vip",
+		Route:      "GET /users/{id}",
+		PathValues: map[string]string{"id": "1(0[0-9]|10)"},
+		Query:      map[string]string{"debug": "1|true"},
+		Headers:    map[string]string{"X-Tenant": "vip"},
+		Percentage: 100,
+		Status:     http.StatusTeapot,
+	}
+	compiled, err := compile([]Rule{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, target, tenant string
+		want                   bool
+	}{
+		{"GET", "/users/105?debug=1", "vip", true},
+		{"GET", "/users/110?debug=true", "vip", true},
+		{"GET", "/users/111?debug=1", "vip", false},
+		{"GET", "/users/1050?debug=1", "vip", false},
+		{"GET", "/users/105", "vip", false},
+		{"GET", "/users/105?debug=1", "free", false},
+		{"POST", "/users/105?debug=1", "vip", false},
+		{"GET", "/posts/105?debug=1", "vip", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.Header.Set("X-Tenant", tt.tenant)
+		if got := compiled[0].match(r); got != tt.want {
+			t.Errorf("%s %s (tenant %s) matched = %v, want %v", tt.method, tt.target, tt.tenant, got, tt.want)
+		}
+		if r.Pattern != "" {
+			t.Errorf("match wrote pattern %q onto the request", r.Pattern)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	latency := &Latency{Distribution: DistributionFixed, Mean: Duration(time.Second)}
+	tests := map[string]Rule{
+		"no name":        {Percentage: 100, Status: 500},
+		"zero percent":   {Name: "r", Status: 500},
+		"no fault":       {Name: "r", Percentage: 100},
+		"bad route":      {Name: "r", Route: "GET /{", Percentage: 100, Status: 500},
+		"bad regexp":     {Name: "r", Query: map[string]string{"id": "("}, Percentage: 100, Status: 500},
+		"status + drop":  {Name: "r", Percentage: 100, Status: 500, Drop: true},
+		"unknown dist":   {Name: "r", Percentage: 100, Latency: &Latency{Distribution: "pareto"}},
+		"empty uniform":  {Name: "r", Percentage: 100, Latency: &Latency{Distribution: DistributionUniform, Min: Duration(time.Second)}},
+		"invalid status": {Name: "r", Percentage: 100, Status: 42, Latency: latency},
+	}
+	for name, rule := range tests {
+		if _, err := compile([]Rule{rule}); err == nil {
+			t.Errorf("%s: compile succeeded", name)
+		}
+	}
+	if _, err := compile([]Rule{{Name: "r", Percentage: 100, Drop: true}, {Name: "r", Percentage: 100, Drop: true}}); err == nil {
+		t.Error("duplicate names were accepted")
+	}
+}
+
+func TestLatencySample(t *testing.T) {
+	uniform := &Latency{Distribution: DistributionUniform, Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)}
+	normal := &Latency{Distribution: DistributionNormal, Mean: Duration(50 * time.Millisecond), StdDev: Duration(time.Second), Max: Duration(80 * time.Millisecond)}
+	for range 1000 {
+		if d := uniform.sample(); d < 10*time.Millisecond || d >= 20*time.Millisecond {
+			t.Fatalf("uniform sample %v outside [10ms, 20ms)", d)
+		}
+		if d := normal.sample(); d < 0 || d > 80*time.Millisecond {
+			t.Fatalf("normal sample %v outside [0, 80ms]", d)
+		}
+	}
+}
+
+func TestStatusFaultIsTaggedOnServerSpan(t *testing.T) {
+	h := telemetrytest.New(t)
+	_, handler := newTestServer(t, Rule{
+		Name:       "flaky-user",
+		Route:      "GET /users/{id}",
+		PathValues: map[string]string{"id": "999"},
+		Percentage: 100,
+		Latency:    &Latency{Distribution: DistributionFixed, Mean: Duration(20 * time.Millisecond)},
+		Status:     http.StatusServiceUnavailable,
+	})
+
+	start := time.Now()
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/users/999", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("responded after %v, want at least 20ms", elapsed)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)); w.Code != http.StatusOK {
+		t.Fatalf("unmatched request status = %d, want 200", w.Code)
+	}
+
+	spans := h.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	faulted, clean := spans[0], spans[1]
+	if !telemetrytest.Attr(faulted, AttrInjected).AsBool() || telemetrytest.Attr(faulted, AttrRule).AsString() != "flaky-user" {
+		t.Errorf("faulted span attributes = %v, want fault.injected and fault.rule", faulted.Attributes)
+	}
+	if got := telemetrytest.Attr(faulted, AttrType).AsString(); got != "latency+status_503" {
+		t.Errorf("fault.type = %q, want latency+status_503", got)
+	}
+	if got := telemetrytest.Attr(faulted, AttrLatencyMS).AsInt64(); got != 20 {
+		t.Errorf("fault.latency_ms = %d, want 20", got)
+	}
+	// 注入した障害は例外イベントを持たないので本物の障害と区別できる
+	if !telemetrytest.HasEvent(faulted, "fault.injected") || telemetrytest.HasEvent(faulted, "exception") {
+		t.Errorf("faulted span events = %v, want fault.injected only", faulted.Events)
+	}
+	if telemetrytest.Attr(clean, AttrInjected).AsBool() {
+		t.Error("unmatched request was tagged as faulted")
+	}
+
+	dp := telemetrytest.SumPoint[int64](t, h.Metric(t, "fault_injections_total"), AttrRule.String("flaky-user"))
+	if dp.Value != 1 {
+		t.Errorf("fault_injections_total = %d, want 1", dp.Value)
+	}
+}
+
+func TestPercentage(t *testing.T) {
+	telemetrytest.New(t)
+	in, handler := newTestServer(t, Rule{Name: "half", Percentage: 50, Status: http.StatusInternalServerError})
+
+	rolls := []float64{10, 60, 49.9, 50}
+	in.roll = func() float64 {
+		r := rolls[0]
+		rolls = rolls[1:]
+		return r
+	}
+	var codes []int
+	for range 4 {
+		codes = append(codes, serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)).Code)
+	}
+	if want := []int{500, 200, 500, 200}; !slices.Equal(codes, want) {
+		t.Errorf("codes = %v, want %v", codes, want)
+	}
+}
+
+func TestDropClosesConnection(t *testing.T) {
+	h := telemetrytest.New(t)
+	_, handler := newTestServer(t, Rule{Name: "drop-all", Route: "/users/{id}", Percentage: 100, Drop: true})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/users/1")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("got status %d, want a transport error", resp.StatusCode)
+	}
+	if !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "EOF") {
+		t.Errorf("err = %v, want EOF", err)
+	}
+
+	// 切断してもサーバースパンは終了し、注入が記録される
+	span := h.Span(t, "server")
+	if got := telemetrytest.Attr(span, AttrType).AsString(); got != "drop" {
+		t.Errorf("fault.type = %q, want drop", got)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	telemetrytest.New(t)
+	in, handler := newTestServer(t, Rule{Name: "catch-all", Percentage: 100, Status: http.StatusInternalServerError})
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return serve(handler, httptest.NewRequest(method, target, strings.NewReader(body)))
+	}
+
+	// 全リクエストに一致するルールがあっても管理 API は影響を受けない
+	if w := do("GET", AdminPath, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "catch-all") {
+		t.Fatalf("GET = %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/users/1", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("catch-all not applied: %d", w.Code)
+	}
+
+	if w := do("POST", AdminPath, `{"name": "slow", "route": "/users/{id}", "percentage": 100, "latency": {"distribution": "fixed", "mean": "1ms"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", AdminPath, `{"name": "broken", "percentage": 100}`); w.Code != http.StatusBadRequest {
+		t.Errorf("POST invalid rule = %d, want 400", w.Code)
+	}
+	if rules := in.Rules(); len(rules) != 2 || rules[1].Name != "slow" || time.Duration(rules[1].Latency.Mean) != time.Millisecond {
+		t.Fatalf("rules after POST = %+v", rules)
+	}
+
+	if w := do("DELETE", AdminPath+"/catch-all", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body)
+	}
+	if w := do("DELETE", AdminPath+"/catch-all", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want 404", w.Code)
+	}
+	if w := do("GET", "/users/1", ""); w.Code != http.StatusOK {
+		t.Errorf("after DELETE status = %d, want 200", w.Code)
+	}
+
+	if w := do("PUT", AdminPath, `[{"name": "teapot", "percentage": 100, "status": 418}]`); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/users/1", ""); w.Code != http.StatusTeapot {
+		t.Errorf("after PUT status = %d, want 418", w.Code)
+	}
+	if w := do("DELETE", AdminPath, ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("DELETE all = %d %s", w.Code, w.Body)
+	}
+}
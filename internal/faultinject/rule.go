@@ -0,0 +1,285 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Latency distributions accepted by Latency.Distribution.
+const (
+	DistributionFixed   = "fixed"
+	DistributionUniform = "uniform"
+	DistributionNormal  = "normal"
+)
+
+// Rule describes which requests get a fault and what the fault is. Every
+// non-empty matcher must match; map values are regular expressions that must
+// match the whole value.
+type Rule struct {
+	// Name identifies the rule in the admin API and on spans.
+	Name string `json:"name"`
+
+	// Route is a ServeMux pattern such as "GET /users/{id}". Empty matches
+	// every request.
+	Route string `json:"route,omitempty"`
+	// PathValues matches the wildcards of Route (e.g. {"id": "999"}).
+	PathValues map[string]string `json:"path_values,omitempty"`
+	Query      map[string]string `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+
+	// Percentage of matching requests (0 < p <= 100) that get the fault.
+	Percentage float64 `json:"percentage"`
+
+	// Latency delays the request. It can be combined with Status or Drop.
+	Latency *Latency `json:"latency,omitempty"`
+	// Status answers with this code instead of calling the handler.
+	Status int `json:"status,omitempty"`
+	// Drop closes the connection without a response.
+	Drop bool `json:"drop,omitempty"`
+}
+
+// Latency is a delay distribution. Fixed uses Mean, uniform picks between
+// Min and Max, normal uses Mean and StdDev clamped to [Min, Max] (Max is
+// ignored when zero).
+type Latency struct {
+	Distribution string   `json:"distribution"`
+	Mean         Duration `json:"mean,omitempty"`
+	StdDev       Duration `json:"stddev,omitempty"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+}
+
+// Duration is a time.Duration written as "200ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"200ms\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadRules reads a JSON array of rules. An empty path means no rules.
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("faultinject: %w", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("faultinject: parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Load reads the rules in path (see LoadRules) and returns an Injector using them.
+func Load(path string) (*Injector, error) {
+	rules, err := LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(rules...)
+}
+
+// compiledRule は照合用にルートとパターンを事前にコンパイルしたもの
+type compiledRule struct {
+	Rule
+	route      *http.ServeMux // nil なら全リクエストに一致
+	pathValues map[string]*regexp.Regexp
+	query      map[string]*regexp.Regexp
+	headers    map[string]*regexp.Regexp
+}
+
+func compile(rules []Rule) ([]*compiledRule, error) {
+	var errs []error
+	seen := map[string]bool{}
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, r := range rules {
+		c, err := compileRule(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("faultinject: rule %d (%q): %w", i, r.Name, err))
+			continue
+		}
+		if seen[r.Name] {
+			errs = append(errs, fmt.Errorf("faultinject: rule %d: duplicate name %q", i, r.Name))
+			continue
+		}
+		seen[r.Name] = true
+		compiled = append(compiled, c)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+func compileRule(r Rule) (*compiledRule, error) {
+	if r.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if r.Percentage <= 0 || r.Percentage > 100 {
+		return nil, fmt.Errorf("percentage must be in (0, 100], got %g", r.Percentage)
+	}
+	if r.Latency == nil && r.Status == 0 && !r.Drop {
+		return nil, errors.New("one of latency, status or drop is required")
+	}
+	if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+		return nil, fmt.Errorf("invalid status %d", r.Status)
+	}
+	if r.Status != 0 && r.Drop {
+		return nil, errors.New("status and drop are mutually exclusive")
+	}
+	if err := r.Latency.validate(); err != nil {
+		return nil, err
+	}
+
+	c := &compiledRule{Rule: r}
+	var err error
+	if r.Route != "" {
+		if c.route, err = compileRoute(r.Route); err != nil {
+			return nil, err
+		}
+	}
+	if c.pathValues, err = compilePatterns(r.PathValues); err != nil {
+		return nil, err
+	}
+	if c.query, err = compilePatterns(r.Query); err != nil {
+		return nil, err
+	}
+	if c.headers, err = compilePatterns(r.Headers); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compileRoute はパターンを 1 つだけ持つ ServeMux を作る。不正なパターンで Handle が panic するので回収する
+func compileRoute(pattern string) (mux *http.ServeMux, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid route %q: %v", pattern, p)
+		}
+	}()
+	mux = http.NewServeMux()
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.(*routeMatch).req = r
+	})
+	return mux, nil
+}
+
+func compilePatterns(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp, len(patterns))
+	for key, pattern := range patterns {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		compiled[key] = re
+	}
+	return compiled, nil
+}
+
+func (l *Latency) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.Mean < 0 || l.StdDev < 0 || l.Min < 0 || l.Max < 0 {
+		return errors.New("latency durations must not be negative")
+	}
+	switch l.Distribution {
+	case DistributionFixed:
+		if l.Mean == 0 {
+			return errors.New("fixed latency needs mean")
+		}
+	case DistributionUniform:
+		if l.Max <= l.Min {
+			return fmt.Errorf("uniform latency needs min < max, got %s..%s", time.Duration(l.Min), time.Duration(l.Max))
+		}
+	case DistributionNormal:
+		if l.Mean == 0 {
+			return errors.New("normal latency needs mean")
+		}
+		if l.Max != 0 && l.Max < l.Min {
+			return errors.New("normal latency needs min <= max")
+		}
+	default:
+		return fmt.Errorf("latency distribution must be %q, %q or %q, got %q",
+			DistributionFixed, DistributionUniform, DistributionNormal, l.Distribution)
+	}
+	return nil
+}
+
+// sample は分布から遅延を 1 つ取り出す
+func (l *Latency) sample() time.Duration {
+	switch l.Distribution {
+	case DistributionUniform:
+		return time.Duration(l.Min) + time.Duration(rand.Int64N(int64(l.Max-l.Min)))
+	case DistributionNormal:
+		d := time.Duration(l.Mean) + time.Duration(rand.NormFloat64()*float64(l.StdDev))
+		d = max(d, time.Duration(l.Min))
+		if l.Max != 0 {
+			d = min(d, time.Duration(l.Max))
+		}
+		return d
+	default:
+		return time.Duration(l.Mean)
+	}
+}
+
+// match reports whether r satisfies every matcher of the rule.
+func (c *compiledRule) match(r *http.Request) bool {
+	matched := r
+	if c.route != nil {
+		// ServeMux は r にパターンを書き込むので浅いコピーを渡す
+		m := &routeMatch{}
+		c.route.ServeHTTP(m, r.WithContext(r.Context()))
+		if m.req == nil {
+			return false
+		}
+		matched = m.req
+	}
+	for key, re := range c.pathValues {
+		if !re.MatchString(matched.PathValue(key)) {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for key, re := range c.query {
+		if !re.MatchString(query.Get(key)) {
+			return false
+		}
+	}
+	for key, re := range c.headers {
+		if !re.MatchString(r.Header.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// routeMatch は compileRoute のハンドラーが一致したリクエストを受け取るための ResponseWriter
+type routeMatch struct {
+	req *http.Request
+}
+
+func (m *routeMatch) Header() http.Header         { return http.Header{} }
+func (m *routeMatch) Write(b []byte) (int, error) { return len(b), nil }
+func (m *routeMatch) WriteHeader(int)             {}
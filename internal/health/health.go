@@ -0,0 +1,188 @@
+// Package health は /livez と /readyz を提供するパッケージ
+//
+// /livez はプロセスが応答できるかだけを返し、依存先は見ない（再起動の判断用）。
+// /readyz は登録したコンポーネント（DB、OTLP エクスポーター、停止中かどうか）を
+// タイムアウト付きで並行にチェックし、コンポーネントごとの結果を JSON で返す。
+// 既定ではプローブのリクエストとチェック中の DB スパンはトレースしない。
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/sampling"
+)
+
+// Probe paths registered by Register. "/health" is kept as an alias of
+// "/readyz" for existing scripts.
+const (
+	LivePath   = "/livez"
+	ReadyPath  = "/readyz"
+	LegacyPath = "/health"
+)
+
+// Overall and per-component statuses.
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+	StatusError       = "error"
+)
+
+// Report is the body of /livez and /readyz.
+type Report struct {
+	Status     string                     `json:"status"`
+	Service    string                     `json:"service"`
+	Components map[string]ComponentReport `json:"components,omitempty"`
+}
+
+// ComponentReport is the result of one check.
+type ComponentReport struct {
+	Status     string  `json:"status"`
+	Critical   bool    `json:"critical"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Options controls how checks run.
+type Options struct {
+	// Timeout bounds every check. Defaults to 1s.
+	Timeout time.Duration
+	// TraceChecks traces probe requests and the spans created by checks
+	// (e.g. otelsql's db.Ping). They are suppressed by default.
+	TraceChecks bool
+}
+
+type component struct {
+	name     string
+	critical bool
+	check    func(context.Context) error
+}
+
+// Checker runs the registered checks. Add every component before serving.
+type Checker struct {
+	service    string
+	opts       Options
+	components []component
+}
+
+// New returns a Checker for the named service.
+func New(service string, opts Options) *Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	return &Checker{service: service, opts: opts}
+}
+
+// Add registers a check. A failing critical check makes /readyz answer 503
+// ("unavailable"); a failing non-critical one is reported as "degraded"
+// with 200 so that, for example, a collector outage does not take the
+// service out of rotation.
+func (c *Checker) Add(name string, critical bool, check func(context.Context) error) {
+	c.components = append(c.components, component{name: name, critical: critical, check: check})
+}
+
+// Check runs every component concurrently and aggregates the results.
+func (c *Checker) Check(ctx context.Context) Report {
+	if !c.opts.TraceChecks {
+		ctx = withoutTracing(ctx)
+	}
+
+	report := Report{Status: StatusOK, Service: c.service, Components: make(map[string]ComponentReport, len(c.components))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, comp := range c.components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, comp)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[comp.name] = result
+			switch {
+			case result.Status == StatusOK:
+			case comp.critical:
+				report.Status = StatusUnavailable
+			case report.Status == StatusOK:
+				report.Status = StatusDegraded
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, comp component) ComponentReport {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := comp.check(ctx)
+	result := ComponentReport{
+		Status:     StatusOK,
+		Critical:   comp.critical,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Register mounts /livez, /readyz and /health on mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+LivePath, c.livezHandler)
+	mux.HandleFunc("GET "+ReadyPath, c.readyzHandler)
+	mux.HandleFunc("GET "+LegacyPath, c.readyzHandler)
+}
+
+// Filter is an otelhttp filter: it returns false for probe requests unless
+// TraceChecks is set.
+func (c *Checker) Filter(r *http.Request) bool {
+	if c.opts.TraceChecks {
+		return true
+	}
+	switch r.URL.Path {
+	case LivePath, ReadyPath, LegacyPath:
+		return false
+	}
+	return true
+}
+
+func (c *Checker) livezHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Report{Status: StatusOK, Service: c.service})
+}
+
+func (c *Checker) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Check(r.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status == StatusUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// suppressedParent はサンプリングされない親スパン。ParentBased サンプラーでは
+// この子として作られたスパン（otelsql の db.Ping など）は記録されない。
+// telemetry.Setup のサンプラー（internal/sampling）は親に頼らず Suppress の印で落とす
+var suppressedParent = oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+	TraceID: oteltrace.TraceID{0x68, 0x65, 0x61, 0x6c, 0x74, 0x68}, // "health"
+	SpanID:  oteltrace.SpanID{0x68, 0x65, 0x61, 0x6c, 0x74, 0x68},
+})
+
+func withoutTracing(ctx context.Context) context.Context {
+	return sampling.Suppress(oteltrace.ContextWithSpanContext(ctx, suppressedParent))
+}
@@ -0,0 +1,172 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"otel-playground/internal/sampling"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+func ok(context.Context) error { return nil }
+
+func readyz(t *testing.T, c *Checker) (int, Report) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+func TestReadyzAggregatesComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		critical   error
+		optional   error
+		wantCode   int
+		wantStatus string
+	}{
+		{"all ok", nil, nil, http.StatusOK, StatusOK},
+		{"optional failing", nil, errors.New("collector unreachable"), http.StatusOK, StatusDegraded},
+		{"critical failing", errors.New("connection refused"), nil, http.StatusServiceUnavailable, StatusUnavailable},
+		{"both failing", errors.New("connection refused"), errors.New("collector unreachable"), http.StatusServiceUnavailable, StatusUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("svc", Options{})
+			c.Add("database", true, func(context.Context) error { return tt.critical })
+			c.Add("otlp_exporter", false, func(context.Context) error { return tt.optional })
+
+			code, report := readyz(t, c)
+			if code != tt.wantCode || report.Status != tt.wantStatus {
+				t.Fatalf("got %d %q, want %d %q", code, report.Status, tt.wantCode, tt.wantStatus)
+			}
+			db := report.Components["database"]
+			if !db.Critical || (tt.critical != nil) != (db.Status == StatusError) {
+				t.Errorf("database = %+v", db)
+			}
+			if tt.critical != nil && db.Error != tt.critical.Error() {
+				t.Errorf("database error = %q, want %q", db.Error, tt.critical)
+			}
+		})
+	}
+}
+
+func TestChecksAreBoundedByTimeout(t *testing.T) {
+	c := New("svc", Options{Timeout: 20 * time.Millisecond})
+	c.Add("database", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Add("cache", false, ok)
+
+	start := time.Now()
+	code, report := readyz(t, c)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("readyz took %v despite the 20ms timeout", elapsed)
+	}
+	if code != http.StatusServiceUnavailable || report.Components["database"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("got %d %+v, want 503 with a deadline error", code, report.Components)
+	}
+	if report.Components["cache"].Status != StatusOK {
+		t.Errorf("cache = %+v, want ok", report.Components["cache"])
+	}
+}
+
+func TestLivezIgnoresDependencies(t *testing.T) {
+	c := New("svc", Options{})
+	c.Add("database", true, func(context.Context) error { return errors.New("down") })
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, LivePath, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("livez = %d, want 200", w.Code)
+	}
+}
+
+func TestProbesAreNotTracedByDefault(t *testing.T) {
+	for _, traced := range []bool{false, true} {
+		h := telemetrytest.New(t)
+		c := New("svc", Options{TraceChecks: traced})
+		c.Add("database", true, func(ctx context.Context) error {
+			// otelsql の db.Ping と同じく、チェック内でスパンを作る
+			_, span := otel.Tracer("test").Start(ctx, "db.Ping")
+			span.End()
+			return nil
+		})
+
+		mux := http.NewServeMux()
+		c.Register(mux)
+		mux.HandleFunc("/users", func(http.ResponseWriter, *http.Request) {})
+		handler := otelhttp.NewHandler(mux, "svc", otelhttp.WithFilter(c.Filter))
+		for _, path := range []string{LivePath, ReadyPath, LegacyPath, "/users"} {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		want := 1 // /users のサーバースパンだけ
+		if traced {
+			want += 3 + 2 // プローブ 3 件と、/readyz・/health での db.Ping
+		}
+		if got := len(h.Spans()); got != want {
+			t.Errorf("TraceChecks=%v: got %d spans, want %d", traced, got, want)
+		}
+	}
+}
+
+func TestChecksAreNotTracedWithAnySampler(t *testing.T) {
+	for _, sampler := range []string{"always_on", "traceidratio", "parentbased_always_on", "parentbased_traceidratio", "parentbased_rules"} {
+		t.Run(sampler, func(t *testing.T) {
+			t.Setenv(sampling.EnvSampler, sampler)
+			t.Setenv(sampling.EnvSamplerArg, "")
+			if sampler == "parentbased_rules" {
+				t.Setenv(sampling.EnvSamplerArg, "../../"+sampling.DefaultRulesFile)
+			}
+			policy, err := sampling.FromEnv("user-service")
+			if err != nil {
+				t.Fatal(err)
+			}
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(policy.Sampler()), sdktrace.WithSyncer(exporter))
+			t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+			for _, traced := range []bool{false, true} {
+				exporter.Reset()
+				c := New("user-service", Options{TraceChecks: traced})
+				c.Add("database", true, func(ctx context.Context) error {
+					// otelsql の db.Ping と同じく、チェック内でルートの候補になるスパンを作る
+					_, span := tp.Tracer("test").Start(ctx, "db.Ping")
+					span.End()
+					return nil
+				})
+				c.Check(context.Background())
+
+				want := 0
+				if traced {
+					want = 1
+				}
+				if got := len(exporter.GetSpans()); got != want {
+					t.Errorf("TraceChecks=%v: got %d spans, want %d", traced, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// ErrCircuitOpen is returned without sending the request while the target's
+// circuit is open (or its half-open probe is already in flight).
+var ErrCircuitOpen = errors.New("httpclient: circuit breaker is open")
+
+// BreakerState is the state of a per-target circuit breaker.
+type BreakerState int
+
+const (
+	// StateClosed lets every request through and counts consecutive failures.
+	StateClosed BreakerState = iota
+	// StateOpen rejects requests until OpenTimeout has passed.
+	StateOpen
+	// StateHalfOpen lets a limited number of probes through; one success
+	// closes the circuit and one failure opens it again.
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// BreakerPolicy controls when a target's circuit opens and recovers.
+// Zero fields fall back to the values of DefaultBreakerPolicy.
+type BreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures (transport
+	// errors or 5xx) that opens the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before half-opening.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent requests allowed while half-open.
+	HalfOpenProbes int
+}
+
+// DefaultBreakerPolicy opens after 5 consecutive failures for 10s.
+func DefaultBreakerPolicy() BreakerPolicy {
+	return BreakerPolicy{
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenProbes:   1,
+	}
+}
+
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	d := DefaultBreakerPolicy()
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = d.FailureThreshold
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = d.OpenTimeout
+	}
+	if p.HalfOpenProbes <= 0 {
+		p.HalfOpenProbes = d.HalfOpenProbes
+	}
+	return p
+}
+
+// breaker は 1 つの接続先（host:port）の状態を持つ
+type breaker struct {
+	target string
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+	// generation は状態が変わるたびに増える。permit と比べて古いリクエストの結果を捨てる
+	generation uint64
+}
+
+// permit は allow が許可したリクエストに渡す札。done に返すと、許可したときと
+// 同じ状態のままの場合だけ結果が状態に反映される
+type permit struct {
+	generation uint64
+}
+
+func newBreaker(target string, policy BreakerPolicy, now func() time.Time) *breaker {
+	return &breaker{target: target, policy: policy, now: now}
+}
+
+// allow reports whether a request may be sent now. Every allowed request
+// must be followed by exactly one call to done with the returned permit.
+func (b *breaker) allow(ctx context.Context) (permit, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.policy.OpenTimeout {
+		b.transition(ctx, StateHalfOpen)
+	}
+	switch b.state {
+	case StateOpen:
+		return permit{}, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.policy.HalfOpenProbes {
+			return permit{}, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return permit{generation: b.generation}, nil
+}
+
+// done records the outcome of a request allowed by allow. Outcomes of
+// requests allowed before the last state change are ignored, so while
+// half-open only the probes decide whether the circuit closes or reopens.
+func (b *breaker) done(ctx context.Context, p permit, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// オープン前に送ったリクエストが遅れて返ってきても、ハーフオープンのプローブの代わりにはしない
+	if p.generation != b.generation {
+		return
+	}
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		if success {
+			b.transition(ctx, StateClosed)
+		} else {
+			b.transition(ctx, StateOpen)
+		}
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.policy.FailureThreshold {
+			b.transition(ctx, StateOpen)
+		}
+	}
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// transition は状態を変え、呼び出し元のスパンにイベントとして残す。b.mu を保持して呼ぶこと
+func (b *breaker) transition(ctx context.Context, to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	if to == StateOpen {
+		b.openedAt = b.now()
+	}
+
+	oteltrace.SpanFromContext(ctx).AddEvent("circuit_breaker.state_change", oteltrace.WithAttributes(
+		append(targetAttributes(b.target),
+			attribute.String("circuit_breaker.from", from.String()),
+			attribute.String("circuit_breaker.to", to.String()),
+		)...,
+	))
+}
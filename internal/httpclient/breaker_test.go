@@ -0,0 +1,174 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// fakeClock は OpenTimeout の経過をテストから進める
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestBreakerTransitions(t *testing.T) {
+	h := telemetrytest.New(t)
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newBreaker("localhost:8080", BreakerPolicy{FailureThreshold: 2, OpenTimeout: time.Second, HalfOpenProbes: 1}, clock.now)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "calls")
+	step := func(success bool) {
+		t.Helper()
+		p, err := b.allow(ctx)
+		if err != nil {
+			t.Fatalf("allow in %v: %v", b.current(), err)
+		}
+		b.done(ctx, p, success)
+	}
+
+	// 成功で連続失敗数はリセットされる
+	step(false)
+	step(true)
+	step(false)
+	if b.current() != StateClosed {
+		t.Fatalf("state = %v, want closed", b.current())
+	}
+	step(false)
+	if b.current() != StateOpen {
+		t.Fatalf("state = %v, want open", b.current())
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow while open = %v, want ErrCircuitOpen", err)
+	}
+
+	// タイムアウト後は 1 件だけ試す。失敗すれば再びオープン
+	clock.advance(time.Second)
+	probe, err := b.allow(ctx)
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if b.current() != StateHalfOpen {
+		t.Fatalf("state = %v, want half_open", b.current())
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second probe = %v, want ErrCircuitOpen", err)
+	}
+	b.done(ctx, probe, false)
+	if b.current() != StateOpen {
+		t.Fatalf("state = %v, want open after failed probe", b.current())
+	}
+
+	clock.advance(time.Second)
+	step(true)
+	if b.current() != StateClosed {
+		t.Fatalf("state = %v, want closed after successful probe", b.current())
+	}
+	span.End()
+
+	var transitions []string
+	for _, e := range h.Span(t, "calls").Events {
+		if e.Name != "circuit_breaker.state_change" {
+			continue
+		}
+		var from, to string
+		for _, kv := range e.Attributes {
+			switch kv.Key {
+			case "circuit_breaker.from":
+				from = kv.Value.AsString()
+			case "circuit_breaker.to":
+				to = kv.Value.AsString()
+			}
+		}
+		transitions = append(transitions, from+"->"+to)
+	}
+	want := []string{"closed->open", "open->half_open", "half_open->open", "open->half_open", "half_open->closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestBreakerIgnoresRequestsFromBeforeHalfOpen(t *testing.T) {
+	telemetrytest.New(t)
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newBreaker("localhost:8080", BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenProbes: 1}, clock.now)
+	ctx := context.Background()
+
+	// slow はクローズ中に許可され、オープンとハーフオープンをまたいで返ってくる
+	slow, err := b.allow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := b.allow(ctx)
+	b.done(ctx, failed, false)
+	clock.advance(time.Second)
+	probe, err := b.allow(ctx)
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+
+	// プローブ以外の結果ではハーフオープンから動かず、プローブの枠も空かない
+	b.done(ctx, slow, true)
+	if b.current() != StateHalfOpen {
+		t.Fatalf("state = %v after a stale success, want half_open", b.current())
+	}
+	b.done(ctx, slow, false)
+	if b.current() != StateHalfOpen {
+		t.Fatalf("state = %v after a stale failure, want half_open", b.current())
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second probe = %v, want ErrCircuitOpen", err)
+	}
+
+	b.done(ctx, probe, true)
+	if b.current() != StateClosed {
+		t.Fatalf("state = %v after the probe succeeded, want closed", b.current())
+	}
+	// 古いプローブの結果が閉じたあとに重なっても数えない
+	b.done(ctx, probe, false)
+	if b.current() != StateClosed {
+		t.Fatalf("state = %v after a repeated probe result, want closed", b.current())
+	}
+}
+
+func TestDoRejectsWhileOpen(t *testing.T) {
+	h := telemetrytest.New(t)
+	c, err := New(fastPolicy(), BreakerPolicy{FailureThreshold: 3, OpenTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, nil, 500)
+
+	for range 3 {
+		get(t, c, context.Background(), srv.URL)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do after 3 failures = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server saw %d calls, want 3", calls.Load())
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if got := c.BreakerState(u.Host); got != StateOpen {
+		t.Errorf("BreakerState = %v, want open", got)
+	}
+	state := telemetrytest.GaugePoint[int64](t, h.Metric(t, "http_client_circuit_state"), semconv.ServerAddress(u.Hostname()))
+	if state.Value != int64(StateOpen) {
+		t.Errorf("http_client_circuit_state = %d, want %d", state.Value, StateOpen)
+	}
+}
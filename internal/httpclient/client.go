@@ -0,0 +1,222 @@
+// Package httpclient は下流サービス呼び出し用の計装済み HTTP クライアントを提供するパッケージ
+//
+// otelhttp のクライアントスパンを試行ごとに作り、502/503/504 や接続エラーを
+// 指数バックオフ（ジッター付き）でリトライする。接続先（host:port）ごとに
+// サーキットブレーカーを持ち、失敗が続く接続先へのリクエストは送らずに失敗させる。
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "otel-playground/internal/httpclient"
+
+// Client is an otelhttp-instrumented HTTP client that retries according to
+// a RetryPolicy and isolates failing targets with circuit breakers.
+type Client struct {
+	http          *http.Client
+	policy        RetryPolicy
+	breakerPolicy BreakerPolicy
+	retries       metric.Int64Counter
+	now           func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// New builds a Client using the global tracer and meter providers.
+func New(retryPolicy RetryPolicy, breakerPolicy BreakerPolicy) (*Client, error) {
+	meter := otel.Meter(instrumentationName)
+
+	c := &Client{
+		http: &http.Client{
+			// 試行ごとのクライアントスパンは otelhttp が作る
+			Transport: otelhttp.NewTransport(resendCountTransport{base: http.DefaultTransport}),
+		},
+		policy:        retryPolicy.withDefaults(),
+		breakerPolicy: breakerPolicy.withDefaults(),
+		now:           time.Now,
+		breakers:      map[string]*breaker{},
+	}
+
+	var err error
+	c.retries, err = meter.Int64Counter(
+		"http_client_retries_total",
+		metric.WithDescription("Total number of resent downstream HTTP requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"http_client_circuit_state",
+		metric.WithDescription("Circuit breaker state per downstream target (0=closed, 1=open, 2=half_open)"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for target, b := range c.breakers {
+				o.Observe(int64(b.current()), metric.WithAttributes(targetAttributes(target)...))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// BreakerState returns the circuit state of target (host:port).
+func (c *Client) BreakerState(target string) BreakerState {
+	return c.breakerFor(target).current()
+}
+
+func (c *Client) breakerFor(target string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[target]
+	if !ok {
+		b = newBreaker(target, c.breakerPolicy, c.now)
+		c.breakers[target] = b
+	}
+	return b
+}
+
+// Do sends req, resending it on transport errors and retryable status codes
+// until MaxAttempts is reached, the context is done, or the next delay would
+// overrun the context deadline. The last response or error is returned
+// unchanged, so callers still see e.g. a final 503. While the target's
+// circuit is open no request is sent and the error wraps ErrCircuitOpen.
+// Requests with a body must set GetBody.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	b := c.breakerFor(req.URL.Host)
+
+	for resend := 0; ; resend++ {
+		attempt, err := newAttempt(req, resend)
+		if err != nil {
+			return nil, err
+		}
+
+		granted, err := b.allow(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, req.URL.Host)
+		}
+		resp, err := c.http.Do(attempt)
+		// 5xx と接続エラーを失敗として数える
+		b.done(ctx, granted, err == nil && resp.StatusCode < http.StatusInternalServerError)
+		if resend+1 >= c.policy.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		var reason string
+		delay := c.policy.Backoff(resend + 1)
+		switch {
+		case err != nil:
+			reason = "transport"
+		case c.policy.retryable(resp.StatusCode):
+			reason = strconv.Itoa(resp.StatusCode)
+			// サーバーが待ち時間を指定していればそれに従う。ただし MaxBackoff より長くは待たない
+			if d, ok := retryAfter(resp, time.Now()); ok {
+				delay = min(d, c.policy.MaxBackoff)
+			}
+		default:
+			return resp, nil
+		}
+
+		// 待っても期限に間に合わないなら今の結果を返す
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		attrs := append(targetAttributes(req.URL.Host),
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ErrorTypeKey.String(reason),
+		)
+		c.retries.Add(ctx, 1, metric.WithAttributes(attrs...))
+		oteltrace.SpanFromContext(ctx).AddEvent("http.retry", oteltrace.WithAttributes(append(attrs,
+			semconv.HTTPRequestResendCount(resend+1),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+		)...))
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// targetAttributes splits host:port into server.address and server.port.
+func targetAttributes(target string) []attribute.KeyValue {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return []attribute.KeyValue{semconv.ServerAddress(target)}
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	return attrs
+}
+
+type resendKey struct{}
+
+// newAttempt clones req for the given resend, rewinding the body if needed.
+func newAttempt(req *http.Request, resend int) (*http.Request, error) {
+	attempt := req.Clone(context.WithValue(req.Context(), resendKey{}, resend))
+	if resend > 0 && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("httpclient: cannot resend a request without GetBody")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	return attempt, nil
+}
+
+// resendCountTransport は otelhttp が開始したクライアントスパンに再送回数を付ける。
+// semconv に合わせて最初の試行（0 回目）には付けない
+type resendCountTransport struct {
+	base http.RoundTripper
+}
+
+func (t resendCountTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if n, ok := r.Context().Value(resendKey{}).(int); ok && n > 0 {
+		oteltrace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPRequestResendCount(n))
+	}
+	return t.base.RoundTrip(r)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// fastPolicy はテストが待たないようにバックオフを最小にする
+func fastPolicy() RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.InitialBackoff = time.Millisecond
+	p.MaxBackoff = time.Millisecond
+	return p
+}
+
+// statusSequence は呼ばれるたびに codes を順番に返すサーバーを立てる
+func statusSequence(t *testing.T, header http.Header, codes ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(codes[min(n, len(codes)-1)])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func get(t *testing.T, c *Client, ctx context.Context, url string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestDoRetriesGatewayErrors(t *testing.T) {
+	h := telemetrytest.New(t)
+	c, err := New(fastPolicy(), BreakerPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, nil, 503, 502, 200)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "getUser")
+	resp := get(t, c, ctx, srv.URL)
+	parent.End()
+
+	if resp.StatusCode != 200 || calls.Load() != 3 {
+		t.Fatalf("status = %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+
+	// 試行ごとに親スパンの子としてクライアントスパンができる。再送回数は再送にだけ付く
+	var resends []int64
+	for _, s := range h.Spans() {
+		if s.Name != "HTTP GET" {
+			continue
+		}
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("attempt parent = %v, want %v", s.Parent.SpanID(), parent.SpanContext().SpanID())
+		}
+		resend := telemetrytest.Attr(s, semconv.HTTPRequestResendCountKey)
+		if resend.Type() == attribute.INVALID {
+			resends = append(resends, 0)
+			continue
+		}
+		if resend.AsInt64() == 0 {
+			t.Error("http.request.resend_count = 0 on the first attempt")
+		}
+		resends = append(resends, resend.AsInt64())
+	}
+	if len(resends) != 3 || resends[0] != 0 || resends[1] != 1 || resends[2] != 2 {
+		t.Errorf("resend counts = %v, want [unset 1 2]", resends)
+	}
+	if events := h.Span(t, "getUser").Events; len(events) != 2 || events[0].Name != "http.retry" {
+		t.Errorf("parent events = %v, want 2 http.retry events", events)
+	}
+
+	retries := h.Metric(t, "http_client_retries_total")
+	for _, reason := range []string{"503", "502"} {
+		dp := telemetrytest.SumPoint[int64](t, retries, semconv.ErrorTypeKey.String(reason))
+		if dp.Value != 1 {
+			t.Errorf("retries for %s = %d, want 1", reason, dp.Value)
+		}
+	}
+}
+
+func TestDoReturnsLastResponseWhenAttemptsExhausted(t *testing.T) {
+	telemetrytest.New(t)
+	c, err := New(fastPolicy(), BreakerPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, nil, 504)
+
+	if resp := get(t, c, context.Background(), srv.URL); resp.StatusCode != 504 || calls.Load() != 3 {
+		t.Fatalf("status = %d after %d calls, want 504 after 3", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestDoDoesNotRetryOtherStatus(t *testing.T) {
+	telemetrytest.New(t)
+	c, err := New(fastPolicy(), BreakerPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, nil, 500, 200)
+
+	if resp := get(t, c, context.Background(), srv.URL); resp.StatusCode != 500 || calls.Load() != 1 {
+		t.Fatalf("status = %d after %d calls, want 500 after 1", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestDoStopsWhenRetryAfterPassesDeadline(t *testing.T) {
+	telemetrytest.New(t)
+	policy := fastPolicy()
+	policy.MaxBackoff = time.Minute
+	c, err := New(policy, BreakerPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, http.Header{"Retry-After": {"30"}}, 503, 200)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	resp := get(t, c, ctx, srv.URL)
+
+	if resp.StatusCode != 503 || calls.Load() != 1 {
+		t.Fatalf("status = %d after %d calls, want 503 after 1", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %v despite the deadline", elapsed)
+	}
+}
+
+func TestDoCapsRetryAfterAtMaxBackoff(t *testing.T) {
+	telemetrytest.New(t)
+	c, err := New(fastPolicy(), BreakerPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, calls := statusSequence(t, http.Header{"Retry-After": {"30"}}, 503, 200)
+
+	// 期限がなくても Retry-After の 30 秒は待たず、MaxBackoff（1ms）で再送する
+	start := time.Now()
+	resp := get(t, c, context.Background(), srv.URL)
+
+	if resp.StatusCode != 200 || calls.Load() != 2 {
+		t.Fatalf("status = %d after %d calls, want 200 after 2", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %v beyond MaxBackoff", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for resend, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second} {
+		if got := p.Backoff(resend); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", resend, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.Backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Backoff(1) with jitter = %v, want within 50-150ms", got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
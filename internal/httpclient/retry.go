@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how many times and how fast a request is resent.
+// Zero fields other than Jitter fall back to the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first resend.
+	InitialBackoff time.Duration
+	// MaxBackoff caps every delay, including one asked for by Retry-After.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay on every resend.
+	Multiplier float64
+	// Jitter randomizes each delay by ±Jitter (0-1) to spread out clients.
+	Jitter float64
+	// RetryableStatus lists response codes that are worth resending.
+	RetryableStatus []int
+}
+
+// DefaultRetryPolicy retries gateway errors twice with 100ms→2s backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  100 * time.Millisecond,
+		MaxBackoff:      2 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		RetryableStatus: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = d.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = d.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = d.Multiplier
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		p.Jitter = d.Jitter
+	}
+	if p.RetryableStatus == nil {
+		p.RetryableStatus = d.RetryableStatus
+	}
+	return p
+}
+
+// Backoff returns the delay before the given resend (1 for the first resend).
+func (p RetryPolicy) Backoff(resend int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(resend-1))
+	d = min(d, float64(p.MaxBackoff))
+	// ±Jitter の範囲でばらつかせる
+	d *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	return time.Duration(d)
+}
+
+func (p RetryPolicy) retryable(status int) bool {
+	return slices.Contains(p.RetryableStatus, status)
+}
+
+// retryAfter parses the Retry-After header (delay-seconds or HTTP-date).
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
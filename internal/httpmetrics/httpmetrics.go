@@ -0,0 +1,175 @@
+// Package httpmetrics はサービスの HTTP リクエストメトリクスを 1 か所で記録するミドルウェアを提供するパッケージ
+//
+// 各ハンドラで開始時刻・アクティブ接続数・カウンター・ヒストグラムを記録する代わりに、
+// ミドルウェアが実際のステータスコード・レスポンスサイズ・マッチしたルートを
+// 属性にして、すべてのエンドポイントで同じ形に記録する。
+package httpmetrics
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Options configures Metrics.
+type Options struct {
+	// Filter は false を返したリクエストを記録しない（otelhttp.WithFilter と同じ意味）
+	Filter func(*http.Request) bool
+	// SlowRequest を超えたリクエストをログに出す。0 なら出さない
+	SlowRequest time.Duration
+}
+
+// Metrics records the request metrics of one service. It is safe for
+// concurrent use.
+type Metrics struct {
+	opts Options
+
+	requests     metric.Int64Counter
+	duration     metric.Float64Histogram
+	active       metric.Int64UpDownCounter
+	responseSize metric.Int64Histogram
+}
+
+// New creates <prefix>_requests_total, <prefix>_request_duration_seconds,
+// <prefix>_active_connections and <prefix>_response_size_bytes on meter,
+// e.g. user_service_requests_total for the prefix "user_service".
+func New(meter metric.Meter, prefix string, opts Options) (*Metrics, error) {
+	service := strings.ReplaceAll(prefix, "_", " ")
+	m := &Metrics{opts: opts}
+
+	var err error
+	if m.requests, err = meter.Int64Counter(
+		prefix+"_requests_total",
+		metric.WithDescription("Total number of requests to "+service),
+	); err != nil {
+		return nil, err
+	}
+	if m.duration, err = meter.Float64Histogram(
+		prefix+"_request_duration_seconds",
+		metric.WithDescription("Duration of requests to "+service),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, err
+	}
+	if m.active, err = meter.Int64UpDownCounter(
+		prefix+"_active_connections",
+		metric.WithDescription("Number of active connections to "+service),
+	); err != nil {
+		return nil, err
+	}
+	if m.responseSize, err = meter.Int64Histogram(
+		prefix+"_response_size_bytes",
+		metric.WithDescription("Size of response bodies written by "+service),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(0, 100, 1_000, 10_000, 100_000, 1_000_000),
+	); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Middleware records every request handled by next. routes is the mux
+// behind next and is only used to look up the matched pattern, so the route
+// is known even when next answers before reaching the mux (an injected
+// fault, for example). Wrap it inside otelhttp so exemplars point at the
+// server span.
+func (m *Metrics) Middleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.opts.Filter != nil && !m.opts.Filter(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		_, pattern := routes.Handler(r)
+		route := Route(pattern)
+		start := time.Now()
+
+		m.active.Add(ctx, 1)
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			m.active.Add(ctx, -1)
+
+			// ハンドラが panic（http.ErrAbortHandler による切断など）した場合はレスポンスが無い
+			p := recover()
+			status := rw.status
+			if status == 0 && p == nil {
+				status = http.StatusOK
+			}
+			m.record(r, route, status, rw.size, time.Since(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// record は 1 リクエスト分のメトリクスを記録する。ステータスが 0（応答なし）なら属性を付けない
+func (m *Metrics) record(r *http.Request, route string, status int, size int64, elapsed time.Duration) {
+	attrs := []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(r.Method)}
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+	}
+	if status != 0 {
+		attrs = append(attrs, semconv.HTTPResponseStatusCodeKey.Int(status))
+	}
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+	// Exemplar: コンテキストのサーバースパンがメトリクスからトレースへのリンクになる
+	ctx := r.Context()
+	m.requests.Add(ctx, 1, set)
+	m.duration.Record(ctx, elapsed.Seconds(), set)
+	m.responseSize.Record(ctx, size, set)
+
+	if m.opts.SlowRequest > 0 && elapsed > m.opts.SlowRequest {
+		// サーバースパンのコンテキストで出し、ログからトレースを辿れるようにする
+		slog.WarnContext(ctx, "🐌 Slow request detected",
+			"duration", elapsed,
+			string(semconv.HTTPRequestMethodKey), r.Method,
+			string(semconv.URLPathKey), r.URL.Path,
+			string(semconv.HTTPResponseStatusCodeKey), status,
+		)
+	}
+}
+
+// Route strips the method from a ServeMux pattern: "GET /users/{id}"
+// becomes "/users/{id}".
+func Route(pattern string) string {
+	if _, route, ok := strings.Cut(pattern, " "); ok {
+		return route
+	}
+	return pattern
+}
+
+// responseWriter は書き込まれたステータスコードとボディのバイト数を覚えておく
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	// 1xx は最終的なステータスではない
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap は http.ResponseController が Flush などを元の ResponseWriter に届けるために使う
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,157 @@
+package httpmetrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// newTestHandler は mux を wrap（障害注入などの代わり）越しに計測するハンドラを作る
+func newTestHandler(t *testing.T, wrap func(http.Handler) http.Handler) (*telemetrytest.Harness, http.Handler) {
+	t.Helper()
+
+	h := telemetrytest.New(t)
+	m, err := New(otel.Meter("test"), "test_service", Options{
+		Filter: func(r *http.Request) bool { return r.URL.Path != "/livez" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		// WriteHeader を呼ばずに書くと 200
+		io.WriteString(w, `{"id":"`+r.PathValue("id")+`"}`)
+	})
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /abort", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+
+	var next http.Handler = mux
+	if wrap != nil {
+		next = wrap(mux)
+	}
+	return h, m.Middleware(mux, next)
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func attrs(method, route string, status int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.HTTPRouteKey.String(route),
+		semconv.HTTPResponseStatusCodeKey.Int(status),
+	}
+}
+
+func TestRecordsStatusSizeAndRoute(t *testing.T) {
+	h, handler := newTestHandler(t, nil)
+
+	ctx, span := otel.Tracer("test").Start(t.Context(), "server")
+	serve(handler, httptest.NewRequestWithContext(ctx, http.MethodGet, "/items/1", nil))
+	span.End()
+	serve(handler, httptest.NewRequest(http.MethodGet, "/items/missing", nil))
+	serve(handler, httptest.NewRequest(http.MethodGet, "/items/missing", nil))
+
+	requests := h.Metric(t, "test_service_requests_total")
+	if got := telemetrytest.SumPoint[int64](t, requests, attrs("GET", "/items/{id}", 200)...).Value; got != 1 {
+		t.Errorf("200 requests = %d, want 1", got)
+	}
+	if got := telemetrytest.SumPoint[int64](t, requests, attrs("GET", "/items/{id}", 404)...).Value; got != 2 {
+		t.Errorf("404 requests = %d, want 2", got)
+	}
+
+	size := telemetrytest.HistogramPoint[int64](t, h.Metric(t, "test_service_response_size_bytes"), attrs("GET", "/items/{id}", 200)...)
+	if size.Sum != int64(len(`{"id":"1"}`)) {
+		t.Errorf("response size = %d, want %d", size.Sum, len(`{"id":"1"}`))
+	}
+
+	duration := telemetrytest.HistogramPoint[float64](t, h.Metric(t, "test_service_request_duration_seconds"), attrs("GET", "/items/{id}", 200)...)
+	if !telemetrytest.HasExemplarFor(duration.Exemplars, h.Span(t, "server")) {
+		t.Errorf("no exemplar for the request's span in %v", duration.Exemplars)
+	}
+
+	if active := telemetrytest.SumPoint[int64](t, h.Metric(t, "test_service_active_connections")); active.Value != 0 {
+		t.Errorf("active connections = %d after all requests finished, want 0", active.Value)
+	}
+}
+
+func TestRouteIsKnownWhenAnsweredBeforeTheMux(t *testing.T) {
+	// 障害注入のようにミドルウェアが mux に届く前に応答する
+	unavailable := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "injected fault", http.StatusServiceUnavailable)
+		})
+	}
+	h, handler := newTestHandler(t, unavailable)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+
+	telemetrytest.SumPoint[int64](t, h.Metric(t, "test_service_requests_total"), attrs("GET", "/items/{id}", 503)...)
+}
+
+func TestFilteredUnmatchedAndAbortedRequests(t *testing.T) {
+	h, handler := newTestHandler(t, nil)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	serve(handler, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, http.ErrAbortHandler) {
+				t.Errorf("recovered %v, want http.ErrAbortHandler re-panicked", err)
+			}
+		}()
+		serve(handler, httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+
+	var routes []string
+	requests := h.Metric(t, "test_service_requests_total").Data.(metricdata.Sum[int64])
+	for _, dp := range requests.DataPoints {
+		route, _ := dp.Attributes.Value(semconv.HTTPRouteKey)
+		status, hasStatus := dp.Attributes.Value(semconv.HTTPResponseStatusCodeKey)
+		switch route.AsString() {
+		case "":
+			// マッチしなかったリクエストにはルートを付けない
+			if status.AsInt64() != http.StatusNotFound {
+				t.Errorf("unmatched request status = %v, want 404", status)
+			}
+		case "/abort":
+			// 切断されたリクエストにはステータスが無い
+			if hasStatus {
+				t.Errorf("aborted request has status %v", status)
+			}
+		}
+		routes = append(routes, route.AsString())
+	}
+	if len(routes) != 2 {
+		t.Errorf("recorded routes %q, want the unmatched and aborted requests only (/livez is filtered)", routes)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"GET /users/{id}": "/users/{id}",
+		"/health":         "/health",
+		"":                "",
+	} {
+		if got := Route(pattern); got != want {
+			t.Errorf("Route(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Package jaegerapi は Jaeger query サービスの HTTP API（/api/...）の型付きクライアント
+//
+// トレースをスパン・参照・タグまでデコードし、Expect でトレースの形
+// （"orchestrator → user-service → SELECT users" のような親子関係）を検証できる。
+package jaegerapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTraceNotFound is returned (wrapped) by Client.Trace when Jaeger does
+// not have the trace, e.g. because it has not been exported yet.
+var ErrTraceNotFound = errors.New("trace not found")
+
+// Error is a non-2xx response or an "errors" entry of the response body.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jaegerapi: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Reference types of Reference.Type.
+const (
+	ChildOf     = "CHILD_OF"
+	FollowsFrom = "FOLLOWS_FROM"
+)
+
+// Reference links a span to another span, usually its parent.
+type Reference struct {
+	Type    string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+// KeyValue is a span or process tag. Value is decoded from JSON, so it is a
+// string, bool or float64 whatever Type says.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// Process is the service that emitted a span.
+type Process struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []KeyValue `json:"tags"`
+}
+
+// Span is one span of a trace.
+type Span struct {
+	TraceID       string
+	SpanID        string
+	OperationName string
+	References    []Reference
+	StartTime     time.Time
+	Duration      time.Duration
+	Tags          []KeyValue
+	ProcessID     string
+	// Process は ProcessID をトレースの processes から引いたもの
+	Process *Process
+}
+
+func (s *Span) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		TraceID       string      `json:"traceID"`
+		SpanID        string      `json:"spanID"`
+		OperationName string      `json:"operationName"`
+		References    []Reference `json:"references"`
+		StartTime     int64       `json:"startTime"` // マイクロ秒
+		Duration      int64       `json:"duration"`  // マイクロ秒
+		Tags          []KeyValue  `json:"tags"`
+		ProcessID     string      `json:"processID"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Span{
+		TraceID:       raw.TraceID,
+		SpanID:        raw.SpanID,
+		OperationName: raw.OperationName,
+		References:    raw.References,
+		StartTime:     time.UnixMicro(raw.StartTime),
+		Duration:      time.Duration(raw.Duration) * time.Microsecond,
+		Tags:          raw.Tags,
+		ProcessID:     raw.ProcessID,
+	}
+	return nil
+}
+
+// Service returns the service name of the process that emitted the span.
+func (s *Span) Service() string {
+	if s.Process == nil {
+		return ""
+	}
+	return s.Process.ServiceName
+}
+
+// Tag returns the value of the span tag key.
+func (s *Span) Tag(key string) (any, bool) {
+	for _, kv := range s.Tags {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ParentSpanID returns the span ID of the first CHILD_OF reference, or ""
+// for a root span.
+func (s *Span) ParentSpanID() string {
+	for _, ref := range s.References {
+		if ref.Type == ChildOf {
+			return ref.SpanID
+		}
+	}
+	return ""
+}
+
+// Summary is a short description used to match spans: "<VERB> <table>" for
+// database spans (from the db.statement tag), the operation name otherwise.
+func (s *Span) Summary() string {
+	stmt, _ := s.Tag("db.statement")
+	if q, ok := stmt.(string); ok && q != "" {
+		return summarizeSQL(q)
+	}
+	return s.OperationName
+}
+
+// summarizeSQL は SQL 文を "SELECT users" のような動詞と最初のテーブル名に縮める
+func summarizeSQL(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	verb := strings.ToUpper(fields[0])
+	for i, f := range fields[:len(fields)-1] {
+		switch strings.ToUpper(f) {
+		case "FROM", "INTO", "UPDATE", "JOIN":
+			return verb + " " + strings.Trim(fields[i+1], `"();,`)
+		}
+	}
+	return verb
+}
+
+// Trace is a trace as returned by /api/traces/{id}.
+type Trace struct {
+	TraceID   string              `json:"traceID"`
+	Spans     []*Span             `json:"spans"`
+	Processes map[string]*Process `json:"processes"`
+}
+
+// resolve は各スパンの Process を埋める
+func (t *Trace) resolve() {
+	for _, s := range t.Spans {
+		s.Process = t.Processes[s.ProcessID]
+	}
+}
+
+// Span returns the span with the given ID.
+func (t *Trace) Span(spanID string) (*Span, bool) {
+	for _, s := range t.Spans {
+		if s.SpanID == spanID {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Roots returns the spans whose parent is not part of the trace. A trace
+// started from a propagated context has one root with a dangling parent.
+func (t *Trace) Roots() []*Span {
+	var roots []*Span
+	for _, s := range t.Spans {
+		if _, ok := t.Span(s.ParentSpanID()); !ok {
+			roots = append(roots, s)
+		}
+	}
+	return roots
+}
+
+// Children returns the direct children of parent in start-time order.
+func (t *Trace) Children(parent *Span) []*Span {
+	var children []*Span
+	for _, s := range t.Spans {
+		if s.ParentSpanID() == parent.SpanID {
+			children = append(children, s)
+		}
+	}
+	sortByStart(children)
+	return children
+}
+
+// Client calls the Jaeger query API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a client for the Jaeger query service at baseURL (e.g.
+// "http://localhost:16686"). A nil httpClient means http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+// Services returns the names of the services Jaeger has spans for.
+func (c *Client) Services(ctx context.Context) ([]string, error) {
+	var services []string
+	err := c.get(ctx, "/api/services", nil, &services)
+	return services, err
+}
+
+// Operations returns the operation names of service.
+func (c *Client) Operations(ctx context.Context, service string) ([]string, error) {
+	var operations []string
+	err := c.get(ctx, "/api/services/"+url.PathEscape(service)+"/operations", nil, &operations)
+	return operations, err
+}
+
+// Trace fetches one trace. It returns an error wrapping ErrTraceNotFound if
+// Jaeger does not have it.
+func (c *Client) Trace(ctx context.Context, traceID string) (*Trace, error) {
+	var traces []*Trace
+	err := c.get(ctx, "/api/traces/"+url.PathEscape(traceID), nil, &traces)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("jaegerapi: %s: %w", traceID, ErrTraceNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) == 0 {
+		return nil, fmt.Errorf("jaegerapi: %s: %w", traceID, ErrTraceNotFound)
+	}
+	traces[0].resolve()
+	return traces[0], nil
+}
+
+// Query selects traces for FindTraces. Service is required.
+type Query struct {
+	Service   string
+	Operation string
+	Tags      map[string]string
+	// Start と End の既定値は Jaeger に任せる（直近 1 時間）
+	Start, End time.Time
+	Limit      int
+}
+
+// FindTraces searches traces like the Jaeger UI search page.
+func (c *Client) FindTraces(ctx context.Context, q Query) ([]*Trace, error) {
+	if q.Service == "" {
+		return nil, errors.New("jaegerapi: find traces needs a service")
+	}
+	params := url.Values{"service": {q.Service}}
+	if q.Operation != "" {
+		params.Set("operation", q.Operation)
+	}
+	if len(q.Tags) > 0 {
+		tags, err := json.Marshal(q.Tags)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("tags", string(tags))
+	}
+	if !q.Start.IsZero() {
+		params.Set("start", strconv.FormatInt(q.Start.UnixMicro(), 10))
+	}
+	if !q.End.IsZero() {
+		params.Set("end", strconv.FormatInt(q.End.UnixMicro(), 10))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var traces []*Trace
+	if err := c.get(ctx, "/api/traces", params, &traces); err != nil {
+		return nil, err
+	}
+	for _, t := range traces {
+		t.resolve()
+	}
+	return traces, nil
+}
+
+// response は全エンドポイント共通のエンベロープ
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"errors"`
+}
+
+// get は path を呼び、data を out にデコードする。
+// 接続エラーはそのまま（*url.Error）、API のエラーは *Error で返す
+func (c *Client) get(ctx context.Context, path string, params url.Values, out any) error {
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+		return fmt.Errorf("jaegerapi: %s: decode response: %w", path, err)
+	}
+	if len(r.Errors) > 0 {
+		code := r.Errors[0].Code
+		if code == 0 {
+			code = resp.StatusCode
+		}
+		return &Error{StatusCode: code, Message: r.Errors[0].Msg}
+	}
+	if resp.StatusCode/100 != 2 {
+		return &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return fmt.Errorf("jaegerapi: %s: decode data: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package jaegerapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// profileTrace は orchestrator の GET /users/{id}/profile 1 回分を模したトレース。
+// ルートは otelcheck が traceparent で渡した（Jaeger にない）親を参照する
+const profileTrace = `{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spans":[
+	{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"a1","operationName":"GET /users/{id}/profile","references":[
+		{"refType":"CHILD_OF","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"ff"}],
+		"startTime":1700000000000000,"duration":52000,"processID":"p1","tags":[{"key":"span.kind","type":"string","value":"server"}]},
+	{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"a2","operationName":"HTTP GET","references":[
+		{"refType":"CHILD_OF","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"a1"}],
+		"startTime":1700000000001000,"duration":20000,"processID":"p1","tags":[]},
+	{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"b1","operationName":"GET /users/{id}","references":[
+		{"refType":"CHILD_OF","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"a2"}],
+		"startTime":1700000000002000,"duration":15000,"processID":"p2","tags":[{"key":"http.response.status_code","type":"int64","value":200}]},
+	{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"b2","operationName":"db.Query","references":[
+		{"refType":"CHILD_OF","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"b1"}],
+		"startTime":1700000000003000,"duration":4000,"processID":"p2","tags":[
+		{"key":"db.statement","type":"string","value":"SELECT id, name, email, created_at FROM users WHERE id = $1"}]}
+	],"processes":{"p1":{"serviceName":"orchestrator","tags":[]},"p2":{"serviceName":"user-service","tags":[]}}}`
+
+// fakeJaeger は path ごとに固定の応答を返す
+func fakeJaeger(t *testing.T, responses map[string]string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		body, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":404,"msg":"trace not found"}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", srv.Client())
+}
+
+func TestTraceDecodesSpans(t *testing.T) {
+	c := fakeJaeger(t, map[string]string{
+		"/api/traces/" + traceID: `{"data":[` + profileTrace + `],"errors":null}`,
+	})
+
+	tr, err := c.Trace(context.Background(), traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Spans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(tr.Spans))
+	}
+	query, _ := tr.Span("b2")
+	if query.Service() != "user-service" || query.ParentSpanID() != "b1" || query.Summary() != "SELECT users" {
+		t.Errorf("query span = %s, parent %s, summary %q", query.Service(), query.ParentSpanID(), query.Summary())
+	}
+	if query.Duration != 4*time.Millisecond || !query.StartTime.Equal(time.UnixMicro(1700000000003000)) {
+		t.Errorf("timing = %s at %s", query.Duration, query.StartTime)
+	}
+	server, _ := tr.Span("b1")
+	if v, ok := server.Tag("http.response.status_code"); !ok || v != float64(200) {
+		t.Errorf("status tag = %v, %v", v, ok)
+	}
+}
+
+func TestTraceNotFound(t *testing.T) {
+	c := fakeJaeger(t, nil)
+	_, err := c.Trace(context.Background(), traceID)
+	if !errors.Is(err, ErrTraceNotFound) {
+		t.Errorf("err = %v, want ErrTraceNotFound", err)
+	}
+}
+
+func TestServicesAndFindTraces(t *testing.T) {
+	c := fakeJaeger(t, map[string]string{
+		"/api/services": `{"data":["orchestrator","user-service"],"total":2}`,
+		"/api/traces?limit=5&service=user-service&tags=%7B%22http.route%22%3A%22%2Fusers%22%7D": `{"data":[` + profileTrace + `]}`,
+	})
+
+	services, err := c.Services(context.Background())
+	if err != nil || strings.Join(services, ",") != "orchestrator,user-service" {
+		t.Errorf("services = %v, %v", services, err)
+	}
+
+	traces, err := c.FindTraces(context.Background(), Query{Service: "user-service", Tags: map[string]string{"http.route": "/users"}, Limit: 5})
+	if err != nil || len(traces) != 1 || traces[0].Spans[0].Service() != "orchestrator" {
+		t.Errorf("traces = %v, %v", traces, err)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	c := fakeJaeger(t, map[string]string{
+		"/api/services": `{"data":null,"errors":[{"code":500,"msg":"storage unavailable"}]}`,
+	})
+	_, err := c.Services(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 500 || apiErr.Message != "storage unavailable" {
+		t.Errorf("err = %v, want a 500 *Error", err)
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, err = New(srv.URL, nil).Services(context.Background())
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("err = %v, want a *url.Error", err)
+	}
+}
+
+func decodeTrace(t *testing.T, raw string) *Trace {
+	t.Helper()
+	c := fakeJaeger(t, map[string]string{"/api/traces/" + traceID: `{"data":[` + raw + `]}`})
+	tr, err := c.Trace(context.Background(), traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestExpect(t *testing.T) {
+	tr := decodeTrace(t, profileTrace)
+
+	if err := tr.Expect("orchestrator → user-service → SELECT users", "GET /users/{id}/profile -> db.Query"); err != nil {
+		t.Errorf("Expect: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"orchestrator → post-service → SELECT posts", `found orchestrator, but no "post-service" below it`},
+		{"user-service → orchestrator", `found user-service, but no "orchestrator" below it`},
+		{"comment-service", `no span matches "comment-service"`},
+	}
+	for _, tt := range tests {
+		err := tr.Expect(tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expect(%q) = %v, want %q", tt.path, err, tt.want)
+			continue
+		}
+		// 失敗時はスパンツリーを添える
+		if !strings.Contains(err.Error(), "\n      user-service: db.Query [SELECT users] (4ms)\n") {
+			t.Errorf("Expect(%q) error lacks the span tree:\n%v", tt.path, err)
+		}
+	}
+
+	if _, err := ParsePath("orchestrator → → db.Query"); err == nil {
+		t.Error("ParsePath accepted an empty step")
+	}
+}
+
+func TestExpectRequiresOneConnectedTrace(t *testing.T) {
+	// user-service のサーバースパンが別トレースの親を参照している（伝播の失敗）
+	broken := strings.Replace(profileTrace,
+		`{"refType":"CHILD_OF","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"a2"}`,
+		`{"refType":"CHILD_OF","traceID":"00000000000000000000000000000001","spanID":"c9"}`, 1)
+	tr := decodeTrace(t, broken)
+
+	err := tr.Expect()
+	if err == nil {
+		t.Fatal("Expect accepted a trace with two roots")
+	}
+	for _, want := range []string{"references trace 00000000000000000000000000000001", "trace has 2 roots"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestSummarizeSQL(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT COUNT(*) FROM users":                 "SELECT users",
+		"select * from posts where user_id = $1":     "SELECT posts",
+		"INSERT INTO comments (post_id) VALUES ($1)": "INSERT comments",
+		"UPDATE users SET name = $1":                 "UPDATE users",
+		`DELETE FROM "users" WHERE id = $1`:          "DELETE users",
+		"BEGIN":                                      "BEGIN",
+	} {
+		if got := summarizeSQL(query); got != want {
+			t.Errorf("summarizeSQL(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
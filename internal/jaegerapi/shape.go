@@ -0,0 +1,142 @@
+package jaegerapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Path is a parsed trace-shape assertion: every step must match a
+// descendant (not necessarily a direct child) of the span matched by the
+// previous step.
+//
+// A step matches a span when it equals the span's service name, operation
+// name or Summary, so "orchestrator → user-service → SELECT users" reads as
+// "an orchestrator span, below it a user-service span, below that a query on
+// the users table".
+type Path []string
+
+// ParsePath parses steps separated by "→" or "->".
+func ParsePath(s string) (Path, error) {
+	var p Path
+	for _, step := range strings.Split(strings.ReplaceAll(s, "->", "→"), "→") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			return nil, fmt.Errorf("jaegerapi: path %q has an empty step", s)
+		}
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+func (p Path) String() string { return strings.Join(p, " → ") }
+
+// matches は step がスパンのサービス名・操作名・要約のいずれかと一致するか
+func matches(step string, s *Span) bool {
+	return step == s.Service() || step == s.OperationName || step == s.Summary()
+}
+
+// Connected reports whether every span carries the trace's ID, every
+// reference points into the trace and the spans form a single tree. The
+// root may reference a parent outside the trace (a propagated context).
+func (t *Trace) Connected() error {
+	var errs []error
+	for _, s := range t.Spans {
+		if s.TraceID != t.TraceID {
+			errs = append(errs, fmt.Errorf("span %s (%s) has trace ID %s, want %s", s.SpanID, describe(s), s.TraceID, t.TraceID))
+		}
+		for _, ref := range s.References {
+			if ref.TraceID != t.TraceID {
+				errs = append(errs, fmt.Errorf("span %s (%s) references trace %s", s.SpanID, describe(s), ref.TraceID))
+			}
+		}
+	}
+	if roots := t.Roots(); len(roots) != 1 {
+		names := make([]string, len(roots))
+		for i, r := range roots {
+			names[i] = describe(r)
+		}
+		errs = append(errs, fmt.Errorf("trace has %d roots, want 1: %s", len(roots), strings.Join(names, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// Expect checks that the trace is Connected and contains every path
+// (see Path). The error lists the failed paths and the span tree.
+func (t *Trace) Expect(paths ...string) error {
+	var errs []error
+	if err := t.Connected(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, raw := range paths {
+		p, err := ParsePath(raw)
+		if err != nil {
+			return err
+		}
+		if matched := t.longestMatch(p); matched < len(p) {
+			if matched == 0 {
+				errs = append(errs, fmt.Errorf("%s: no span matches %q", p, p[0]))
+			} else {
+				errs = append(errs, fmt.Errorf("%s: found %s, but no %q below it", p, p[:matched], p[matched]))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("trace %s does not have the expected shape: %w\n%s", t.TraceID, errors.Join(errs...), t.Tree())
+	}
+	return nil
+}
+
+// longestMatch は p の先頭から何ステップまで親子関係をたどれたかを返す
+func (t *Trace) longestMatch(p Path) int {
+	best := 0
+	var walk func(s *Span, step int)
+	walk = func(s *Span, step int) {
+		if step == len(p) {
+			return
+		}
+		if matches(p[step], s) {
+			step++
+			best = max(best, step)
+		}
+		for _, c := range t.Children(s) {
+			walk(c, step)
+		}
+	}
+	for _, r := range t.Roots() {
+		walk(r, 0)
+	}
+	return best
+}
+
+// Tree renders the spans as an indented tree, one "service: operation" per
+// line, for error messages and CLI output.
+func (t *Trace) Tree() string {
+	var b strings.Builder
+	var walk func(s *Span, depth int)
+	walk = func(s *Span, depth int) {
+		fmt.Fprintf(&b, "%s%s (%s)\n", strings.Repeat("  ", depth), describe(s), s.Duration)
+		for _, c := range t.Children(s) {
+			walk(c, depth+1)
+		}
+	}
+	roots := t.Roots()
+	sortByStart(roots)
+	for _, r := range roots {
+		walk(r, 0)
+	}
+	return b.String()
+}
+
+func describe(s *Span) string {
+	d := s.Service() + ": " + s.OperationName
+	if summary := s.Summary(); summary != s.OperationName {
+		d += " [" + summary + "]"
+	}
+	return d
+}
+
+func sortByStart(spans []*Span) {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTime.Before(spans[j].StartTime) })
+}
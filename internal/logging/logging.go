@@ -0,0 +1,175 @@
+// Package logging は log/slog のレコードをトレースと結び付けるハンドラを提供するパッケージ
+//
+// 各レコードはコンテキストのスパンの trace_id・span_id を付けて人が読める形で書き出し、
+// 同時に OpenTelemetry のログレコードとして LoggerProvider（OTLP でコレクター）に送る。
+// Exemplar がメトリクスとトレースを結ぶのと同じく、trace_id がログとトレースを結ぶ。
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName は OTel のログレコードの計装スコープ名
+const instrumentationName = "otel-playground/internal/logging"
+
+// Keys of the trace correlation attributes added to the text output.
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// Options configures the handler returned by NewHandler.
+type Options struct {
+	// Writer receives a human-readable copy of every record. Defaults to
+	// os.Stderr.
+	Writer io.Writer
+	// Level is the minimum level handled. Defaults to slog.LevelInfo.
+	Level slog.Leveler
+	// LoggerProvider receives every record as an OpenTelemetry log record,
+	// correlated with the span in the record's context. When nil, records
+	// are only written to Writer.
+	LoggerProvider otellog.LoggerProvider
+}
+
+// handler は書き出し用の TextHandler と OTel の Logger の両方にレコードを渡す
+type handler struct {
+	text   slog.Handler
+	logger otellog.Logger
+	level  slog.Leveler
+
+	// OTel 側は WithGroup をキーの接頭辞、WithAttrs を変換済みの属性として持っておく
+	prefix string
+	attrs  []otellog.KeyValue
+}
+
+// NewHandler returns a slog.Handler that adds trace_id and span_id from the
+// context to each record and forwards it to opts.LoggerProvider. Use the
+// *Context logging functions (slog.InfoContext, ...) inside requests so the
+// record is linked to the request's trace.
+func NewHandler(opts Options) slog.Handler {
+	if opts.Writer == nil {
+		opts.Writer = os.Stderr
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	h := &handler{
+		text:  slog.NewTextHandler(opts.Writer, &slog.HandlerOptions{Level: opts.Level}),
+		level: opts.Level,
+	}
+	if opts.LoggerProvider != nil {
+		h.logger = opts.LoggerProvider.Logger(instrumentationName)
+	}
+	return h
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.logger != nil {
+		// OTel のレコードには SDK が ctx のスパンから trace_id・span_id を付ける
+		h.logger.Emit(ctx, h.convert(r))
+	}
+
+	if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String(TraceIDKey, sc.TraceID().String()),
+			slog.String(SpanIDKey, sc.SpanID().String()),
+		)
+	}
+	return h.text.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.text = h.text.WithAttrs(attrs)
+	c.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], convertAttrs(h.prefix, attrs)...)
+	return &c
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.text = h.text.WithGroup(name)
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// convert は slog のレコードを OTel のログレコードに変換する
+func (h *handler) convert(r slog.Record) otellog.Record {
+	var rec otellog.Record
+	rec.SetTimestamp(r.Time)
+	rec.SetBody(otellog.StringValue(r.Message))
+	rec.SetSeverity(severity(r.Level))
+	rec.SetSeverityText(r.Level.String())
+	rec.AddAttributes(h.attrs...)
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	rec.AddAttributes(convertAttrs(h.prefix, attrs)...)
+	return rec
+}
+
+// severity は slog のレベルを OTel の重大度に対応付ける（Debug=5, Info=9, Warn=13, Error=17）
+func severity(level slog.Level) otellog.Severity {
+	return otellog.Severity(int(level) + int(otellog.SeverityInfo))
+}
+
+func convertAttrs(prefix string, attrs []slog.Attr) []otellog.KeyValue {
+	kvs := make([]otellog.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		// slog と同じく空の属性は無視する
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		if a.Value.Kind() == slog.KindGroup && a.Key == "" {
+			// キーの無いグループは中身をそのまま展開する
+			kvs = append(kvs, convertAttrs(prefix, a.Value.Group())...)
+			continue
+		}
+		kvs = append(kvs, otellog.KeyValue{Key: prefix + a.Key, Value: convertValue(a.Value)})
+	}
+	return kvs
+}
+
+func convertValue(v slog.Value) otellog.Value {
+	switch v.Kind() {
+	case slog.KindString:
+		return otellog.StringValue(v.String())
+	case slog.KindInt64:
+		return otellog.Int64Value(v.Int64())
+	case slog.KindUint64:
+		return otellog.Int64Value(int64(v.Uint64()))
+	case slog.KindFloat64:
+		return otellog.Float64Value(v.Float64())
+	case slog.KindBool:
+		return otellog.BoolValue(v.Bool())
+	case slog.KindDuration:
+		return otellog.StringValue(v.Duration().String())
+	case slog.KindTime:
+		return otellog.StringValue(v.Time().Format(time.RFC3339Nano))
+	case slog.KindGroup:
+		return otellog.MapValue(convertAttrs("", v.Group())...)
+	}
+	if err, ok := v.Any().(error); ok {
+		return otellog.StringValue(err.Error())
+	}
+	return otellog.StringValue(fmt.Sprint(v.Any()))
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// memoryExporter はエクスポートされたログレコードを保持する
+type memoryExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *memoryExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error   { return nil }
+func (e *memoryExporter) ForceFlush(context.Context) error { return nil }
+
+func newTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer, *memoryExporter) {
+	t.Helper()
+	exporter := &memoryExporter{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	var buf bytes.Buffer
+	return slog.New(NewHandler(Options{Writer: &buf, LoggerProvider: provider})), &buf, exporter
+}
+
+func attrs(r sdklog.Record) map[string]otellog.Value {
+	m := map[string]otellog.Value{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		m[kv.Key] = kv.Value
+		return true
+	})
+	return m
+}
+
+func TestRecordsAreCorrelatedWithTheSpan(t *testing.T) {
+	h := telemetrytest.New(t)
+	logger, buf, exporter := newTestLogger(t)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "GET /users/{id}")
+	logger.WarnContext(ctx, "🐌 Slow request detected", "http.route", "/users/{id}", "status", 200)
+	span.End()
+	sc := h.Span(t, "GET /users/{id}").SpanContext
+
+	text := buf.String()
+	for _, want := range []string{"level=WARN", `msg="🐌 Slow request detected"`, "trace_id=" + sc.TraceID().String(), "span_id=" + sc.SpanID().String()} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output lacks %q: %s", want, text)
+		}
+	}
+
+	if len(exporter.records) != 1 {
+		t.Fatalf("exported %d records, want 1", len(exporter.records))
+	}
+	r := exporter.records[0]
+	if r.TraceID() != sc.TraceID() || r.SpanID() != sc.SpanID() {
+		t.Errorf("record trace = %v/%v, want %v/%v", r.TraceID(), r.SpanID(), sc.TraceID(), sc.SpanID())
+	}
+	if r.Body().AsString() != "🐌 Slow request detected" || r.Severity() != otellog.SeverityWarn || r.SeverityText() != "WARN" {
+		t.Errorf("record = %q %v %q", r.Body().AsString(), r.Severity(), r.SeverityText())
+	}
+	got := attrs(r)
+	if got["http.route"].AsString() != "/users/{id}" || got["status"].AsInt64() != 200 {
+		t.Errorf("attributes = %v", got)
+	}
+	// OTel のレコードはトレースとの対応を属性ではなく trace_id フィールドで持つ
+	if _, ok := got[TraceIDKey]; ok {
+		t.Errorf("trace_id duplicated as an attribute: %v", got)
+	}
+}
+
+func TestRecordsWithoutSpanAndLevels(t *testing.T) {
+	logger, buf, exporter := newTestLogger(t)
+
+	logger.Debug("dropped below the default level")
+	logger.Error("failed to encode response", "error", errors.New("broken pipe"))
+
+	if strings.Contains(buf.String(), "dropped") || strings.Contains(buf.String(), "trace_id") {
+		t.Errorf("text output = %s", buf.String())
+	}
+	if len(exporter.records) != 1 {
+		t.Fatalf("exported %d records, want 1", len(exporter.records))
+	}
+	r := exporter.records[0]
+	if r.TraceID().IsValid() || r.Severity() != otellog.SeverityError {
+		t.Errorf("record trace = %v, severity = %v", r.TraceID(), r.Severity())
+	}
+	if got := attrs(r)["error"].AsString(); got != "broken pipe" {
+		t.Errorf("error = %q, want broken pipe", got)
+	}
+}
+
+func TestGroupsAndAttrs(t *testing.T) {
+	logger, buf, exporter := newTestLogger(t)
+
+	logger.With("server", "user-service").WithGroup("shutdown").Info("🛑 Draining",
+		slog.Duration("delay", 0), slog.Group("requests", "in_flight", 2))
+
+	if !strings.Contains(buf.String(), "server=user-service shutdown.delay=0s shutdown.requests.in_flight=2") {
+		t.Errorf("text output = %s", buf.String())
+	}
+	got := attrs(exporter.records[0])
+	if got["server"].AsString() != "user-service" || got["shutdown.delay"].AsString() != "0s" {
+		t.Errorf("attributes = %v", got)
+	}
+	if requests := got["shutdown.requests"]; requests.Kind() != otellog.KindMap || requests.AsMap()[0].Value.AsInt64() != 2 {
+		t.Errorf("shutdown.requests = %v, want a map with in_flight=2", requests)
+	}
+}
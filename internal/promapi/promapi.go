@@ -0,0 +1,299 @@
+// Package promapi は Prometheus HTTP API（/api/v1）の型付きクライアント
+//
+// instant/range クエリ、ラベル値、シリーズ、エクスペンプラーを扱う。
+// API が返す "status":"error" は *Error に、"warnings" は戻り値の Warnings に変換する。
+package promapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels is a label set of a series or exemplar.
+type Labels map[string]string
+
+// Point is one (timestamp, value) pair. Prometheus encodes it as
+// [<unix seconds>, "<value>"].
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var raw [2]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("promapi: point: %w", err)
+	}
+	var ts float64
+	if err := json.Unmarshal(raw[0], &ts); err != nil {
+		return fmt.Errorf("promapi: point timestamp: %w", err)
+	}
+	var value string
+	if err := json.Unmarshal(raw[1], &value); err != nil {
+		return fmt.Errorf("promapi: point value: %w", err)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("promapi: point value %q: %w", value, err)
+	}
+	p.Time, p.Value = unixSeconds(ts), v
+	return nil
+}
+
+// Sample is one element of an instant vector.
+type Sample struct {
+	Metric Labels `json:"metric"`
+	Point  Point  `json:"value"`
+}
+
+// Series is one element of a range vector (matrix).
+type Series struct {
+	Metric Labels  `json:"metric"`
+	Points []Point `json:"values"`
+}
+
+// ResultType is the "resultType" of a query.
+type ResultType string
+
+const (
+	ResultVector ResultType = "vector"
+	ResultMatrix ResultType = "matrix"
+	ResultScalar ResultType = "scalar"
+	ResultString ResultType = "string"
+)
+
+// QueryResult is the result of an instant query. Only the field matching
+// Type is set.
+type QueryResult struct {
+	Type   ResultType
+	Vector []Sample
+	Matrix []Series
+	Scalar Point
+	String string
+}
+
+func (r *QueryResult) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ResultType ResultType      `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Type = raw.ResultType
+	switch raw.ResultType {
+	case ResultVector:
+		return json.Unmarshal(raw.Result, &r.Vector)
+	case ResultMatrix:
+		return json.Unmarshal(raw.Result, &r.Matrix)
+	case ResultScalar:
+		return json.Unmarshal(raw.Result, &r.Scalar)
+	case ResultString:
+		// 文字列は [<ts>, "<value>"] で値を数値にできないため個別に読む
+		var pair [2]json.RawMessage
+		if err := json.Unmarshal(raw.Result, &pair); err != nil {
+			return err
+		}
+		return json.Unmarshal(pair[1], &r.String)
+	default:
+		return fmt.Errorf("promapi: unknown result type %q", raw.ResultType)
+	}
+}
+
+// Exemplar is one exemplar returned by query_exemplars.
+type Exemplar struct {
+	Labels    Labels
+	Value     float64
+	Timestamp time.Time
+}
+
+func (e *Exemplar) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Labels    Labels  `json:"labels"`
+		Value     string  `json:"value"`
+		Timestamp float64 `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(raw.Value, 64)
+	if err != nil {
+		return fmt.Errorf("promapi: exemplar value %q: %w", raw.Value, err)
+	}
+	e.Labels, e.Value, e.Timestamp = raw.Labels, v, unixSeconds(raw.Timestamp)
+	return nil
+}
+
+// TraceID returns the exemplar's trace_id label.
+func (e Exemplar) TraceID() string { return e.Labels["trace_id"] }
+
+// ExemplarSeries is the exemplars of one series.
+type ExemplarSeries struct {
+	SeriesLabels Labels     `json:"seriesLabels"`
+	Exemplars    []Exemplar `json:"exemplars"`
+}
+
+// Warnings are non-fatal messages returned alongside a successful result,
+// e.g. when a query hit a partial response.
+type Warnings []string
+
+// Error is a response with "status":"error".
+type Error struct {
+	StatusCode int
+	Type       string // bad_data, execution, timeout, ...
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("promapi: %s (HTTP %d): %s", e.Type, e.StatusCode, e.Message)
+}
+
+// Client calls the Prometheus HTTP API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a client for the Prometheus server at baseURL (e.g.
+// "http://localhost:9090"). A nil httpClient means http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+// Query evaluates an instant query at ts. A zero ts means the server's now.
+func (c *Client) Query(ctx context.Context, query string, ts time.Time) (QueryResult, Warnings, error) {
+	params := url.Values{"query": {query}}
+	setTime(params, "time", ts)
+	var result QueryResult
+	warnings, err := c.get(ctx, "/api/v1/query", params, &result)
+	return result, warnings, err
+}
+
+// Range is the time range and resolution of QueryRange.
+type Range struct {
+	Start, End time.Time
+	Step       time.Duration
+}
+
+// QueryRange evaluates a range query.
+func (c *Client) QueryRange(ctx context.Context, query string, r Range) ([]Series, Warnings, error) {
+	if r.Step <= 0 {
+		return nil, nil, errors.New("promapi: range step must be positive")
+	}
+	params := url.Values{
+		"query": {query},
+		"step":  {strconv.FormatFloat(r.Step.Seconds(), 'f', -1, 64)},
+	}
+	setTime(params, "start", r.Start)
+	setTime(params, "end", r.End)
+	var result QueryResult
+	warnings, err := c.get(ctx, "/api/v1/query_range", params, &result)
+	if err == nil && result.Type != ResultMatrix {
+		err = fmt.Errorf("promapi: query_range returned %s, want matrix", result.Type)
+	}
+	return result.Matrix, warnings, err
+}
+
+// LabelValues returns the values of label, optionally restricted to the
+// series selected by matches and to [start, end] (zero means unbounded).
+func (c *Client) LabelValues(ctx context.Context, label string, matches []string, start, end time.Time) ([]string, Warnings, error) {
+	params := url.Values{"match[]": matches}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+	var values []string
+	warnings, err := c.get(ctx, "/api/v1/label/"+url.PathEscape(label)+"/values", params, &values)
+	return values, warnings, err
+}
+
+// Series returns the label sets of the series selected by matches.
+func (c *Client) Series(ctx context.Context, matches []string, start, end time.Time) ([]Labels, Warnings, error) {
+	if len(matches) == 0 {
+		return nil, nil, errors.New("promapi: series needs at least one match[] selector")
+	}
+	params := url.Values{"match[]": matches}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+	var series []Labels
+	warnings, err := c.get(ctx, "/api/v1/series", params, &series)
+	return series, warnings, err
+}
+
+// QueryExemplars returns the exemplars of the series selected by query in
+// [start, end] (zero means unbounded).
+func (c *Client) QueryExemplars(ctx context.Context, query string, start, end time.Time) ([]ExemplarSeries, Warnings, error) {
+	params := url.Values{"query": {query}}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+	var series []ExemplarSeries
+	warnings, err := c.get(ctx, "/api/v1/query_exemplars", params, &series)
+	return series, warnings, err
+}
+
+// response は全エンドポイント共通のエンベロープ
+type response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  Warnings        `json:"warnings"`
+}
+
+// get は path を呼び、data を out にデコードする。
+// 接続エラーはそのまま（*url.Error）、API のエラーは *Error で返す
+func (c *Client) get(ctx context.Context, path string, params url.Values, out any) (Warnings, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		// プロキシのエラーページなど JSON でない応答
+		if resp.StatusCode/100 != 2 {
+			return nil, &Error{StatusCode: resp.StatusCode, Type: "http", Message: strings.TrimSpace(string(body))}
+		}
+		return nil, fmt.Errorf("promapi: %s: decode response: %w", path, err)
+	}
+	if r.Status != "success" {
+		if r.ErrorType == "" && r.Error == "" {
+			r.ErrorType, r.Error = "http", fmt.Sprintf("unexpected status %q", r.Status)
+		}
+		return r.Warnings, &Error{StatusCode: resp.StatusCode, Type: r.ErrorType, Message: r.Error}
+	}
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return r.Warnings, fmt.Errorf("promapi: %s: decode data: %w", path, err)
+	}
+	return r.Warnings, nil
+}
+
+func setTime(params url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		params.Set(key, strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64))
+	}
+}
+
+func unixSeconds(ts float64) time.Time {
+	whole, frac := math.Modf(ts)
+	return time.Unix(int64(whole), int64(math.Round(frac*1e3))*1e6)
+}
@@ -0,0 +1,171 @@
+package promapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakePrometheus は path ごとに固定の応答を返し、受け取ったクエリを記録する
+func fakePrometheus(t *testing.T, responses map[string]string) (*Client, *url.Values) {
+	t.Helper()
+
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if body[:20] == `{"status":"error","e` {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", srv.Client()), &got
+}
+
+func TestQueryVector(t *testing.T) {
+	c, got := fakePrometheus(t, map[string]string{
+		"/api/v1/query": `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"otel-collector"},"value":[1700000000.5,"1"]}]},
+			"warnings":["partial response"]}`,
+	})
+
+	at := time.Unix(1700000000, 0)
+	result, warnings, err := c.Query(context.Background(), "up", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("query") != "up" || got.Get("time") != "1700000000" {
+		t.Errorf("params = %v", *got)
+	}
+	if len(warnings) != 1 || warnings[0] != "partial response" {
+		t.Errorf("warnings = %v", warnings)
+	}
+	if result.Type != ResultVector || len(result.Vector) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	s := result.Vector[0]
+	if s.Metric["job"] != "otel-collector" || s.Point.Value != 1 || !s.Point.Time.Equal(time.Unix(1700000000, 500e6)) {
+		t.Errorf("sample = %+v", s)
+	}
+}
+
+func TestQueryScalarAndString(t *testing.T) {
+	c, _ := fakePrometheus(t, map[string]string{
+		"/api/v1/query": `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"NaN"]}}`,
+	})
+	result, _, err := c.Query(context.Background(), "scalar(up)", time.Time{})
+	if err != nil || result.Type != ResultScalar || result.Scalar.Value == result.Scalar.Value {
+		t.Errorf("scalar = %+v, %v (want NaN)", result, err)
+	}
+
+	c, _ = fakePrometheus(t, map[string]string{
+		"/api/v1/query": `{"status":"success","data":{"resultType":"string","result":[1700000000,"hello"]}}`,
+	})
+	result, _, err = c.Query(context.Background(), `"hello"`, time.Time{})
+	if err != nil || result.Type != ResultString || result.String != "hello" {
+		t.Errorf("string = %+v, %v", result, err)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	c, got := fakePrometheus(t, map[string]string{
+		"/api/v1/query_range": `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"http_route":"/users/{id}"},"values":[[1700000000,"0.1"],[1700000015,"0.25"]]}]}}`,
+	})
+
+	start := time.Unix(1700000000, 0)
+	series, _, err := c.QueryRange(context.Background(), "rate(x[1m])", Range{Start: start, End: start.Add(time.Minute), Step: 15 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("start") != "1700000000" || got.Get("end") != "1700000060" || got.Get("step") != "15" {
+		t.Errorf("params = %v", *got)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 || series[0].Points[1].Value != 0.25 {
+		t.Errorf("series = %+v", series)
+	}
+
+	if _, _, err := c.QueryRange(context.Background(), "x", Range{}); err == nil {
+		t.Error("QueryRange without a step succeeded")
+	}
+}
+
+func TestLabelValuesAndSeries(t *testing.T) {
+	c, got := fakePrometheus(t, map[string]string{
+		"/api/v1/label/__name__/values": `{"status":"success","data":["microservices_user_service_requests_total","up"]}`,
+		"/api/v1/series":                `{"status":"success","data":[{"__name__":"up","job":"otel-collector"}]}`,
+	})
+
+	values, _, err := c.LabelValues(context.Background(), "__name__", []string{`{job="otel-collector"}`}, time.Time{}, time.Time{})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("values = %v, %v", values, err)
+	}
+	if got.Get("match[]") != `{job="otel-collector"}` || got.Has("start") {
+		t.Errorf("params = %v", *got)
+	}
+
+	series, _, err := c.Series(context.Background(), []string{"up"}, time.Time{}, time.Time{})
+	if err != nil || len(series) != 1 || series[0]["job"] != "otel-collector" {
+		t.Errorf("series = %v, %v", series, err)
+	}
+	if _, _, err := c.Series(context.Background(), nil, time.Time{}, time.Time{}); err == nil {
+		t.Error("Series without selectors succeeded")
+	}
+}
+
+func TestQueryExemplars(t *testing.T) {
+	c, _ := fakePrometheus(t, map[string]string{
+		"/api/v1/query_exemplars": `{"status":"success","data":[{"seriesLabels":{"http_route":"/users"},"exemplars":[
+			{"labels":{"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"},"value":"2.004","timestamp":1700000000.123}]}]}`,
+	})
+
+	series, _, err := c.QueryExemplars(context.Background(), "x", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := series[0].Exemplars[0]
+	if e.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" || e.Value != 2.004 || !e.Timestamp.Equal(time.Unix(1700000000, 123e6)) {
+		t.Errorf("exemplar = %+v", e)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := fakePrometheus(t, map[string]string{
+		"/api/v1/query": `{"status":"error","errorType":"bad_data","error":"1:5: parse error: unexpected end of input","warnings":["w"]}`,
+	})
+
+	_, warnings, err := c.Query(context.Background(), "sum(", time.Time{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Type != "bad_data" || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want a bad_data *Error", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want them returned with the error", warnings)
+	}
+
+	// JSON でない応答（パスの間違いやプロキシのエラーページ）
+	_, _, err = c.QueryExemplars(context.Background(), "x", time.Time{}, time.Time{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v, want a 404 *Error", err)
+	}
+
+	// 接続できない場合は *url.Error のまま返す
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, _, err = New(srv.URL, nil).Query(context.Background(), "up", time.Time{})
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("err = %v, want a *url.Error", err)
+	}
+}
@@ -0,0 +1,108 @@
+package promtext
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Bucket is one cumulative histogram bucket.
+type Bucket struct {
+	UpperBound float64 // math.Inf(1) for le="+Inf"
+	Count      float64
+	Exemplar   *Exemplar
+}
+
+// Histogram is one series of a histogram family: the buckets, _count and
+// _sum that share the same labels apart from le.
+type Histogram struct {
+	Labels   Labels
+	Buckets  []Bucket // sorted by UpperBound
+	Count    float64
+	Sum      float64
+	HasCount bool
+	HasSum   bool
+}
+
+// Bucket returns the bucket with the given upper bound.
+func (h Histogram) Bucket(le float64) (Bucket, bool) {
+	for _, b := range h.Buckets {
+		if b.UpperBound == le {
+			return b, true
+		}
+	}
+	return Bucket{}, false
+}
+
+// Histograms groups the samples of a histogram or gauge histogram family
+// by series. It fails if a bucket has no valid le label.
+func (f *Family) Histograms() ([]Histogram, error) {
+	if f.Type != TypeHistogram && f.Type != TypeGaugeHistogram {
+		return nil, fmt.Errorf("promtext: %s is a %s, not a histogram", f.Name, f.Type)
+	}
+
+	bySeries := map[string]*Histogram{}
+	var order []string
+	series := func(labels Labels) *Histogram {
+		key := labels.String()
+		h, ok := bySeries[key]
+		if !ok {
+			h = &Histogram{Labels: labels}
+			bySeries[key] = h
+			order = append(order, key)
+		}
+		return h
+	}
+
+	for _, s := range f.Samples {
+		switch s.Name {
+		case f.Name + "_bucket":
+			le, ok := s.Labels["le"]
+			if !ok {
+				return nil, fmt.Errorf("promtext: %s bucket without le label", f.Name)
+			}
+			bound, err := parseFloat(le)
+			if err != nil {
+				return nil, fmt.Errorf("promtext: %s bucket: le %w", f.Name, err)
+			}
+			h := series(s.Labels.without("le"))
+			h.Buckets = append(h.Buckets, Bucket{UpperBound: bound, Count: s.Value, Exemplar: s.Exemplar})
+		case f.Name + "_count", f.Name + "_gcount":
+			h := series(s.Labels)
+			h.Count, h.HasCount = s.Value, true
+		case f.Name + "_sum", f.Name + "_gsum":
+			h := series(s.Labels)
+			h.Sum, h.HasSum = s.Value, true
+		}
+	}
+
+	out := make([]Histogram, 0, len(order))
+	for _, key := range order {
+		h := bySeries[key]
+		sort.SliceStable(h.Buckets, func(i, j int) bool { return h.Buckets[i].UpperBound < h.Buckets[j].UpperBound })
+		out = append(out, *h)
+	}
+	return out, nil
+}
+
+// Validate checks the invariants of a histogram series: a +Inf bucket,
+// non-decreasing cumulative counts, and _count equal to the +Inf bucket.
+func (h Histogram) Validate() error {
+	if len(h.Buckets) == 0 {
+		return fmt.Errorf("promtext: histogram %s has no buckets", h.Labels)
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i].Count < h.Buckets[i-1].Count {
+			return fmt.Errorf("promtext: histogram %s: bucket le=%g count %g is less than le=%g count %g",
+				h.Labels, h.Buckets[i].UpperBound, h.Buckets[i].Count, h.Buckets[i-1].UpperBound, h.Buckets[i-1].Count)
+		}
+	}
+	inf := h.Buckets[len(h.Buckets)-1]
+	if !math.IsInf(inf.UpperBound, 1) {
+		return fmt.Errorf("promtext: histogram %s has no +Inf bucket", h.Labels)
+	}
+	if h.HasCount && h.Count != inf.Count {
+		return fmt.Errorf("promtext: histogram %s: _count %g differs from the +Inf bucket %g", h.Labels, h.Count, inf.Count)
+	}
+	return nil
+}
@@ -0,0 +1,532 @@
+// Package promtext は Prometheus テキスト形式と OpenMetrics 形式のパーサー
+//
+// Collector の Prometheus エクスポーター（:8889/metrics）の出力を
+// メトリクスファミリー・ラベル・ヒストグラムのバケット・エクスペンプラーの
+// 型付きの構造体に変換し、バケットの件数やエクスペンプラーの値を正確に検証できるようにする。
+package promtext
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the exposition format of a scrape.
+type Format int
+
+const (
+	// FormatText is the Prometheus text format 0.0.4.
+	FormatText Format = iota
+	// FormatOpenMetrics is OpenMetrics 1.0, which adds units, exemplars and
+	// the trailing "# EOF".
+	FormatOpenMetrics
+)
+
+// ContentTypeOpenMetrics is the media type of FormatOpenMetrics.
+const ContentTypeOpenMetrics = "application/openmetrics-text"
+
+// FormatFor returns the format named by a Content-Type header. Anything
+// that is not OpenMetrics is treated as the text format.
+func FormatFor(contentType string) Format {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == ContentTypeOpenMetrics {
+		return FormatOpenMetrics
+	}
+	return FormatText
+}
+
+// Type is the metric type declared by "# TYPE".
+type Type string
+
+// Metric types. Samples without a "# TYPE" line get TypeUnknown.
+const (
+	TypeCounter        Type = "counter"
+	TypeGauge          Type = "gauge"
+	TypeHistogram      Type = "histogram"
+	TypeGaugeHistogram Type = "gaugehistogram"
+	TypeSummary        Type = "summary"
+	TypeInfo           Type = "info"
+	TypeStateSet       Type = "stateset"
+	TypeUnknown        Type = "unknown"
+)
+
+// Labels are the label pairs of a sample or exemplar.
+type Labels map[string]string
+
+// String formats the labels as {a="1",b="2"} in name order.
+func (l Labels) String() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, l[name])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// without returns a copy of l without the named label.
+func (l Labels) without(name string) Labels {
+	out := make(Labels, len(l))
+	for k, v := range l {
+		if k != name {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Exemplar is an OpenMetrics exemplar attached to a sample, typically
+// carrying trace_id and span_id.
+type Exemplar struct {
+	Labels    Labels
+	Value     float64
+	Timestamp time.Time // zero if absent
+}
+
+// Sample is one line of the exposition.
+type Sample struct {
+	// Name is the full sample name, e.g. "http_duration_seconds_bucket".
+	Name      string
+	Labels    Labels
+	Value     float64
+	Timestamp time.Time // zero if absent
+	Exemplar  *Exemplar
+}
+
+// Family is a metric family: the metadata lines and the samples that follow.
+type Family struct {
+	Name    string
+	Type    Type
+	Help    string
+	Unit    string
+	Samples []Sample
+}
+
+// Families is the result of Parse in exposition order.
+type Families []*Family
+
+// Get returns the family called name, or nil.
+func (fs Families) Get(name string) *Family {
+	for _, f := range fs {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Exemplars returns every sample that carries an exemplar.
+func (fs Families) Exemplars() []Sample {
+	var out []Sample
+	for _, f := range fs {
+		for _, s := range f.Samples {
+			if s.Exemplar != nil {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// suffixes are the sample name suffixes that belong to a family of the given type.
+var suffixes = map[Type][]string{
+	TypeCounter:        {"_total", "_created"},
+	TypeHistogram:      {"_bucket", "_count", "_sum", "_created"},
+	TypeGaugeHistogram: {"_bucket", "_gcount", "_gsum"},
+	TypeSummary:        {"_count", "_sum", "_created"},
+	TypeInfo:           {"_info"},
+}
+
+func (f *Family) owns(sample string) bool {
+	if sample == f.Name {
+		return true
+	}
+	for _, suffix := range suffixes[f.Type] {
+		if sample == f.Name+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads an exposition in the given format. OpenMetrics input must end
+// with "# EOF".
+func Parse(r io.Reader, format Format) (Families, error) {
+	p := &parser{format: format}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		p.line++
+		if p.eof {
+			return nil, p.errorf("content after # EOF")
+		}
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("promtext: %w", err)
+	}
+	if format == FormatOpenMetrics && !p.eof {
+		return nil, errors.New("promtext: OpenMetrics exposition does not end with # EOF")
+	}
+	return p.families, nil
+}
+
+type parser struct {
+	format   Format
+	line     int
+	eof      bool
+	families Families
+	current  *Family
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("promtext: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseLine(line string) error {
+	if p.format == FormatText {
+		line = strings.TrimSpace(line)
+	}
+	switch {
+	case line == "":
+		if p.format == FormatOpenMetrics {
+			return p.errorf("empty line")
+		}
+		return nil
+	case line == "# EOF" && p.format == FormatOpenMetrics:
+		p.eof = true
+		return nil
+	case strings.HasPrefix(line, "#"):
+		return p.parseComment(line)
+	default:
+		return p.parseSample(line)
+	}
+}
+
+// parseComment は # TYPE / # HELP / # UNIT を処理し、それ以外のコメントは無視する
+func (p *parser) parseComment(line string) error {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), " ", 3)
+	if len(fields) < 2 {
+		return nil
+	}
+	keyword, name := fields[0], fields[1]
+	rest := ""
+	if len(fields) == 3 {
+		rest = fields[2]
+	}
+	switch keyword {
+	case "TYPE", "HELP", "UNIT":
+	default:
+		return nil
+	}
+	if !validMetricName(name) {
+		return p.errorf("invalid metric name %q", name)
+	}
+
+	f := p.family(name)
+	switch keyword {
+	case "TYPE":
+		t := Type(rest)
+		if p.format == FormatText && t == "untyped" {
+			t = TypeUnknown
+		}
+		switch t {
+		case TypeCounter, TypeGauge, TypeHistogram, TypeGaugeHistogram, TypeSummary, TypeInfo, TypeStateSet, TypeUnknown:
+		default:
+			return p.errorf("unknown type %q for %s", rest, name)
+		}
+		if len(f.Samples) > 0 {
+			return p.errorf("TYPE for %s after its samples", name)
+		}
+		f.Type = t
+	case "HELP":
+		f.Help = unescape(rest, p.format == FormatOpenMetrics)
+	case "UNIT":
+		f.Unit = rest
+	}
+	return nil
+}
+
+// family はメタデータ行の対象ファミリーを返す。直前と違う名前なら新しく作る
+func (p *parser) family(name string) *Family {
+	if p.current != nil && p.current.Name == name {
+		return p.current
+	}
+	if existing := p.families.Get(name); existing != nil {
+		p.current = existing
+		return existing
+	}
+	p.current = &Family{Name: name, Type: TypeUnknown}
+	p.families = append(p.families, p.current)
+	return p.current
+}
+
+func (p *parser) parseSample(line string) error {
+	s := &scanner{in: line}
+	name := s.name()
+	if name == "" {
+		return p.errorf("expected a metric name in %q", line)
+	}
+	labels, err := s.labels()
+	if err != nil {
+		return p.errorf("%s: %v", name, err)
+	}
+	sample := Sample{Name: name, Labels: labels}
+
+	if !s.space() {
+		return p.errorf("%s: expected a value", name)
+	}
+	if sample.Value, err = parseFloat(s.token()); err != nil {
+		return p.errorf("%s: %v", name, err)
+	}
+	if s.space() && !s.peek('#') {
+		if sample.Timestamp, err = p.parseTimestamp(s.token()); err != nil {
+			return p.errorf("%s: %v", name, err)
+		}
+		s.space()
+	}
+	if s.peek('#') {
+		if sample.Exemplar, err = p.parseExemplar(s); err != nil {
+			return p.errorf("%s: exemplar: %v", name, err)
+		}
+	}
+	if !s.done() {
+		return p.errorf("%s: unexpected %q", name, s.rest())
+	}
+
+	if p.current == nil || !p.current.owns(name) {
+		// TYPE の無いサンプルは型不明の独立したファミリーとして扱う
+		p.current = p.family(name)
+	}
+	p.current.Samples = append(p.current.Samples, sample)
+	return nil
+}
+
+func (p *parser) parseExemplar(s *scanner) (*Exemplar, error) {
+	s.pos++ // '#'
+	if !s.space() || !s.peek('{') {
+		return nil, errors.New("expected ' {' after '#'")
+	}
+	labels, err := s.labels()
+	if err != nil {
+		return nil, err
+	}
+	ex := &Exemplar{Labels: labels}
+	if !s.space() {
+		return nil, errors.New("expected a value")
+	}
+	if ex.Value, err = parseFloat(s.token()); err != nil {
+		return nil, err
+	}
+	if s.space() {
+		// エクスペンプラーのタイムスタンプは常に秒
+		secs, err := parseFloat(s.token())
+		if err != nil {
+			return nil, err
+		}
+		ex.Timestamp = secondsToTime(secs)
+	}
+	return ex, nil
+}
+
+// parseTimestamp はテキスト形式ではミリ秒の整数、OpenMetrics では秒の浮動小数点数
+func (p *parser) parseTimestamp(token string) (time.Time, error) {
+	if p.format == FormatText {
+		ms, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", token)
+		}
+		return time.UnixMilli(ms), nil
+	}
+	secs, err := parseFloat(token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", token)
+	}
+	return secondsToTime(secs), nil
+}
+
+func secondsToTime(secs float64) time.Time {
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(math.Round(frac*1e9)))
+}
+
+func parseFloat(token string) (float64, error) {
+	v, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return v, nil
+}
+
+// scanner はサンプル行を左から読む
+type scanner struct {
+	in  string
+	pos int
+}
+
+func (s *scanner) done() bool       { return s.pos >= len(s.in) }
+func (s *scanner) rest() string     { return s.in[s.pos:] }
+func (s *scanner) peek(c byte) bool { return !s.done() && s.in[s.pos] == c }
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || c == ':' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+func validMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *scanner) name() string {
+	start := s.pos
+	for !s.done() && isNameChar(s.in[s.pos], s.pos == start) {
+		s.pos++
+	}
+	return s.in[start:s.pos]
+}
+
+// space は 1 個以上の空白を読み飛ばし、読んだかどうかを返す
+func (s *scanner) space() bool {
+	start := s.pos
+	for !s.done() && (s.in[s.pos] == ' ' || s.in[s.pos] == '\t') {
+		s.pos++
+	}
+	return s.pos > start
+}
+
+func (s *scanner) token() string {
+	start := s.pos
+	for !s.done() && s.in[s.pos] != ' ' && s.in[s.pos] != '\t' {
+		s.pos++
+	}
+	return s.in[start:s.pos]
+}
+
+// labels は {a="1",b="2"} を読む。ラベルが無ければ空の Labels を返す
+func (s *scanner) labels() (Labels, error) {
+	labels := Labels{}
+	if !s.peek('{') {
+		return labels, nil
+	}
+	s.pos++
+	for {
+		s.space()
+		if s.peek('}') {
+			s.pos++
+			return labels, nil
+		}
+		name := s.name()
+		if name == "" {
+			return nil, fmt.Errorf("expected a label name at %q", s.rest())
+		}
+		s.space()
+		if !s.peek('=') {
+			return nil, fmt.Errorf("expected '=' after label %s", name)
+		}
+		s.pos++
+		s.space()
+		value, err := s.quoted()
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", name, err)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("duplicate label %s", name)
+		}
+		labels[name] = value
+
+		s.space()
+		switch {
+		case s.peek(','):
+			s.pos++
+		case s.peek('}'):
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' after label %s", name)
+		}
+	}
+}
+
+// quoted は "..." を読み、\\ \" \n のエスケープを戻す
+func (s *scanner) quoted() (string, error) {
+	if !s.peek('"') {
+		return "", errors.New("expected a quoted value")
+	}
+	s.pos++
+	var b strings.Builder
+	for !s.done() {
+		c := s.in[s.pos]
+		s.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if s.done() {
+				return "", errors.New("unterminated escape")
+			}
+			switch e := s.in[s.pos]; e {
+			case '\\', '"':
+				b.WriteByte(e)
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+			s.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted value")
+}
+
+// unescape は HELP のエスケープを戻す。テキスト形式では \" はエスケープではない
+func unescape(help string, openMetrics bool) string {
+	if !strings.Contains(help, `\`) {
+		return help
+	}
+	var b strings.Builder
+	for i := 0; i < len(help); i++ {
+		if help[i] == '\\' && i+1 < len(help) {
+			switch help[i+1] {
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '"':
+				if openMetrics {
+					b.WriteByte('"')
+					i++
+					continue
+				}
+			}
+		}
+		b.WriteByte(help[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package promtext
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openMetrics は Collector の Prometheus エクスポーター（enable_open_metrics: true）の出力を縮めたもの
+const openMetrics = `# HELP microservices_user_service_response_time_custom Custom histogram with exemplar support
+# TYPE microservices_user_service_response_time_custom histogram
+# UNIT microservices_user_service_response_time_custom seconds
+microservices_user_service_response_time_custom_bucket{environment="development",http_route="/users/{id}",le="0.005"} 3 # {span_id="00f067aa0ba902b7",trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.0021 1.7e+09
+microservices_user_service_response_time_custom_bucket{environment="development",http_route="/users/{id}",le="2"} 3
+microservices_user_service_response_time_custom_bucket{environment="development",http_route="/users/{id}",le="+Inf"} 4 # {trace_id="0af7651916cd43dd8448eb211c80319c"} 2.004 1.7000000015e+09
+microservices_user_service_response_time_custom_sum{environment="development",http_route="/users/{id}"} 2.0106
+microservices_user_service_response_time_custom_count{environment="development",http_route="/users/{id}"} 4
+# HELP microservices_user_service_requests Total requests
+# TYPE microservices_user_service_requests counter
+microservices_user_service_requests_total{http_route="/users/{id}",note="a \"quoted\" {brace} # hash"} 4 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 1
+microservices_user_service_requests_created{http_route="/users/{id}"} 1.7e+09
+# EOF
+`
+
+func TestParseOpenMetrics(t *testing.T) {
+	families, err := Parse(strings.NewReader(openMetrics), FormatOpenMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 {
+		t.Fatalf("got %d families, want 2", len(families))
+	}
+
+	hist := families.Get("microservices_user_service_response_time_custom")
+	if hist == nil || hist.Type != TypeHistogram || hist.Unit != "seconds" || hist.Help != "Custom histogram with exemplar support" {
+		t.Fatalf("histogram family = %+v", hist)
+	}
+	series, err := hist.Histograms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("got %d histogram series, want 1", len(series))
+	}
+	h := series[0]
+	if err := h.Validate(); err != nil {
+		t.Error(err)
+	}
+	if h.Labels["http_route"] != "/users/{id}" || h.Labels["le"] != "" {
+		t.Errorf("series labels = %v", h.Labels)
+	}
+	if h.Count != 4 || math.Abs(h.Sum-2.0106) > 1e-9 || len(h.Buckets) != 3 {
+		t.Errorf("count %g sum %g buckets %d, want 4 2.0106 3", h.Count, h.Sum, len(h.Buckets))
+	}
+	b, ok := h.Bucket(0.005)
+	if !ok || b.Count != 3 || b.Exemplar == nil {
+		t.Fatalf("le=0.005 bucket = %+v", b)
+	}
+	if b.Exemplar.Labels["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || b.Exemplar.Value != 0.0021 || !b.Exemplar.Timestamp.Equal(time.Unix(1.7e9, 0)) {
+		t.Errorf("exemplar = %+v", b.Exemplar)
+	}
+	inf, _ := h.Bucket(math.Inf(1))
+	if inf.Exemplar == nil || !inf.Exemplar.Timestamp.Equal(time.Unix(1700000001, 500000000)) {
+		t.Errorf("+Inf exemplar = %+v", inf.Exemplar)
+	}
+
+	counter := families.Get("microservices_user_service_requests")
+	if counter == nil || counter.Type != TypeCounter || len(counter.Samples) != 2 {
+		t.Fatalf("counter family = %+v", counter)
+	}
+	total := counter.Samples[0]
+	if total.Name != "microservices_user_service_requests_total" || total.Value != 4 {
+		t.Errorf("counter sample = %+v", total)
+	}
+	if got := total.Labels["note"]; got != `a "quoted" {brace} # hash` {
+		t.Errorf("escaped label = %q", got)
+	}
+	if len(families.Exemplars()) != 3 {
+		t.Errorf("got %d exemplars, want 3", len(families.Exemplars()))
+	}
+}
+
+func TestParseText(t *testing.T) {
+	const text = `# HELP http_requests_total The total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# A normal comment.
+# HELP help_escapes Line one\nline "two" \\ end
+# TYPE help_escapes gauge
+help_escapes -Inf
+untyped_metric{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+`
+	families, err := Parse(strings.NewReader(text), FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 4 {
+		t.Fatalf("got %d families, want 4", len(families))
+	}
+
+	requests := families.Get("http_requests_total")
+	if requests.Type != TypeCounter || len(requests.Samples) != 2 {
+		t.Fatalf("requests = %+v", requests)
+	}
+	if s := requests.Samples[1]; s.Value != 3 || s.Labels["code"] != "400" || !s.Timestamp.Equal(time.UnixMilli(1395066363000)) {
+		t.Errorf("sample = %+v", s)
+	}
+	if h := families.Get("help_escapes"); h.Help != "Line one\nline \"two\" \\ end" || !math.IsInf(h.Samples[0].Value, -1) {
+		t.Errorf("help_escapes = %+v", h)
+	}
+	untyped := families.Get("untyped_metric")
+	if untyped.Type != TypeUnknown || untyped.Samples[0].Labels["path"] != `C:\DIR\FILE.TXT` || untyped.Samples[0].Labels["error"] != "Cannot find file:\n\"FILE.TXT\"" {
+		t.Errorf("untyped = %+v", untyped)
+	}
+	if summary := families.Get("rpc_duration_seconds"); summary.Type != TypeSummary || len(summary.Samples) != 3 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   string
+	}{
+		{"missing EOF", FormatOpenMetrics, "a 1\n", "does not end with # EOF"},
+		{"content after EOF", FormatOpenMetrics, "# EOF\na 1\n", "line 2: content after # EOF"},
+		{"bad value", FormatText, "a{b=\"c\"} one\n", `line 1: a: invalid number "one"`},
+		{"unterminated label", FormatText, "a{b=\"c} 1\n", "unterminated quoted value"},
+		{"duplicate label", FormatText, "a{b=\"1\",b=\"2\"} 1\n", "duplicate label b"},
+		{"unknown type", FormatText, "# TYPE a histo\n", `unknown type "histo"`},
+		{"trailing garbage", FormatText, "a 1 2 3\n", `unexpected "3"`},
+		{"bad exemplar", FormatOpenMetrics, "a_total 1 # trace 1\n# EOF\n", "expected ' {'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramValidate(t *testing.T) {
+	const text = `# TYPE h histogram
+h_bucket{le="1"} 5
+h_bucket{le="2"} 4
+h_bucket{le="+Inf"} 6
+h_count 6
+`
+	families, err := Parse(strings.NewReader(text), FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err := families.Get("h").Histograms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := series[0].Validate(); err == nil || !strings.Contains(err.Error(), "less than") {
+		t.Errorf("Validate = %v, want a non-cumulative bucket error", err)
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	for contentType, want := range map[string]Format{
+		"application/openmetrics-text; version=1.0.0; charset=utf-8": FormatOpenMetrics,
+		"text/plain; version=0.0.4; charset=utf-8":                   FormatText,
+		"": FormatText,
+	} {
+		if got := FormatFor(contentType); got != want {
+			t.Errorf("FormatFor(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package sampling
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DecisionKey is the attribute of sampling_decisions_total.
+const DecisionKey = attribute.Key("sampling.decision")
+
+// Values of DecisionKey, one per local trace.
+const (
+	// DecisionSampled: the ratio sampled the trace up front.
+	DecisionSampled = "sampled"
+	// DecisionKeptError: a deferred trace kept because a span failed.
+	DecisionKeptError = "kept_error"
+	// DecisionKeptSlow: a deferred trace kept because its root was slow.
+	DecisionKeptSlow = "kept_slow"
+	// DecisionDropped: a deferred trace that was neither.
+	DecisionDropped = "dropped"
+	// DecisionOverflow: deferred spans dropped because too many traces were
+	// waiting for their root span.
+	DecisionOverflow = "overflow"
+)
+
+// 遅延判定中のトレースの上限。ルートが終わらないまま残ったものは pendingTTL で捨てる
+const (
+	maxPendingTraces = 1024
+	pendingTTL       = time.Minute
+)
+
+// WrapProcessor returns a span processor that holds back deferred spans
+// until their local root span (the first span of the trace in this process)
+// ends, then passes them to next if the trace failed or was slow and drops
+// them otherwise. Other spans go to next unchanged. Each local trace is
+// counted in sampling_decisions_total. Policies that never defer return
+// next as is.
+func (p *Policy) WrapProcessor(next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	if p.rules == nil {
+		return next, nil
+	}
+	decisions, err := otel.Meter(instrumentationName).Int64Counter(
+		"sampling_decisions_total",
+		metric.WithDescription("Number of local traces by tail sampling decision"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &processor{
+		next:      next,
+		rules:     p.rules,
+		decisions: decisions,
+		roots:     map[oteltrace.SpanID]oteltrace.SpanID{},
+		pending:   map[oteltrace.SpanID]*pendingTrace{},
+		now:       time.Now,
+	}, nil
+}
+
+// ExemplarFilter wraps next so that measurements made inside a deferred
+// span only get an exemplar once the trace is known to be kept: the span
+// already has an error status or has lasted as long as the slow threshold.
+// Otherwise the exemplar could point at a trace that is never exported.
+// Policies that never defer return next as is.
+func (p *Policy) ExemplarFilter(next exemplar.Filter) exemplar.Filter {
+	if p.rules == nil {
+		return next
+	}
+	rules := p.rules
+	return func(ctx context.Context) bool {
+		if !next(ctx) {
+			return false
+		}
+		if !Deferred(oteltrace.SpanContextFromContext(ctx)) {
+			return true
+		}
+		// SDK のスパンなら状態と開始時刻を読める
+		span, ok := oteltrace.SpanFromContext(ctx).(sdktrace.ReadOnlySpan)
+		if !ok {
+			return false
+		}
+		if rules.keepErrors && span.Status().Code == codes.Error {
+			return true
+		}
+		return rules.slowThreshold > 0 && time.Since(span.StartTime()) >= rules.slowThreshold
+	}
+}
+
+// processor は遅延判定中のスパンをローカルのトレースごとに溜め、ローカルのルートの終了時に残すか決める。
+// 同じトレースでもリモートの親を持つルートが複数あれば（同じサービスを 2 回呼ぶなど）それぞれ別に判定するので、
+// トレース ID ではなくローカルのルートのスパン ID でまとめる
+type processor struct {
+	next      sdktrace.SpanProcessor
+	rules     *ruleSet
+	decisions metric.Int64Counter
+	now       func() time.Time
+
+	mu sync.Mutex
+	// roots は実行中の遅延判定スパンからそのローカルのルートへの対応。OnStart で入れ、OnEnd で消す
+	roots   map[oteltrace.SpanID]oteltrace.SpanID
+	pending map[oteltrace.SpanID]*pendingTrace
+}
+
+// pendingTrace はルートより先に終わった遅延判定中のスパン
+type pendingTrace struct {
+	spans  []sdktrace.ReadOnlySpan
+	failed bool
+	since  time.Time
+}
+
+func (p *processor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if sc := s.SpanContext(); Deferred(sc) {
+		root := sc.SpanID()
+		p.mu.Lock()
+		if !isLocalRoot(s) {
+			// 親のルートを引き継ぐ。親の記録がなければ（親が先に終わったなど）親をルートとみなし、
+			// そのスパンは pendingTTL で捨てられる
+			root = s.Parent().SpanID()
+			if r, ok := p.roots[root]; ok {
+				root = r
+			}
+		}
+		p.roots[sc.SpanID()] = root
+		p.mu.Unlock()
+	}
+	p.next.OnStart(ctx, s)
+}
+
+func (p *processor) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	localRoot := isLocalRoot(s)
+	if !Deferred(sc) {
+		if localRoot && sc.IsSampled() {
+			p.count(DecisionSampled)
+		}
+		p.next.OnEnd(s)
+		return
+	}
+
+	failed := s.Status().Code == codes.Error
+	p.mu.Lock()
+	root, ok := p.roots[sc.SpanID()]
+	if !ok {
+		root = sc.SpanID()
+		if !localRoot {
+			root = s.Parent().SpanID()
+		}
+	}
+	delete(p.roots, sc.SpanID())
+	t := p.pending[root]
+	if !localRoot {
+		if t == nil {
+			if !p.reserve() {
+				p.mu.Unlock()
+				p.count(DecisionOverflow)
+				return
+			}
+			t = &pendingTrace{since: p.now()}
+			p.pending[root] = t
+		}
+		t.spans = append(t.spans, s)
+		t.failed = t.failed || failed
+		p.mu.Unlock()
+		return
+	}
+	delete(p.pending, root)
+	p.mu.Unlock()
+
+	if t != nil {
+		failed = failed || t.failed
+	}
+	decision := p.decide(failed, s.EndTime().Sub(s.StartTime()))
+	p.count(decision)
+	if decision == DecisionDropped {
+		return
+	}
+	if t != nil {
+		for _, span := range t.spans {
+			p.next.OnEnd(span)
+		}
+	}
+	p.next.OnEnd(s)
+}
+
+// isLocalRoot はこのプロセスでのトレースの最初のスパンか返す
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
+
+// decide はローカルのトレースを残す理由を返す
+func (p *processor) decide(failed bool, elapsed time.Duration) string {
+	switch {
+	case p.rules.keepErrors && failed:
+		return DecisionKeptError
+	case p.rules.slowThreshold > 0 && elapsed >= p.rules.slowThreshold:
+		return DecisionKeptSlow
+	default:
+		return DecisionDropped
+	}
+}
+
+// reserve は新しいトレースを溜める余地があるか返す。満杯なら古いものを捨ててから確かめる。p.mu を持って呼ぶ
+func (p *processor) reserve() bool {
+	if len(p.pending) < maxPendingTraces {
+		return true
+	}
+	cutoff := p.now().Add(-pendingTTL)
+	for id, t := range p.pending {
+		if t.since.Before(cutoff) {
+			delete(p.pending, id)
+		}
+	}
+	return len(p.pending) < maxPendingTraces
+}
+
+func (p *processor) count(decision string) {
+	p.decisions.Add(context.Background(), 1, metric.WithAttributes(DecisionKey.String(decision)))
+}
+
+// Shutdown は判定待ちのスパンを捨ててから next を止める
+func (p *processor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	clear(p.roots)
+	clear(p.pending)
+	p.mu.Unlock()
+	return p.next.Shutdown(ctx)
+}
+
+func (p *processor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,191 @@
+package sampling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Rules is the content of a rule file used by the parentbased_rules sampler.
+type Rules struct {
+	// DefaultRatio is the share of traces (0..1) sampled up front when no
+	// rule matches the root span.
+	DefaultRatio float64 `json:"default_ratio"`
+	// KeepErrors keeps traces the ratio did not sample when one of their
+	// spans ends with an error status.
+	KeepErrors bool `json:"keep_errors,omitempty"`
+	// SlowThreshold keeps traces the ratio did not sample when their local
+	// root span lasts at least this long. Zero disables it.
+	SlowThreshold Duration `json:"slow_threshold,omitempty"`
+	// Rules are tried in order; the first one matching the root span sets
+	// the ratio.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule sets the sampling ratio of root spans it matches. Every non-empty
+// matcher must match.
+type Rule struct {
+	// Name identifies the rule in errors.
+	Name string `json:"name"`
+	// Service restricts the rule to one service.name.
+	Service string `json:"service,omitempty"`
+	// Route matches server spans named "{method} {route}" (see
+	// internal/serverspan), e.g. "GET /users/{id}". A route without a
+	// method ("/readyz") matches every method.
+	Route string `json:"route,omitempty"`
+	// SpanName matches the span name exactly, for roots that are not server
+	// spans (e.g. "main_orchestration").
+	SpanName string `json:"span_name,omitempty"`
+	// Ratio is the share of matching traces (0..1) sampled up front.
+	Ratio float64 `json:"ratio"`
+}
+
+// Duration is a time.Duration written as "500ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"500ms\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadRules reads a rule file.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, fmt.Errorf("sampling: %w", err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, fmt.Errorf("sampling: parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ruleSet は 1 サービス分に絞り込んで検証したルール
+type ruleSet struct {
+	defaultRatio  float64
+	defaultRoot   sdktrace.Sampler
+	keepErrors    bool
+	slowThreshold time.Duration
+	rules         []compiledRule
+}
+
+// compiledRule はルートをメソッドとパスに分けたもの
+type compiledRule struct {
+	Rule
+	method string // 空なら全メソッドに一致
+	path   string
+	root   sdktrace.Sampler
+}
+
+// compile は rules を検証し、service に当てはまるルールだけを残す
+func compile(service string, rules Rules) (*ruleSet, error) {
+	var errs []error
+	if err := validateRatio(rules.DefaultRatio); err != nil {
+		errs = append(errs, fmt.Errorf("sampling: default_ratio: %w", err))
+	}
+	if rules.SlowThreshold < 0 {
+		errs = append(errs, fmt.Errorf("sampling: slow_threshold must not be negative, got %s", time.Duration(rules.SlowThreshold)))
+	}
+
+	set := &ruleSet{
+		defaultRatio:  rules.DefaultRatio,
+		defaultRoot:   sdktrace.TraceIDRatioBased(rules.DefaultRatio),
+		keepErrors:    rules.KeepErrors,
+		slowThreshold: time.Duration(rules.SlowThreshold),
+	}
+	seen := map[string]bool{}
+	for i, r := range rules.Rules {
+		c, err := compileRule(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sampling: rule %d (%q): %w", i, r.Name, err))
+			continue
+		}
+		if seen[r.Name] {
+			errs = append(errs, fmt.Errorf("sampling: rule %d: duplicate name %q", i, r.Name))
+			continue
+		}
+		seen[r.Name] = true
+		if r.Service == "" || r.Service == service {
+			set.rules = append(set.rules, c)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func compileRule(r Rule) (compiledRule, error) {
+	if r.Name == "" {
+		return compiledRule{}, errors.New("name is required")
+	}
+	if err := validateRatio(r.Ratio); err != nil {
+		return compiledRule{}, fmt.Errorf("ratio: %w", err)
+	}
+	c := compiledRule{Rule: r, root: sdktrace.TraceIDRatioBased(r.Ratio)}
+	if r.Route != "" {
+		c.method, c.path, _ = strings.Cut(r.Route, " ")
+		if c.path == "" {
+			// メソッドの無いルート
+			c.method, c.path = "", r.Route
+		}
+		if !strings.HasPrefix(c.path, "/") {
+			return compiledRule{}, fmt.Errorf("route %q must be \"[METHOD ]/path\"", r.Route)
+		}
+	}
+	return c, nil
+}
+
+func validateRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("must be in [0, 1], got %g", ratio)
+	}
+	return nil
+}
+
+// match は span 名がルールに一致するか返す
+func (c *compiledRule) match(name string) bool {
+	if c.SpanName != "" && name != c.SpanName {
+		return false
+	}
+	if c.path != "" {
+		method, path, ok := strings.Cut(name, " ")
+		if !ok || path != c.path || c.method != "" && method != c.method {
+			return false
+		}
+	}
+	return true
+}
+
+// root は span 名に一致する最初のルールの割合で判定するサンプラーを返す
+func (s *ruleSet) root(name string) sdktrace.Sampler {
+	for i := range s.rules {
+		if s.rules[i].match(name) {
+			return s.rules[i].root
+		}
+	}
+	return s.defaultRoot
+}
+
+// defers は割合で落ちたトレースを後から残す条件があるか返す
+func (s *ruleSet) defers() bool {
+	return s.keepErrors || s.slowThreshold > 0
+}
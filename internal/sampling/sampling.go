@@ -0,0 +1,218 @@
+// Package sampling はトレースのサンプラーを OTEL_TRACES_SAMPLER とルールファイルから組み立てるパッケージ
+//
+// 標準の値（always_on, traceidratio, parentbased_always_on など）に加えて parentbased_rules を受け付ける。
+// parentbased_rules はルートスパンの名前（ルート）ごとの割合でトレースを間引くが、
+// 割合で落ちたトレースもいったん記録しておき、エラーになったものや遅かったものは
+// ローカルのルートスパンが終わった時点で残す（遅延判定）。残さなかったスパンは
+// エクスポートされず、エクスペンプラーも付かない。
+//
+// 遅延判定はプロセスごとに行い、残すかどうかは他のサービスに伝わらない。
+// 下流のサービスでだけエラーになれば、下流のスパンは残るが上流のスパンは捨てられるので、
+// Jaeger では親が欠けた一部だけのトレースになる（逆に上流だけが残ることもある）。
+//
+// ヘルスチェックのように Suppress を付けたコンテキストでは、サンプラーの種類や親に関係なく
+// スパンを記録しない（always_on や traceidratio は親を見ないため、親だけでは抑止できない）。
+package sampling
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "otel-playground/internal/sampling"
+
+// Environment variables read by FromEnv.
+const (
+	EnvSampler    = "OTEL_TRACES_SAMPLER"
+	EnvSamplerArg = "OTEL_TRACES_SAMPLER_ARG"
+)
+
+// OTEL_TRACES_SAMPLER の値。parentbased_rules 以外は仕様で決められたもの
+const (
+	samplerAlwaysOn                = "always_on"
+	samplerAlwaysOff               = "always_off"
+	samplerTraceIDRatio            = "traceidratio"
+	samplerParentBasedAlwaysOn     = "parentbased_always_on"
+	samplerParentBasedAlwaysOff    = "parentbased_always_off"
+	samplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	samplerParentBasedRules        = "parentbased_rules"
+)
+
+// DefaultRulesFile is the rule file of parentbased_rules when
+// OTEL_TRACES_SAMPLER_ARG is empty.
+const DefaultRulesFile = "sampling/rules.json"
+
+// 遅延判定中のトレースは tracestate にこの印を持つ。下流のサービスにも伝播するので、
+// 上流が割合で落としたトレースを下流も同じく遅延判定にする
+const (
+	traceStateKey      = "sampling"
+	traceStateDeferred = "deferred"
+)
+
+// Policy is a sampler together with the span processor and exemplar filter
+// that complete its deferred decisions. Build one with FromEnv or ForRules.
+type Policy struct {
+	name    string
+	sampler sdktrace.Sampler
+	// rules は parentbased_rules のときだけ設定される
+	rules *ruleSet
+}
+
+// FromEnv builds the Policy selected by OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG for service. An empty OTEL_TRACES_SAMPLER means
+// parentbased_always_on, the SDK's default. For the *traceidratio samplers
+// the argument is the ratio (default 1.0), for parentbased_rules it is the
+// rule file (default DefaultRulesFile).
+//
+// The SDK reads OTEL_TRACES_SAMPLER as well and logs "unsupported sampler"
+// for parentbased_rules; the sampler from this Policy replaces its fallback.
+func FromEnv(service string) (*Policy, error) {
+	name, arg := os.Getenv(EnvSampler), os.Getenv(EnvSamplerArg)
+	switch name {
+	case "", samplerParentBasedAlwaysOn:
+		return &Policy{name: samplerParentBasedAlwaysOn, sampler: sdktrace.ParentBased(sdktrace.AlwaysSample())}, nil
+	case samplerAlwaysOn:
+		return &Policy{name: name, sampler: sdktrace.AlwaysSample()}, nil
+	case samplerAlwaysOff:
+		return &Policy{name: name, sampler: sdktrace.NeverSample()}, nil
+	case samplerParentBasedAlwaysOff:
+		return &Policy{name: name, sampler: sdktrace.ParentBased(sdktrace.NeverSample())}, nil
+	case samplerTraceIDRatio, samplerParentBasedTraceIDRatio:
+		ratio := 1.0
+		if arg != "" {
+			var err error
+			if ratio, err = strconv.ParseFloat(arg, 64); err != nil || validateRatio(ratio) != nil {
+				return nil, fmt.Errorf("sampling: %s=%q, want a ratio in [0, 1]", EnvSamplerArg, arg)
+			}
+		}
+		sampler := sdktrace.TraceIDRatioBased(ratio)
+		if name == samplerParentBasedTraceIDRatio {
+			sampler = sdktrace.ParentBased(sampler)
+		}
+		return &Policy{name: fmt.Sprintf("%s (%g)", name, ratio), sampler: sampler}, nil
+	case samplerParentBasedRules:
+		path := arg
+		if path == "" {
+			path = DefaultRulesFile
+		}
+		rules, err := LoadRules(path)
+		if err != nil {
+			return nil, err
+		}
+		p, err := ForRules(service, rules)
+		if err != nil {
+			return nil, err
+		}
+		p.name = fmt.Sprintf("%s (%s)", samplerParentBasedRules, path)
+		return p, nil
+	default:
+		return nil, fmt.Errorf("sampling: %s=%q, want %s, %s, %s, %s, %s, %s or %s", EnvSampler, name,
+			samplerAlwaysOn, samplerAlwaysOff, samplerTraceIDRatio, samplerParentBasedAlwaysOn,
+			samplerParentBasedAlwaysOff, samplerParentBasedTraceIDRatio, samplerParentBasedRules)
+	}
+}
+
+// ForRules builds the parentbased_rules Policy of service from rules. Rules
+// for other services are ignored.
+func ForRules(service string, rules Rules) (*Policy, error) {
+	set, err := compile(service, rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{
+		name: samplerParentBasedRules,
+		sampler: sdktrace.ParentBased(&ruleSampler{set},
+			sdktrace.WithRemoteParentSampled(remoteSampled{}),
+		),
+		rules: set,
+	}, nil
+}
+
+// Sampler returns the sampler to pass to sdktrace.WithSampler. It drops
+// every span started in a context marked by Suppress.
+func (p *Policy) Sampler() sdktrace.Sampler { return suppressible{p.sampler} }
+
+func (p *Policy) String() string { return p.name }
+
+// Deferred reports whether the span was recorded only to decide at its end
+// whether the trace is kept (an error or a slow request).
+func Deferred(sc oteltrace.SpanContext) bool {
+	return sc.TraceState().Get(traceStateKey) == traceStateDeferred
+}
+
+type suppressKey struct{}
+
+// Suppress returns a context in which the samplers of every Policy drop new
+// spans, whatever the sampler and the parent. Health checks use it so that
+// spans created by probes (e.g. otelsql's db.Ping) are never recorded.
+func Suppress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressKey{}, true)
+}
+
+// Suppressed reports whether ctx was marked by Suppress.
+func Suppressed(ctx context.Context) bool {
+	suppressed, _ := ctx.Value(suppressKey{}).(bool)
+	return suppressed
+}
+
+// suppressible は Suppress の印があるコンテキストのスパンを落とし、それ以外を next に任せる
+type suppressible struct {
+	next sdktrace.Sampler
+}
+
+func (s suppressible) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if Suppressed(p.ParentContext) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: oteltrace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s suppressible) Description() string { return s.next.Description() }
+
+// ruleSampler はルートスパンの名前で割合を選び、落ちたトレースを遅延判定にする
+type ruleSampler struct {
+	rules *ruleSet
+}
+
+func (s *ruleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.rules.root(p.Name).ShouldSample(p)
+	if res.Decision == sdktrace.RecordAndSample || !s.rules.defers() {
+		return res
+	}
+	return deferDecision(p)
+}
+
+func (s *ruleSampler) Description() string {
+	return fmt.Sprintf("RuleBased{rules:%d,default:%g,keepErrors:%t,slow:%s}",
+		len(s.rules.rules), s.rules.defaultRatio, s.rules.keepErrors, s.rules.slowThreshold)
+}
+
+// remoteSampled はサンプリングされたリモートの親を引き継ぐ。親が遅延判定中ならこちらも遅延判定にする
+type remoteSampled struct{}
+
+func (remoteSampled) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if Deferred(oteltrace.SpanContextFromContext(p.ParentContext)) {
+		return deferDecision(p)
+	}
+	return sdktrace.AlwaysSample().ShouldSample(p)
+}
+
+func (remoteSampled) Description() string { return "AlwaysOnSampler unless deferred" }
+
+// deferDecision は記録とエクスポート対象（sampled フラグ）にしたうえで tracestate に印を付ける。
+// 実際にエクスポートするかは processor がローカルのルートスパンの終了時に決める
+func deferDecision(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	ts := oteltrace.SpanContextFromContext(p.ParentContext).TraceState()
+	if marked, err := ts.Insert(traceStateKey, traceStateDeferred); err == nil {
+		ts = marked
+	}
+	return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: ts}
+}
@@ -0,0 +1,389 @@
+package sampling
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+var testRules = Rules{
+	DefaultRatio:  0,
+	KeepErrors:    true,
+	SlowThreshold: Duration(500 * time.Millisecond),
+	Rules: []Rule{
+		{Name: "user-by-id", Service: "user-service", Route: "GET /users/{id}", Ratio: 1},
+		{Name: "other-service", Service: "post-service", Route: "/users", Ratio: 1},
+	},
+}
+
+// newTestProvider は policy のサンプラーと processor でスパンをメモリに集める
+func newTestProvider(t *testing.T, p *Policy) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	processor, err := p.WrapProcessor(sdktrace.NewSimpleSpanProcessor(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(p.Sampler()), sdktrace.WithSpanProcessor(processor))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+func TestFromEnv(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rulesFile, []byte(`{"default_ratio":0.1,"keep_errors":true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sampler, arg string
+		want         string
+		wantErr      string
+	}{
+		{"", "", "ParentBased{root:AlwaysOnSampler", ""},
+		{"always_off", "", "AlwaysOffSampler", ""},
+		{"parentbased_traceidratio", "0.25", "ParentBased{root:TraceIDRatioBased{0.25}", ""},
+		{"traceidratio", "", "AlwaysOnSampler", ""},
+		{"parentbased_rules", rulesFile, "ParentBased{root:RuleBased{rules:0,default:0.1,keepErrors:true,slow:0s}", ""},
+		{"traceidratio", "1.5", "", "want a ratio in [0, 1]"},
+		{"parentbased_rules", filepath.Join(t.TempDir(), "missing.json"), "", "no such file"},
+		{"jaeger_remote", "", "", "want always_on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sampler+" "+tt.arg, func(t *testing.T) {
+			t.Setenv(EnvSampler, tt.sampler)
+			t.Setenv(EnvSamplerArg, tt.arg)
+			p, err := FromEnv("user-service")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Sampler().Description(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("sampler = %s, want %s...", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryRulesAreValid(t *testing.T) {
+	rules, err := LoadRules("../../" + DefaultRulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"user-service", "post-service", "comment-service", "orchestrator"} {
+		if _, err := ForRules(service, rules); err != nil {
+			t.Errorf("%s: %v", service, err)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	_, err := ForRules("user-service", Rules{
+		DefaultRatio: 2,
+		Rules: []Rule{
+			{Name: "a", Route: "GET", Ratio: 1},
+			{Name: "b", Ratio: -1},
+			{Name: "c", Route: "/users"},
+			{Name: "c", Route: "/posts"},
+			{Route: "/comments"},
+		},
+	})
+	if err == nil {
+		t.Fatal("invalid rules accepted")
+	}
+	for _, want := range []string{"default_ratio: must be in [0, 1], got 2", `rule 0 ("a"): route "GET"`,
+		`rule 1 ("b"): ratio`, `rule 3: duplicate name "c"`, "rule 4 (\"\"): name is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestRuleMatching(t *testing.T) {
+	set, err := compile("user-service", Rules{DefaultRatio: 0.5, Rules: []Rule{
+		{Name: "get", Route: "GET /users/{id}", Ratio: 1},
+		{Name: "any-method", Route: "/readyz", Ratio: 0},
+		{Name: "orchestration", SpanName: "main_orchestration", Ratio: 0.2},
+		{Name: "elsewhere", Service: "post-service", Route: "/posts", Ratio: 0},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"GET /users/{id}":    "AlwaysOnSampler",
+		"DELETE /users/{id}": "TraceIDRatioBased{0.5}",
+		"HEAD /readyz":       "TraceIDRatioBased{0}",
+		"main_orchestration": "TraceIDRatioBased{0.2}",
+		"GET /posts":         "TraceIDRatioBased{0.5}",
+		"GET":                "TraceIDRatioBased{0.5}",
+	}
+	for name, want := range tests {
+		if got := set.root(name).Description(); got != want {
+			t.Errorf("%q: sampler %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestDeferredTracesAreKeptOnErrorOrSlowness(t *testing.T) {
+	h := telemetrytest.New(t)
+	p, err := ForRules("user-service", testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, exporter := newTestProvider(t, p)
+	tracer := tp.Tracer("test")
+
+	// request は子スパンを 1 つ持つローカルのトレースを作り、子の状態と全体の所要時間を指定する
+	request := func(name string, childStatus codes.Code, elapsed time.Duration) oteltrace.SpanContext {
+		start := time.Now()
+		ctx, root := tracer.Start(context.Background(), name, oteltrace.WithTimestamp(start))
+		_, child := tracer.Start(ctx, "db.Query")
+		child.SetStatus(childStatus, "")
+		child.End()
+		root.End(oteltrace.WithTimestamp(start.Add(elapsed)))
+		return root.SpanContext()
+	}
+
+	sampled := request("GET /users/{id}", codes.Unset, time.Millisecond)
+	dropped := request("GET /users", codes.Unset, time.Millisecond)
+	failed := request("GET /users", codes.Error, time.Millisecond)
+	slow := request("GET /users", codes.Unset, time.Second)
+
+	if Deferred(sampled) || !Deferred(dropped) || !Deferred(failed) {
+		t.Errorf("deferred = %t %t %t, want only ratio-dropped traces deferred", Deferred(sampled), Deferred(dropped), Deferred(failed))
+	}
+	exported := map[oteltrace.TraceID]int{}
+	for _, s := range exporter.GetSpans() {
+		exported[s.SpanContext.TraceID()]++
+	}
+	for _, tt := range []struct {
+		name string
+		sc   oteltrace.SpanContext
+		want int
+	}{{"sampled", sampled, 2}, {"dropped", dropped, 0}, {"failed", failed, 2}, {"slow", slow, 2}} {
+		if got := exported[tt.sc.TraceID()]; got != tt.want {
+			t.Errorf("%s trace: exported %d spans, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	decisions := h.Metric(t, "sampling_decisions_total")
+	for _, decision := range []string{DecisionSampled, DecisionDropped, DecisionKeptError, DecisionKeptSlow} {
+		if got := telemetrytest.SumPoint[int64](t, decisions, DecisionKey.String(decision)).Value; got != 1 {
+			t.Errorf("%s = %d, want 1", decision, got)
+		}
+	}
+}
+
+func TestParentDecisions(t *testing.T) {
+	telemetrytest.New(t)
+	p, err := ForRules("user-service", testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, _ := newTestProvider(t, p)
+	tracer := tp.Tracer("test")
+
+	// ヘルスチェックのようにサンプリングされない親の子は記録しない
+	unsampled := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: oteltrace.TraceID{1}, SpanID: oteltrace.SpanID{1}})
+	_, span := tracer.Start(oteltrace.ContextWithSpanContext(context.Background(), unsampled), "GET /users/{id}")
+	if span.IsRecording() {
+		t.Error("child of an unsampled parent is recorded")
+	}
+	span.End()
+
+	// 上流が遅延判定にしたトレースは、割合 1 のルートでも遅延判定を引き継ぐ
+	_, upstream := tracer.Start(context.Background(), "GET /users")
+	remote := upstream.SpanContext().WithRemote(true)
+	_, span = tracer.Start(oteltrace.ContextWithRemoteSpanContext(context.Background(), remote), "GET /users/{id}")
+	if !Deferred(span.SpanContext()) {
+		t.Errorf("tracestate = %q, want the deferred marker inherited", span.SpanContext().TraceState())
+	}
+	span.End()
+	upstream.End()
+
+	// 遅延判定でない上流の子はそのままサンプリングする
+	sampled := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID: oteltrace.TraceID{2}, SpanID: oteltrace.SpanID{2}, TraceFlags: oteltrace.FlagsSampled, Remote: true,
+	})
+	_, span = tracer.Start(oteltrace.ContextWithRemoteSpanContext(context.Background(), sampled), "GET /users")
+	if !span.SpanContext().IsSampled() || Deferred(span.SpanContext()) {
+		t.Errorf("child of a sampled parent: sampled %t, deferred %t", span.SpanContext().IsSampled(), Deferred(span.SpanContext()))
+	}
+	span.End()
+}
+
+func TestRemoteParentedDeferredSpanIsDecidedLocally(t *testing.T) {
+	h := telemetrytest.New(t)
+	p, err := ForRules("user-service", testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, exporter := newTestProvider(t, p)
+	tracer := tp.Tracer("test")
+
+	// 上流のプロセスが遅延判定にしたトレースを受け取る。上流が残すかどうかはこのプロセスには分からない
+	upstream := func(id byte) context.Context {
+		ts, err := oteltrace.TraceState{}.Insert(traceStateKey, traceStateDeferred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oteltrace.ContextWithRemoteSpanContext(context.Background(), oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID: oteltrace.TraceID{id}, SpanID: oteltrace.SpanID{id}, TraceFlags: oteltrace.FlagsSampled, TraceState: ts, Remote: true,
+		}))
+	}
+	request := func(ctx context.Context, childStatus codes.Code) oteltrace.SpanContext {
+		ctx, server := tracer.Start(ctx, "GET /users/{id}", oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+		_, child := tracer.Start(ctx, "db.Query")
+		child.SetStatus(childStatus, "")
+		child.End()
+		server.End()
+		return server.SpanContext()
+	}
+
+	failed := request(upstream(1), codes.Error)
+	ok := request(upstream(2), codes.Unset)
+
+	// リモートの親を持つサーバースパンがローカルのルートになり、ここで判定する。
+	// 失敗したトレースはこのプロセスの分だけ残る（上流が捨てれば親の欠けたトレースになる）
+	exported := map[oteltrace.TraceID]int{}
+	for _, s := range exporter.GetSpans() {
+		exported[s.SpanContext.TraceID()]++
+	}
+	if got := exported[failed.TraceID()]; got != 2 {
+		t.Errorf("failed trace: exported %d spans, want the server and db spans", got)
+	}
+	if got := exported[ok.TraceID()]; got != 0 {
+		t.Errorf("successful trace: exported %d spans, want 0", got)
+	}
+	if !Deferred(failed) || !Deferred(ok) {
+		t.Error("the deferred marker of the remote parent is not inherited")
+	}
+
+	decisions := h.Metric(t, "sampling_decisions_total")
+	for _, decision := range []string{DecisionKeptError, DecisionDropped} {
+		if got := telemetrytest.SumPoint[int64](t, decisions, DecisionKey.String(decision)).Value; got != 1 {
+			t.Errorf("%s = %d, want 1", decision, got)
+		}
+	}
+}
+
+func TestConcurrentLocalRootsInOneTraceAreDecidedSeparately(t *testing.T) {
+	h := telemetrytest.New(t)
+	p, err := ForRules("user-service", testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, exporter := newTestProvider(t, p)
+	tracer := tp.Tracer("test")
+
+	// 上流が同じトレースの中でこのサービスを 2 回同時に呼ぶ（fanout など）
+	ts, err := oteltrace.TraceState{}.Insert(traceStateKey, traceStateDeferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := func(id byte) context.Context {
+		return oteltrace.ContextWithRemoteSpanContext(context.Background(), oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID: oteltrace.TraceID{1}, SpanID: oteltrace.SpanID{id}, TraceFlags: oteltrace.FlagsSampled, TraceState: ts, Remote: true,
+		}))
+	}
+	failedCtx, failed := tracer.Start(upstream(1), "GET /users/{id}", oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+	okCtx, ok := tracer.Start(upstream(2), "GET /users/{id}", oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+	_, failedChild := tracer.Start(failedCtx, "db.Query")
+	_, okChild := tracer.Start(okCtx, "db.Query")
+	failedChild.SetStatus(codes.Error, "")
+	failedChild.End()
+	okChild.End()
+
+	// 正常な方が先に終わっても、もう一方の失敗した子スパンで残すことにはならない
+	ok.End()
+	failed.End()
+
+	exported := map[oteltrace.SpanID]bool{}
+	for _, s := range exporter.GetSpans() {
+		exported[s.SpanContext.SpanID()] = true
+	}
+	for _, tt := range []struct {
+		name string
+		span oteltrace.Span
+		want bool
+	}{{"failed root", failed, true}, {"failed child", failedChild, true}, {"ok root", ok, false}, {"ok child", okChild, false}} {
+		if got := exported[tt.span.SpanContext().SpanID()]; got != tt.want {
+			t.Errorf("%s: exported %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	decisions := h.Metric(t, "sampling_decisions_total")
+	for _, decision := range []string{DecisionKeptError, DecisionDropped} {
+		if got := telemetrytest.SumPoint[int64](t, decisions, DecisionKey.String(decision)).Value; got != 1 {
+			t.Errorf("%s = %d, want 1", decision, got)
+		}
+	}
+}
+
+func TestExemplarFilterSkipsUndecidedTraces(t *testing.T) {
+	telemetrytest.New(t)
+	p, err := ForRules("user-service", testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, _ := newTestProvider(t, p)
+	tracer := tp.Tracer("test")
+	filter := p.ExemplarFilter(exemplar.TraceBasedFilter)
+
+	ctx, sampled := tracer.Start(context.Background(), "GET /users/{id}")
+	if !filter(ctx) {
+		t.Error("no exemplar for a sampled trace")
+	}
+	sampled.End()
+
+	ctx, deferred := tracer.Start(context.Background(), "GET /users")
+	if filter(ctx) {
+		t.Error("exemplar for a deferred trace that may be dropped")
+	}
+	deferred.SetStatus(codes.Error, "")
+	if !filter(ctx) {
+		t.Error("no exemplar for a failed deferred trace")
+	}
+	deferred.End()
+
+	ctx, slow := tracer.Start(context.Background(), "GET /users", oteltrace.WithTimestamp(time.Now().Add(-time.Second)))
+	if !filter(ctx) {
+		t.Error("no exemplar for a deferred trace already past the slow threshold")
+	}
+	slow.End()
+
+	if filter(context.Background()) {
+		t.Error("exemplar without a span")
+	}
+}
+
+func TestStandardSamplersDoNotWrap(t *testing.T) {
+	t.Setenv(EnvSampler, "always_on")
+	p, err := FromEnv("user-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter())
+	if got, err := p.WrapProcessor(next); err != nil || got != next {
+		t.Errorf("WrapProcessor = %v, %v, want next unchanged", got, err)
+	}
+	if p.String() != "always_on" {
+		t.Errorf("String() = %q", p.String())
+	}
+}
@@ -0,0 +1,125 @@
+// Package server は SIGINT/SIGTERM で安全に停止する HTTP サーバーを提供するパッケージ
+//
+// シグナルを受けると、まず readiness を落として（Draining が true になる）
+// DrainDelay の間はリクエストを受け続け、ロードバランサーが振り分けを止める時間を作る。
+// その後リスナーを閉じ、処理中のリクエストを ShutdownTimeout まで待ってから戻る。
+// テレメトリーのフラッシュは Run が戻った後に呼び出し側の defer で行う。
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Options controls how a Server shuts down.
+type Options struct {
+	// Name is used in log messages.
+	Name string
+	// DrainDelay is how long to keep serving after Draining turns true.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds the wait for in-flight requests. Connections
+	// still open afterwards are closed forcibly. Defaults to 10s.
+	ShutdownTimeout time.Duration
+}
+
+// ErrDraining is returned by CheckReady once shutdown has started.
+var ErrDraining = errors.New("server is shutting down")
+
+// Server is an http.Server that stops gracefully on SIGINT/SIGTERM or when
+// the context passed to Run is canceled.
+type Server struct {
+	http     *http.Server
+	opts     Options
+	draining atomic.Bool
+}
+
+// New returns a Server for handler on addr.
+func New(addr string, handler http.Handler, opts Options) *Server {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 10 * time.Second
+	}
+	s := &Server{opts: opts}
+	s.http = &http.Server{
+		Addr:              addr,
+		Handler:           s.wrap(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Draining reports whether shutdown has started. Readiness checks should
+// fail once it returns true.
+func (s *Server) Draining() bool { return s.draining.Load() }
+
+// CheckReady is a readiness check that fails with ErrDraining while the
+// server is shutting down, so that health checks fail before the listener
+// goes away.
+func (s *Server) CheckReady(context.Context) error {
+	if s.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Run listens on the configured address and serves until a signal arrives
+// or ctx is canceled, then shuts down gracefully. It returns nil after a
+// clean shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is Run on an existing listener.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.http.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// 2 回目のシグナルでは待たずに終了できるよう既定の動作に戻す
+	stop()
+
+	s.draining.Store(true)
+	slog.Info("🛑 Shutting down, draining", "server", s.opts.Name, "drain_delay", s.opts.DrainDelay)
+	time.Sleep(s.opts.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		// 期限内に終わらなかった接続は切断する
+		slog.Warn("⚠️  In-flight requests did not finish", "server", s.opts.Name, "shutdown_timeout", s.opts.ShutdownTimeout, "error", err)
+		return errors.Join(err, s.http.Close())
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("✅ All in-flight requests finished", "server", s.opts.Name)
+	return nil
+}
+
+// wrap は停止中に keep-alive を切り、クライアントが新しい接続で振り分け直せるようにする
+func (s *Server) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	var s *Server
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.CheckReady(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	s = New("", mux, Options{Name: "test", DrainDelay: 50 * time.Millisecond, ShutdownTimeout: time.Second})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln) }()
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+	cancel()
+
+	// DrainDelay の間はヘルスチェックだけが 503 になる
+	time.Sleep(10 * time.Millisecond)
+	if !s.Draining() {
+		t.Fatal("Draining = false after cancel")
+	}
+	resp, err := http.Get(base + "/health")
+	if err != nil {
+		t.Fatalf("health check during drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health during drain = %d, want 503", resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Error("response during drain did not ask the client to close the connection")
+	}
+
+	if body := <-slow; body != "done" {
+		t.Errorf("in-flight request = %q, want done", body)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve = %v, want nil", err)
+	}
+	if _, err := http.Get(base + "/health"); err == nil {
+		t.Error("server still accepts connections after Serve returned")
+	}
+}
+
+func TestServeGivesUpAfterShutdownTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+	})
+
+	s := New("", handler, Options{Name: "test", ShutdownTimeout: 50 * time.Millisecond})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln) }()
+
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Serve = nil, want the shutdown deadline error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after ShutdownTimeout")
+	}
+}
+
+func TestRunReportsListenErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := New(ln.Addr().String(), http.NotFoundHandler(), Options{Name: "test"})
+	if err := s.Run(context.Background()); err == nil {
+		t.Error("Run on a busy address = nil, want an error")
+	}
+}
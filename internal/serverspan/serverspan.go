@@ -0,0 +1,92 @@
+// Package serverspan は otelhttp のサーバースパンをルートのパターンで命名するパッケージ
+//
+// ハンドラは自分でトレースコンテキストを抽出したりスパンを開始したりせず、
+// r.Context() にある otelhttp のサーバースパンへ属性（user.id や db.rows など）を足す。
+// スパン名とルートはどのサービスでも "{method} {route}" と http.route の同じ形になる。
+//
+// 5xx を返したリクエストのスパンは、レスポンスヘッダーを書いた時点でエラーにする。
+// otelhttp もスパンの終了時に同じ状態を付けるが、エクスペンプラーを付けるか
+// （internal/sampling の遅延判定）はメトリクスを記録した時点のスパンの状態で決まるため。
+package serverspan
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/httpmetrics"
+)
+
+// RowsKey is the number of rows a handler read from the database for the
+// request, set on the server span.
+const RowsKey = attribute.Key("db.rows")
+
+// NewHandler wraps next with otelhttp.NewHandler. Each server span is named
+// "{method} {route}" after the pattern in routes that matches the request,
+// e.g. "GET /users/{id}", and carries that route as http.route. Requests
+// that match no pattern are named by their method only. routes is the mux
+// behind next; it is only used to look up the pattern, so spans are named
+// by route even when next answers before reaching the mux. A 5xx response
+// marks the span as an error as soon as its header is written, so
+// middleware inside next (httpmetrics) already sees the final status.
+func NewHandler(routes *http.ServeMux, next http.Handler, operation string, opts ...otelhttp.Option) http.Handler {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := oteltrace.SpanFromContext(r.Context())
+		if route := httpmetrics.Route(pattern(routes, r)); route != "" {
+			span.SetAttributes(semconv.HTTPRouteKey.String(route))
+		}
+		next.ServeHTTP(&statusWriter{ResponseWriter: w, span: span}, r)
+	})
+	opts = append(opts, otelhttp.WithSpanNameFormatter(SpanName(routes)))
+	return otelhttp.NewHandler(inner, operation, opts...)
+}
+
+// SpanName returns an otelhttp span name formatter that names spans
+// "{method} {route}" after the pattern in routes that matches the request.
+func SpanName(routes *http.ServeMux) func(operation string, r *http.Request) string {
+	return func(_ string, r *http.Request) string {
+		if route := httpmetrics.Route(pattern(routes, r)); route != "" {
+			return r.Method + " " + route
+		}
+		return r.Method
+	}
+}
+
+// pattern は mux が設定した r.Pattern を優先し、まだ mux に届いていなければ routes に問い合わせる
+func pattern(routes *http.ServeMux, r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	_, pattern := routes.Handler(r)
+	return pattern
+}
+
+// statusWriter は最初に書かれた最終ステータスが 5xx ならスパンをエラーにする
+type statusWriter struct {
+	http.ResponseWriter
+	span    oteltrace.Span
+	written bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	// 1xx は最終的なステータスではない
+	if !w.written && status >= 200 {
+		w.written = true
+		if status >= http.StatusInternalServerError {
+			w.span.SetStatus(codes.Error, "")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap は http.ResponseController が Flush などを元の ResponseWriter に届けるために使う
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
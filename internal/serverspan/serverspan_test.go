@@ -0,0 +1,131 @@
+package serverspan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+func newTestHandler(wrap func(http.Handler) http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// ハンドラは新しいスパンを開始せず、サーバースパンに属性を足す
+		oteltrace.SpanFromContext(r.Context()).SetAttributes(RowsKey.Int(1))
+	})
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {})
+
+	var next http.Handler = mux
+	if wrap != nil {
+		next = wrap(mux)
+	}
+	return NewHandler(mux, next, "svc", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/livez"
+	}))
+}
+
+func TestSpanIsNamedByRouteAndKeepsRemoteParent(t *testing.T) {
+	h := telemetrytest.New(t)
+	handler := newTestHandler(nil)
+
+	ctx, client := otel.Tracer("test").Start(context.Background(), "client", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	r := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	client.End()
+
+	server := h.Span(t, "GET /items/{id}")
+	if server.SpanKind != oteltrace.SpanKindServer {
+		t.Errorf("span kind = %v, want server", server.SpanKind)
+	}
+	if server.Parent.SpanID() != client.SpanContext().SpanID() || !server.Parent.IsRemote() {
+		t.Errorf("parent = %v, want remote client span %v", server.Parent.SpanID(), client.SpanContext().SpanID())
+	}
+	if got := telemetrytest.Attr(server, semconv.HTTPRouteKey).AsString(); got != "/items/{id}" {
+		t.Errorf("http.route = %q, want /items/{id}", got)
+	}
+	if got := telemetrytest.Attr(server, RowsKey).AsInt64(); got != 1 {
+		t.Errorf("db.rows = %d, want 1", got)
+	}
+	if spans := h.Spans(); len(spans) != 2 {
+		t.Errorf("got %d spans, want the client and server spans only", len(spans))
+	}
+}
+
+func TestSpanIsNamedByRouteWhenAnsweredBeforeTheMux(t *testing.T) {
+	h := telemetrytest.New(t)
+	// 障害注入のようにミドルウェアが mux に届く前に応答する
+	handler := newTestHandler(func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "injected fault", http.StatusServiceUnavailable)
+		})
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+
+	h.Span(t, "GET /items/{id}")
+}
+
+func TestServerErrorMarksSpanBeforeInnerMiddlewareFinishes(t *testing.T) {
+	h := telemetrytest.New(t)
+	// 内側のミドルウェア（httpmetrics の位置）が応答後に見るスパンの状態を残す
+	var seen codes.Code
+	handler := newTestHandler(func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "injected fault", http.StatusServiceUnavailable)
+			seen = oteltrace.SpanFromContext(r.Context()).(sdktrace.ReadOnlySpan).Status().Code
+		})
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+
+	if seen != codes.Error {
+		t.Errorf("span status seen inside the handler = %v, want error", seen)
+	}
+	if got := h.Span(t, "GET /items/{id}").Status.Code; got != codes.Error {
+		t.Errorf("span status = %v, want error", got)
+	}
+}
+
+func TestClientErrorDoesNotMarkSpan(t *testing.T) {
+	h := telemetrytest.New(t)
+	handler := newTestHandler(func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "not found", http.StatusNotFound)
+		})
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+
+	if got := h.Span(t, "GET /items/{id}").Status.Code; got != codes.Unset {
+		t.Errorf("span status = %v, want unset for a 4xx", got)
+	}
+}
+
+func TestUnmatchedAndFilteredRequests(t *testing.T) {
+	h := telemetrytest.New(t)
+	handler := newTestHandler(nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	// マッチしないリクエストはメソッドだけで命名し、http.route を付けない
+	server := h.Span(t, "GET")
+	if route := telemetrytest.Attr(server, semconv.HTTPRouteKey); route.Type() != attribute.INVALID {
+		t.Errorf("unmatched request has http.route: %v", server.Attributes)
+	}
+	if spans := h.Spans(); len(spans) != 1 {
+		t.Errorf("got %d spans, want the /livez probe filtered", len(spans))
+	}
+}
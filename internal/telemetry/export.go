@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exportResult は最後のエクスポートの結果を保持する
+type exportResult struct {
+	signal string
+
+	mu  sync.Mutex
+	at  time.Time
+	err error
+}
+
+func (r *exportResult) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.at, r.err = time.Now(), err
+}
+
+func (r *exportResult) check() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		// まだ一度もエクスポートしていない場合も成功扱い
+		return nil
+	}
+	return fmt.Errorf("last %s export %s ago failed: %w", r.signal, time.Since(r.at).Round(time.Second), r.err)
+}
+
+// Setup が作ったエクスポーターの結果
+var (
+	traceExport  = &exportResult{signal: "trace"}
+	metricExport = &exportResult{signal: "metric"}
+	logExport    = &exportResult{signal: "log"}
+)
+
+// CheckExport returns an error if the most recent trace, metric or log export
+// by the providers from Setup failed. It is meant as a readiness check and
+// reports success until the first export has been attempted.
+func CheckExport(context.Context) error {
+	return errors.Join(traceExport.check(), metricExport.check(), logExport.check())
+}
+
+type recordingSpanExporter struct {
+	trace.SpanExporter
+	result *exportResult
+}
+
+func (e recordingSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.result.record(err)
+	return err
+}
+
+type recordingMetricExporter struct {
+	sdkmetric.Exporter
+	result *exportResult
+}
+
+func (e recordingMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	e.result.record(err)
+	return err
+}
+
+type recordingLogExporter struct {
+	sdklog.Exporter
+	result *exportResult
+}
+
+func (e recordingLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	err := e.Exporter.Export(ctx, records)
+	e.result.record(err)
+	return err
+}
@@ -0,0 +1,212 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// OTEL_EXPORTER_OTLP_PROTOCOL の値。Go の OTLP エクスポーターは http/json を実装していないので、
+// http/json が指定されたら警告を出して http/protobuf で送る（コレクターはどちらも受け付ける）
+const (
+	protocolGRPC         = "grpc"
+	protocolHTTPProtobuf = "http/protobuf"
+	protocolHTTPJSON     = "http/json"
+)
+
+const compressionGzip = "gzip"
+
+// エンドポイントが設定されていないときにエクスポーターが使う送り先
+const (
+	defaultGRPCEndpoint = "http://localhost:4317"
+	defaultHTTPEndpoint = "http://localhost:4318"
+)
+
+// otlpSettings は 1 つのシグナルの OTLP エクスポーター設定。
+// エンドポイントとヘッダーは各エクスポーターが OTEL_EXPORTER_OTLP_* から直接読む
+type otlpSettings struct {
+	protocol string
+	// requested は protocol の代わりに指定されていた未対応のプロトコル（http/json）
+	requested string
+	// endpoint はエクスポーターが送る先。表示用で、エクスポーターには渡さない
+	endpoint string
+	// compression は "gzip" か ""（圧縮しない）
+	compression string
+	// timeout が 0 ならエクスポーターの既定値（10s）
+	timeout time.Duration
+}
+
+func (s otlpSettings) String() string {
+	str := s.protocol
+	if s.compression != "" {
+		str += "+" + s.compression
+	}
+	str += " " + s.endpoint
+	if s.requested != "" {
+		str += fmt.Sprintf(" (instead of %s)", s.requested)
+	}
+	if s.timeout > 0 {
+		str += fmt.Sprintf(" (timeout %s)", s.timeout)
+	}
+	return str
+}
+
+// Target describes where signal ("traces", "metrics" or "logs") is exported
+// as resolved from the OTEL_EXPORTER_OTLP_* variables, e.g.
+// "http/protobuf http://localhost:4318/v1/metrics", for startup banners.
+func Target(signal string) string {
+	s, err := otlpSettingsFromEnv(strings.ToUpper(signal))
+	if err != nil {
+		return err.Error()
+	}
+	return s.String()
+}
+
+// NewMetricExporter returns the OTLP metric exporter Setup would use, for
+// tools that build their own MeterProvider and leave the global providers
+// and the default slog logger alone.
+func NewMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	s, err := otlpSettingsFromEnv("METRICS")
+	if err != nil {
+		return nil, err
+	}
+	return newMetricExporter(ctx, s)
+}
+
+// otlpSettingsFromEnv は signal（TRACES・METRICS・LOGS）の設定を読む。
+// 仕様どおり OTEL_EXPORTER_OTLP_<SIGNAL>_* を OTEL_EXPORTER_OTLP_* より優先する
+func otlpSettingsFromEnv(signal string) (otlpSettings, error) {
+	lookup := func(name string) (string, string) {
+		key := "OTEL_EXPORTER_OTLP_" + signal + "_" + name
+		if v := os.Getenv(key); v != "" {
+			return key, v
+		}
+		key = "OTEL_EXPORTER_OTLP_" + name
+		return key, os.Getenv(key)
+	}
+
+	s := otlpSettings{protocol: protocolHTTPProtobuf}
+	switch key, v := lookup("PROTOCOL"); v {
+	case "", protocolHTTPProtobuf:
+	case protocolGRPC:
+		s.protocol = protocolGRPC
+	case protocolHTTPJSON:
+		// Go の OTLP エクスポーターは JSON エンコーディングを実装していないので protobuf で送る
+		s.requested = protocolHTTPJSON
+	default:
+		return s, fmt.Errorf("telemetry: %s=%q, want %s, %s or %s", key, v, protocolGRPC, protocolHTTPProtobuf, protocolHTTPJSON)
+	}
+
+	// シグナル別のエンドポイントはそのまま使い、共通のものには HTTP ならシグナルのパスを足す（仕様どおり）
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT"); v != "" {
+		s.endpoint = v
+	} else {
+		s.endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if s.endpoint == "" {
+			s.endpoint = defaultHTTPEndpoint
+			if s.protocol == protocolGRPC {
+				s.endpoint = defaultGRPCEndpoint
+			}
+		}
+		if s.protocol != protocolGRPC {
+			s.endpoint = strings.TrimSuffix(s.endpoint, "/") + "/v1/" + strings.ToLower(signal)
+		}
+	}
+
+	switch key, v := lookup("COMPRESSION"); v {
+	case "", "none":
+	case compressionGzip:
+		s.compression = compressionGzip
+	default:
+		return s, fmt.Errorf("telemetry: %s=%q, want gzip or none", key, v)
+	}
+
+	if key, v := lookup("TIMEOUT"); v != "" {
+		// 仕様ではミリ秒の整数
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return s, fmt.Errorf("telemetry: %s=%q, want a positive number of milliseconds", key, v)
+		}
+		s.timeout = time.Duration(ms) * time.Millisecond
+	}
+	return s, nil
+}
+
+func newSpanExporter(ctx context.Context, s otlpSettings) (trace.SpanExporter, error) {
+	if s.protocol == protocolGRPC {
+		var opts []otlptracegrpc.Option
+		if s.compression == compressionGzip {
+			opts = append(opts, otlptracegrpc.WithCompressor(compressionGzip))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlptracegrpc.WithTimeout(s.timeout))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	var opts []otlptracehttp.Option
+	if s.compression == compressionGzip {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	if s.timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(s.timeout))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+func newMetricExporter(ctx context.Context, s otlpSettings) (sdkmetric.Exporter, error) {
+	if s.protocol == protocolGRPC {
+		var opts []otlpmetricgrpc.Option
+		if s.compression == compressionGzip {
+			opts = append(opts, otlpmetricgrpc.WithCompressor(compressionGzip))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlpmetricgrpc.WithTimeout(s.timeout))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	var opts []otlpmetrichttp.Option
+	if s.compression == compressionGzip {
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	}
+	if s.timeout > 0 {
+		opts = append(opts, otlpmetrichttp.WithTimeout(s.timeout))
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+func newLogExporter(ctx context.Context, s otlpSettings) (sdklog.Exporter, error) {
+	if s.protocol == protocolGRPC {
+		var opts []otlploggrpc.Option
+		if s.compression == compressionGzip {
+			opts = append(opts, otlploggrpc.WithCompressor(compressionGzip))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlploggrpc.WithTimeout(s.timeout))
+		}
+		return otlploggrpc.New(ctx, opts...)
+	}
+
+	var opts []otlploghttp.Option
+	if s.compression == compressionGzip {
+		opts = append(opts, otlploghttp.WithCompression(otlploghttp.GzipCompression))
+	}
+	if s.timeout > 0 {
+		opts = append(opts, otlploghttp.WithTimeout(s.timeout))
+	}
+	return otlploghttp.New(ctx, opts...)
+}
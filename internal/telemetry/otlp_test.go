@@ -0,0 +1,87 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPSettingsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    otlpSettings
+		wantErr string
+	}{
+		{"defaults", nil,
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics"}, ""},
+		{"grpc", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"},
+			otlpSettings{protocol: protocolGRPC, endpoint: "http://localhost:4317"}, ""},
+		{"http/json falls back", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"},
+			otlpSettings{protocol: protocolHTTPProtobuf, requested: protocolHTTPJSON, endpoint: "http://localhost:4318/v1/metrics"}, ""},
+		{"signal protocol over general", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc", "OTEL_EXPORTER_OTLP_METRICS_PROTOCOL": "http/protobuf"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics"}, ""},
+		{"general endpoint gets the signal path", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://collector:4318/v1/metrics"}, ""},
+		{"signal endpoint as is", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT": "http://metrics:9000/otlp"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://metrics:9000/otlp"}, ""},
+		{"grpc endpoint without path", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317"},
+			otlpSettings{protocol: protocolGRPC, endpoint: "http://collector:4317"}, ""},
+		{"gzip", map[string]string{"OTEL_EXPORTER_OTLP_COMPRESSION": "gzip"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics", compression: compressionGzip}, ""},
+		{"none", map[string]string{"OTEL_EXPORTER_OTLP_COMPRESSION": "none"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics"}, ""},
+		{"signal compression over general", map[string]string{"OTEL_EXPORTER_OTLP_COMPRESSION": "gzip", "OTEL_EXPORTER_OTLP_METRICS_COMPRESSION": "none"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics"}, ""},
+		{"timeout", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "2500"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics", timeout: 2500 * time.Millisecond}, ""},
+		{"signal timeout over general", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "2500", "OTEL_EXPORTER_OTLP_METRICS_TIMEOUT": "100"},
+			otlpSettings{protocol: protocolHTTPProtobuf, endpoint: "http://localhost:4318/v1/metrics", timeout: 100 * time.Millisecond}, ""},
+		{"unknown protocol", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "thrift"}, otlpSettings{}, `OTEL_EXPORTER_OTLP_PROTOCOL="thrift"`},
+		{"invalid compression", map[string]string{"OTEL_EXPORTER_OTLP_METRICS_COMPRESSION": "zstd"}, otlpSettings{}, `OTEL_EXPORTER_OTLP_METRICS_COMPRESSION="zstd", want gzip or none`},
+		{"zero timeout", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "0"}, otlpSettings{}, "want a positive number of milliseconds"},
+		{"negative timeout", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "-1"}, otlpSettings{}, "want a positive number of milliseconds"},
+		{"non-integer timeout", map[string]string{"OTEL_EXPORTER_OTLP_METRICS_TIMEOUT": "5s"}, otlpSettings{}, `OTEL_EXPORTER_OTLP_METRICS_TIMEOUT="5s"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 実行環境の設定に左右されないよう、関係する変数をすべて空にしてから設定する
+			for _, name := range []string{"PROTOCOL", "ENDPOINT", "COMPRESSION", "TIMEOUT"} {
+				t.Setenv("OTEL_EXPORTER_OTLP_"+name, "")
+				t.Setenv("OTEL_EXPORTER_OTLP_METRICS_"+name, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := otlpSettingsFromEnv("METRICS")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarget(t *testing.T) {
+	for _, name := range []string{"PROTOCOL", "ENDPOINT", "COMPRESSION", "TIMEOUT"} {
+		t.Setenv("OTEL_EXPORTER_OTLP_"+name, "")
+		t.Setenv("OTEL_EXPORTER_OTLP_LOGS_"+name, "")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_COMPRESSION", "gzip")
+
+	want := "http/protobuf+gzip http://collector:4318/v1/logs (instead of http/json)"
+	if got := Target("logs"); got != want {
+		t.Errorf("Target(logs) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+// Package telemetry は各サービス共通の OpenTelemetry 初期化処理をまとめたパッケージ
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"otel-playground/internal/logging"
+	"otel-playground/internal/sampling"
+)
+
+const (
+	defaultServiceVersion = "1.0.0"
+	defaultMetricInterval = 5 * time.Second
+)
+
+// Options controls how the tracer and meter providers are built.
+type Options struct {
+	// ServiceName is recorded as the service.name resource attribute.
+	ServiceName string
+	// ServiceVersion defaults to "1.0.0".
+	ServiceVersion string
+	// MetricInterval is the export interval of the PeriodicReader. Defaults to 5s.
+	MetricInterval time.Duration
+	// Views are registered on the MeterProvider as-is.
+	Views []sdkmetric.View
+	// ExemplarFilter defaults to exemplar.TraceBasedFilter. When the sampler
+	// defers decisions (parentbased_rules), it is wrapped so that exemplars
+	// only point at traces that are exported.
+	ExemplarFilter exemplar.Filter
+	// Propagator defaults to propagation.TraceContext.
+	Propagator propagation.TextMapPropagator
+	// LogLevel is the minimum level of the default slog logger. Defaults to
+	// slog.LevelInfo.
+	LogLevel slog.Leveler
+}
+
+// ShutdownFunc flushes and stops every provider created by Setup. Pass a
+// context with a deadline so an unreachable collector cannot block exit.
+type ShutdownFunc func(context.Context) error
+
+// DefaultShutdownTimeout bounds the final flush in Shutdown.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// Setup builds the TracerProvider, MeterProvider, LoggerProvider and
+// propagator described by opts, registers them globally and returns a single
+// shutdown func. The trace sampler is selected by OTEL_TRACES_SAMPLER (see
+// sampling.FromEnv), and the exporters by OTEL_EXPORTER_OTLP_* (protocol,
+// endpoint, compression and timeout, per signal or shared); http/json is not
+// implemented by the Go exporters and is sent as http/protobuf with a
+// warning. It also replaces the default slog logger (and with it the
+// log package's output) with a logging handler that exports every record
+// over OTLP, linked to the span in its context.
+func Setup(ctx context.Context, opts Options) (ShutdownFunc, error) {
+	if opts.ServiceName == "" {
+		return nil, errors.New("telemetry: service name is required")
+	}
+	if opts.ServiceVersion == "" {
+		opts.ServiceVersion = defaultServiceVersion
+	}
+	if opts.MetricInterval <= 0 {
+		opts.MetricInterval = defaultMetricInterval
+	}
+	if opts.ExemplarFilter == nil {
+		opts.ExemplarFilter = exemplar.TraceBasedFilter
+	}
+	if opts.Propagator == nil {
+		opts.Propagator = propagation.TraceContext{}
+	}
+
+	// プロトコル・圧縮・タイムアウトは OTEL_EXPORTER_OTLP_* 環境変数で切り替える
+	traceSettings, err := otlpSettingsFromEnv("TRACES")
+	if err != nil {
+		return nil, err
+	}
+	metricSettings, err := otlpSettingsFromEnv("METRICS")
+	if err != nil {
+		return nil, err
+	}
+	logSettings, err := otlpSettingsFromEnv("LOGS")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range []otlpSettings{traceSettings, metricSettings, logSettings} {
+		if s.requested != "" {
+			// 起動は止めず、設定が効いていないことだけ知らせる（3 シグナル共通の設定なら 1 回だけ）
+			slog.Warn("⚠️ OTLP protocol is not supported by the Go exporters, falling back", "requested", s.requested, "protocol", s.protocol)
+			break
+		}
+	}
+	// サンプラーは OTEL_TRACES_SAMPLER（parentbased_rules ならルールファイル）で切り替える
+	policy, err := sampling.FromEnv(opts.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	opts.ExemplarFilter = policy.ExemplarFilter(opts.ExemplarFilter)
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(opts.ServiceName),
+			semconv.ServiceVersionKey.String(opts.ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var shutdowns []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		// 後から作ったものから順に停止する
+		for i := len(shutdowns) - 1; i >= 0; i-- {
+			errs = append(errs, shutdowns[i](ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	tp, err := newTracerProvider(ctx, res, traceSettings, policy)
+	if err != nil {
+		return nil, err
+	}
+	shutdowns = append(shutdowns, func(ctx context.Context) error {
+		// バッチに残っているスパンを確実に送ってから停止する
+		return errors.Join(tp.ForceFlush(ctx), tp.Shutdown(ctx))
+	})
+
+	mp, err := newMeterProvider(ctx, res, metricSettings, opts)
+	if err != nil {
+		return nil, errors.Join(err, shutdown(ctx))
+	}
+	shutdowns = append(shutdowns, func(ctx context.Context) error {
+		// 次の収集周期を待たずに最後のメトリクスを送る
+		return errors.Join(mp.ForceFlush(ctx), mp.Shutdown(ctx))
+	})
+
+	lp, err := newLoggerProvider(ctx, res, logSettings)
+	if err != nil {
+		return nil, errors.Join(err, shutdown(ctx))
+	}
+	shutdowns = append(shutdowns, func(ctx context.Context) error {
+		return errors.Join(lp.ForceFlush(ctx), lp.Shutdown(ctx))
+	})
+
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	global.SetLoggerProvider(lp)
+	// トレースコンテキストの伝播設定
+	otel.SetTextMapPropagator(opts.Propagator)
+	// log.Printf も含め、ログはトレースと結び付けてコレクターに送る
+	slog.SetDefault(slog.New(logging.NewHandler(logging.Options{
+		Level:          opts.LogLevel,
+		LoggerProvider: lp,
+	})))
+	slog.Info("📡 OTLP exporters", "traces", traceSettings, "metrics", metricSettings, "logs", logSettings)
+	slog.Info("🎲 Trace sampler", "sampler", policy)
+
+	return shutdown, nil
+}
+
+// Shutdown calls shutdown with DefaultShutdownTimeout and logs any error.
+// Defer it right after Setup.
+func Shutdown(shutdown ShutdownFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Error("Error shutting down telemetry", "error", err)
+	}
+}
+
+func newTracerProvider(ctx context.Context, res *resource.Resource, settings otlpSettings, policy *sampling.Policy) (*trace.TracerProvider, error) {
+	exporter, err := newSpanExporter(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	// 遅延判定のスパンはバッチに渡す前にローカルのルートの終了まで留める
+	processor, err := policy.WrapProcessor(trace.NewBatchSpanProcessor(recordingSpanExporter{exporter, traceExport}))
+	if err != nil {
+		return nil, err
+	}
+
+	return trace.NewTracerProvider(
+		trace.WithSampler(policy.Sampler()),
+		trace.WithSpanProcessor(processor),
+		trace.WithResource(res),
+	), nil
+}
+
+func newMeterProvider(ctx context.Context, res *resource.Resource, settings otlpSettings, opts Options) (*sdkmetric.MeterProvider, error) {
+	exporter, err := newMetricExporter(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(
+		recordingMetricExporter{exporter, metricExport},
+		sdkmetric.WithInterval(opts.MetricInterval),
+	)
+
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(opts.Views...),
+		sdkmetric.WithExemplarFilter(opts.ExemplarFilter),
+	), nil
+}
+
+func newLoggerProvider(ctx context.Context, res *resource.Resource, settings otlpSettings) (*sdklog.LoggerProvider, error) {
+	exporter, err := newLogExporter(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(recordingLogExporter{exporter, logExport})),
+		sdklog.WithResource(res),
+	), nil
+}
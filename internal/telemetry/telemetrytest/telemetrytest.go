@@ -0,0 +1,207 @@
+// Package telemetrytest はスパンとメトリクスをメモリ上に集めるテスト用のプロバイダを提供する。
+// Collector や Jaeger を立てずに go test だけで計装を検証できる
+package telemetrytest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Harness holds in-memory tracer and meter providers registered as the
+// otel globals for the duration of a test.
+type Harness struct {
+	Exporter       *tracetest.InMemoryExporter
+	Reader         *sdkmetric.ManualReader
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+}
+
+// New registers fresh providers globally, mirroring telemetry.Setup
+// (TraceBasedFilter exemplars, TraceContext propagation, the given views),
+// and shuts them down when the test ends. Tests using it must not run in
+// parallel with each other.
+func New(t testing.TB, views ...sdkmetric.View) *Harness {
+	t.Helper()
+
+	h := &Harness{
+		Exporter: tracetest.NewInMemoryExporter(),
+		Reader:   sdkmetric.NewManualReader(),
+	}
+	// Syncer で終了したスパンを即座にエクスポーターへ渡す
+	h.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(h.Exporter))
+	h.MeterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(h.Reader),
+		sdkmetric.WithView(views...),
+		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
+	)
+
+	otel.SetTracerProvider(h.TracerProvider)
+	otel.SetMeterProvider(h.MeterProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+		if err := h.TracerProvider.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown tracer provider: %v", err)
+		}
+		if err := h.MeterProvider.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown meter provider: %v", err)
+		}
+	})
+	return h
+}
+
+// Spans returns every span ended so far.
+func (h *Harness) Spans() tracetest.SpanStubs {
+	return h.Exporter.GetSpans()
+}
+
+// Span returns the only ended span called name and fails the test if there
+// is not exactly one.
+func (h *Harness) Span(t testing.TB, name string) tracetest.SpanStub {
+	t.Helper()
+
+	var found []tracetest.SpanStub
+	for _, s := range h.Spans() {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("want exactly 1 span %q, got %d (spans: %v)", name, len(found), spanNames(h.Spans()))
+	}
+	return found[0]
+}
+
+// Metric collects from the manual reader and returns the metric called name.
+func (h *Harness) Metric(t testing.TB, name string) metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := h.Reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+			names = append(names, m.Name)
+		}
+	}
+	t.Fatalf("metric %q not found (metrics: %v)", name, names)
+	return metricdata.Metrics{}
+}
+
+// SumPoint returns the data point of a counter or up-down counter whose
+// attributes include attrs.
+func SumPoint[N int64 | float64](t testing.TB, m metricdata.Metrics, attrs ...attribute.KeyValue) metricdata.DataPoint[N] {
+	t.Helper()
+
+	sum, ok := m.Data.(metricdata.Sum[N])
+	if !ok {
+		t.Fatalf("metric %q is %T, not a sum", m.Name, m.Data)
+	}
+	for _, dp := range sum.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			return dp
+		}
+	}
+	t.Fatalf("metric %q has no data point with %v", m.Name, attrs)
+	return metricdata.DataPoint[N]{}
+}
+
+// GaugePoint returns the data point of a gauge whose attributes include attrs.
+func GaugePoint[N int64 | float64](t testing.TB, m metricdata.Metrics, attrs ...attribute.KeyValue) metricdata.DataPoint[N] {
+	t.Helper()
+
+	gauge, ok := m.Data.(metricdata.Gauge[N])
+	if !ok {
+		t.Fatalf("metric %q is %T, not a gauge", m.Name, m.Data)
+	}
+	for _, dp := range gauge.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			return dp
+		}
+	}
+	t.Fatalf("metric %q has no data point with %v", m.Name, attrs)
+	return metricdata.DataPoint[N]{}
+}
+
+// HistogramPoint returns the data point of a histogram whose attributes
+// include attrs.
+func HistogramPoint[N int64 | float64](t testing.TB, m metricdata.Metrics, attrs ...attribute.KeyValue) metricdata.HistogramDataPoint[N] {
+	t.Helper()
+
+	hist, ok := m.Data.(metricdata.Histogram[N])
+	if !ok {
+		t.Fatalf("metric %q is %T, not a histogram", m.Name, m.Data)
+	}
+	for _, dp := range hist.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			return dp
+		}
+	}
+	t.Fatalf("metric %q has no data point with %v", m.Name, attrs)
+	return metricdata.HistogramDataPoint[N]{}
+}
+
+// HasExemplarFor reports whether any exemplar belongs to the given span's trace.
+func HasExemplarFor[N int64 | float64](exemplars []metricdata.Exemplar[N], span tracetest.SpanStub) bool {
+	traceID := span.SpanContext.TraceID()
+	for _, e := range exemplars {
+		if string(e.TraceID) == string(traceID[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attr returns the value of key on span, or an invalid Value if absent.
+func Attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// HasEvent reports whether span recorded an event called name
+// (e.g. "exception" from RecordError).
+func HasEvent(span tracetest.SpanStub, name string) bool {
+	for _, e := range span.Events {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttributes(set attribute.Set, want []attribute.KeyValue) bool {
+	for _, kv := range want {
+		v, ok := set.Value(kv.Key)
+		if !ok || v.Type() != kv.Value.Type() || v.Emit() != kv.Value.Emit() {
+			return false
+		}
+	}
+	return true
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	return names
+}
@@ -3,23 +3,39 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
-	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/fanout"
+	"otel-playground/internal/health"
+	"otel-playground/internal/httpclient"
+	"otel-playground/internal/jaegerapi"
+	"otel-playground/internal/promapi"
+	"otel-playground/internal/server"
+	"otel-playground/internal/serverspan"
+	"otel-playground/internal/telemetry"
 )
 
 // API response types
@@ -38,6 +54,14 @@ type Post struct {
 	CreatedAt string `json:"created_at"`
 }
 
+type Comment struct {
+	ID         int    `json:"id"`
+	PostID     int    `json:"post_id"`
+	AuthorName string `json:"author_name"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+}
+
 // External API types (JSONPlaceholder)
 type ExternalPost struct {
 	UserID int    `json:"userId"`
@@ -47,73 +71,40 @@ type ExternalPost struct {
 }
 
 type MicroserviceClient struct {
-	httpClient       *http.Client
+	httpClient       *httpclient.Client
 	userBaseURL      string
 	postBaseURL      string
+	commentBaseURL   string
+	externalBaseURL  string
 	operationCounter metric.Int64Counter
 	operationTime    metric.Float64Histogram
 	errorCounter     metric.Int64Counter
 }
 
-func initTracer() (*trace.TracerProvider, error) {
-	exporter, err := otlptracehttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("orchestrator"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(res),
-	)
-	otel.SetTracerProvider(tp)
-	
-	// トレースコンテキストの伝播設定
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp, nil
+// statusError は下流サービスが 200 以外を返したことを表す
+type statusError struct {
+	StatusCode int
 }
 
-func initMetrics() (*sdkmetric.MeterProvider, error) {
-	exporter, err := otlpmetrichttp.New(context.Background())
-	if err != nil {
-		return nil, err
-	}
+func (e *statusError) Error() string {
+	return fmt.Sprintf("service returned status: %d", e.StatusCode)
+}
 
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("orchestrator"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
+func newMicroserviceClient(cfg *config.Orchestrator) (*MicroserviceClient, error) {
+	// HTTP クライアントにOTEL計装とリトライ（502/503/504、指数バックオフ）、
+	// 接続先ごとのサーキットブレーカーを追加
+	retry := httpclient.DefaultRetryPolicy()
+	retry.MaxAttempts = cfg.RetryMaxAttempts
+	retry.InitialBackoff = cfg.RetryInitialBackoff
+	retry.MaxBackoff = cfg.RetryMaxBackoff
+	breaker := httpclient.DefaultBreakerPolicy()
+	breaker.FailureThreshold = cfg.BreakerFailureThreshold
+	breaker.OpenTimeout = cfg.BreakerOpenTimeout
+	httpClient, err := httpclient.New(retry, breaker)
 	if err != nil {
 		return nil, err
 	}
 
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(5*time.Second))),
-		sdkmetric.WithResource(res),
-	)
-	otel.SetMeterProvider(mp)
-
-	return mp, nil
-}
-
-func newMicroserviceClient() (*MicroserviceClient, error) {
-	// HTTP クライアントにOTEL計装を追加
-	httpClient := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-	}
-
 	meter := otel.Meter("orchestrator")
 
 	operationCounter, err := meter.Int64Counter(
@@ -143,8 +134,10 @@ func newMicroserviceClient() (*MicroserviceClient, error) {
 
 	return &MicroserviceClient{
 		httpClient:       httpClient,
-		userBaseURL:      "http://localhost:8080",
-		postBaseURL:      "http://localhost:8081",
+		userBaseURL:      cfg.UserServiceURL,
+		postBaseURL:      cfg.PostServiceURL,
+		commentBaseURL:   cfg.CommentServiceURL,
+		externalBaseURL:  cfg.ExternalAPIURL,
 		operationCounter: operationCounter,
 		operationTime:    operationTime,
 		errorCounter:     errorCounter,
@@ -171,7 +164,7 @@ func (c *MicroserviceClient) callService(ctx context.Context, url string) ([]byt
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("service returned status: %d", resp.StatusCode)
+		return nil, &statusError{StatusCode: resp.StatusCode}
 	}
 
 	// レスポンスボディを読み取り
@@ -290,6 +283,44 @@ func (c *MicroserviceClient) getUserPosts(ctx context.Context, userID int) ([]Po
 	return posts, nil
 }
 
+func (c *MicroserviceClient) getPostComments(ctx context.Context, postID int) ([]Comment, error) {
+	startTime := time.Now()
+
+	defer func() {
+		duration := time.Since(startTime).Seconds()
+		c.operationCounter.Add(ctx, 1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			semconv.ServiceNameKey.String("comment-service"),
+		))
+		c.operationTime.Record(ctx, duration, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			semconv.ServiceNameKey.String("comment-service"),
+		))
+	}()
+
+	// HTTP通信は自動計装されるため、手動スパン不要
+	url := fmt.Sprintf("%s/comments/by-post?post_id=%d", c.commentBaseURL, postID)
+	body, err := c.callService(ctx, url)
+	if err != nil {
+		c.errorCounter.Add(ctx, 1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			semconv.ServiceNameKey.String("comment-service"),
+		))
+		return nil, err
+	}
+
+	var comments []Comment
+	if err := json.Unmarshal(body, &comments); err != nil {
+		c.errorCounter.Add(ctx, 1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			semconv.ServiceNameKey.String("comment-service"),
+		))
+		return nil, err
+	}
+
+	return comments, nil
+}
+
 func (c *MicroserviceClient) getExternalPost(ctx context.Context, postID int) (*ExternalPost, error) {
 	startTime := time.Now()
 	
@@ -306,7 +337,7 @@ func (c *MicroserviceClient) getExternalPost(ctx context.Context, postID int) (*
 	}()
 
 	// HTTP通信は自動計装されるため、手動スパン不要
-	url := fmt.Sprintf("https://jsonplaceholder.typicode.com/posts/%d", postID)
+	url := fmt.Sprintf("%s/posts/%d", c.externalBaseURL, postID)
 	
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -330,6 +361,14 @@ func (c *MicroserviceClient) getExternalPost(ctx context.Context, postID int) (*
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		c.errorCounter.Add(ctx, 1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("GET"),
+			semconv.ServiceNameKey.String("external-api"),
+		))
+		return nil, &statusError{StatusCode: resp.StatusCode}
+	}
+
 	var post ExternalPost
 	if err := json.NewDecoder(resp.Body).Decode(&post); err != nil {
 		c.errorCounter.Add(ctx, 1, metric.WithAttributes(
@@ -343,12 +382,12 @@ func (c *MicroserviceClient) getExternalPost(ctx context.Context, postID int) (*
 }
 
 // ObservabilityCheck checks if observability tools are working
-func checkObservabilityTools(ctx context.Context, client *MicroserviceClient) {
+func checkObservabilityTools(ctx context.Context, cfg *config.Orchestrator) {
 	fmt.Println("\n🔍 Checking Observability Tools Status...")
 	
 	// Check OTEL Collector health
 	fmt.Printf("📊 OTEL Collector: ")
-	if err := checkHTTPEndpoint("http://localhost:8889/metrics"); err != nil {
+	if err := checkHTTPEndpoint(cfg.CollectorMetricsURL); err != nil {
 		fmt.Printf("❌ Not accessible (%v)\n", err)
 	} else {
 		fmt.Printf("✅ Running (metrics endpoint accessible)\n")
@@ -356,7 +395,7 @@ func checkObservabilityTools(ctx context.Context, client *MicroserviceClient) {
 
 	// Check Prometheus
 	fmt.Printf("📈 Prometheus: ")
-	if err := checkHTTPEndpoint("http://localhost:9090/-/healthy"); err != nil {
+	if err := checkHTTPEndpoint(cfg.PrometheusURL + "/-/healthy"); err != nil {
 		fmt.Printf("❌ Not accessible (%v)\n", err)
 	} else {
 		fmt.Printf("✅ Running\n")
@@ -364,15 +403,15 @@ func checkObservabilityTools(ctx context.Context, client *MicroserviceClient) {
 
 	// Check if Prometheus is scraping OTEL Collector metrics
 	fmt.Printf("🔗 Prometheus ← OTEL Collector: ")
-	if metrics, err := checkPrometheusMetrics(); err != nil {
+	if metrics, err := checkPrometheusMetrics(cfg.PrometheusURL); err != nil {
 		fmt.Printf("❌ Metrics not found (%v)\n", err)
 	} else {
-		fmt.Printf("✅ %d OTEL metrics found\n", metrics)
+		fmt.Printf("✅ %d collector metrics found\n", metrics)
 	}
 
 	// Check Jaeger
 	fmt.Printf("🔍 Jaeger: ")
-	if err := checkHTTPEndpoint("http://localhost:16686/search"); err != nil {
+	if err := checkHTTPEndpoint(cfg.JaegerURL + "/search"); err != nil {
 		fmt.Printf("❌ Not accessible (%v)\n", err)
 	} else {
 		fmt.Printf("✅ Running\n")
@@ -380,7 +419,7 @@ func checkObservabilityTools(ctx context.Context, client *MicroserviceClient) {
 
 	// Check if Jaeger has received traces
 	fmt.Printf("🔗 Jaeger ← OTEL Collector: ")
-	if traces, err := checkJaegerTraces(); err != nil {
+	if traces, err := checkJaegerTraces(cfg.JaegerURL); err != nil {
 		fmt.Printf("❌ Traces not found (%v)\n", err)
 	} else {
 		fmt.Printf("✅ %d services found with traces\n", traces)
@@ -403,43 +442,44 @@ func checkHTTPEndpoint(url string) error {
 	return nil
 }
 
-func checkPrometheusMetrics() (int, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:9090/api/v1/label/__name__/values")
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+// checkPrometheusMetrics は Collector 経由で保存されたメトリクス名（namespace "microservices_"）を数える
+func checkPrometheusMetrics(prometheusURL string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	body, err := io.ReadAll(resp.Body)
+	names, warnings, err := promapi.New(prometheusURL, nil).LabelValues(ctx, "__name__", nil, time.Time{}, time.Time{})
 	if err != nil {
 		return 0, err
 	}
+	for _, w := range warnings {
+		fmt.Printf("⚠️  %s ", w)
+	}
 
-	// Count OTEL-related metrics
-	bodyStr := string(body)
-	otelMetrics := strings.Count(bodyStr, "otel_")
-	
-	return otelMetrics, nil
+	count := 0
+	for _, name := range names {
+		if strings.HasPrefix(name, collectorMetricNamespace) {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no %s* metrics in %d names", collectorMetricNamespace, len(names))
+	}
+	return count, nil
 }
 
-func checkJaegerTraces() (int, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:16686/api/services")
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+// collectorMetricNamespace は otel-collector.yaml の prometheus エクスポーターの namespace
+const collectorMetricNamespace = "microservices_"
 
-	var result struct {
-		Data []string `json:"data"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+// checkJaegerTraces は Jaeger にスパンが届いているサービスの数を返す
+func checkJaegerTraces(jaegerURL string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	services, err := jaegerapi.New(jaegerURL, nil).Services(ctx)
+	if err != nil {
 		return 0, err
 	}
-
-	return len(result.Data), nil
+	return len(services), nil
 }
 
 // 🎯 ViewとExemplarのデモンストレーション
@@ -457,7 +497,7 @@ func demonstrateViewsAndExemplars(ctx context.Context, client *MicroserviceClien
 	}
 	fmt.Println(" ✅")
 	
-	// シナリオ2: 中程度の遅延
+	// シナリオ2: 中程度の遅延（faults/user-service.json のルールで注入）
 	fmt.Printf("2️⃣ Medium latency requests...")
 	for i := 100; i <= 102; i++ {
 		_, err := client.getUser(ctx, i)
@@ -468,7 +508,7 @@ func demonstrateViewsAndExemplars(ctx context.Context, client *MicroserviceClien
 	}
 	fmt.Println(" ✅")
 	
-	// シナリオ3: 高遅延リクエスト（Exemplarで特定できる）
+	// シナリオ3: 高遅延リクエスト（Exemplarで特定できる。遅延はルールで注入）
 	fmt.Printf("3️⃣ High latency request (will create exemplar)...")
 	_, err := client.getUser(ctx, 999)
 	if err != nil {
@@ -492,41 +532,162 @@ func demonstrateViewsAndExemplars(ctx context.Context, client *MicroserviceClien
 	fmt.Println("   - Error rates will be aggregated in error_rate view")
 }
 
-func orchestrateUserData(ctx context.Context, client *MicroserviceClient, userID int) error {
+// demonstrateCircuitBreaker は /error を叩き続けて user-service のサーキットを開き、
+// 開いている間はリクエストが送られないこと、タイムアウト後の試行で閉じることを見せる
+func demonstrateCircuitBreaker(ctx context.Context, client *MicroserviceClient, cfg *config.Orchestrator) {
+	tracer := otel.Tracer("orchestrator")
+	ctx, span := tracer.Start(ctx, "demonstrateCircuitBreaker")
+	defer span.End()
+
+	target, err := url.Parse(client.userBaseURL)
+	if err != nil {
+		fmt.Printf("❌ Invalid user-service URL: %v\n", err)
+		return
+	}
+	host := target.Host
+
+	fmt.Printf("1️⃣ Calling user-service /error until the circuit opens (threshold %d)...\n", cfg.BreakerFailureThreshold)
+	for i := 1; i <= cfg.BreakerFailureThreshold+2; i++ {
+		_, err = client.callServiceIgnoreError(ctx, fmt.Sprintf("%s/error", client.userBaseURL))
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			fmt.Printf("   call %d: ⛔ rejected without reaching user-service (state=%s)\n", i, client.httpClient.BreakerState(host))
+		} else {
+			fmt.Printf("   call %d: %v (state=%s)\n", i, err, client.httpClient.BreakerState(host))
+		}
+	}
+
+	fmt.Printf("2️⃣ Waiting %s for the circuit to half-open...\n", cfg.BreakerOpenTimeout)
+	time.Sleep(cfg.BreakerOpenTimeout)
+
+	// 正常なエンドポイントへの試行が成功すればサーキットは閉じる
+	if _, err := client.callService(ctx, fmt.Sprintf("%s/livez", client.userBaseURL)); err != nil {
+		fmt.Printf("   probe failed: %v (state=%s)\n", err, client.httpClient.BreakerState(host))
+	} else {
+		fmt.Printf("   probe succeeded (state=%s)\n", client.httpClient.BreakerState(host))
+	}
+
+	fmt.Println("✨ Circuit breaker demonstration completed!")
+	fmt.Println("   - State transitions are span events on 'demonstrateCircuitBreaker'")
+	fmt.Println("   - State per target is the 'http_client_circuit_state' gauge")
+}
+
+// UserProfile はユーザー・投稿（コメント付き）・外部投稿をまとめたもの。
+// サーバーモードでは GET /users/{id}/profile のレスポンスになる
+type UserProfile struct {
+	User         *User              `json:"user"`
+	Posts        []PostWithComments `json:"posts"`
+	ExternalPost *ExternalPost      `json:"external_post"`
+}
+
+type PostWithComments struct {
+	Post
+	Comments []Comment `json:"comments"`
+}
+
+// fetchUserProfile は独立した呼び出しを concurrency 件まで同時に行ってプロフィールを組み立てる。
+// concurrency が 1 なら従来通り順番に呼ぶ（Jaeger でウォーターフォールを比較できる）
+func fetchUserProfile(ctx context.Context, client *MicroserviceClient, userID int, concurrency int) (*UserProfile, error) {
+	// 1〜3. ユーザー・投稿・外部投稿は互いに独立しているので同時に取得する
+	var (
+		user         *User
+		posts        []Post
+		externalPost *ExternalPost
+	)
+	g, _ := fanout.WithContext(ctx, concurrency)
+	mode := config.ModeParallel
+	if g.Sequential() {
+		mode = config.ModeSequential
+	}
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("user.id", userID),
+			attribute.String("orchestration.mode", mode),
+			attribute.Int("orchestration.concurrency", concurrency),
+		)
+	}
+
+	g.Go("fetchUser", func(ctx context.Context) (err error) {
+		// user-service経由
+		if user, err = client.getUser(ctx, userID); err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		return nil
+	})
+	g.Go("fetchUserPosts", func(ctx context.Context) (err error) {
+		// post-service経由
+		if posts, err = client.getUserPosts(ctx, userID); err != nil {
+			return fmt.Errorf("failed to get user posts: %w", err)
+		}
+		return nil
+	})
+	g.Go("fetchExternalPost", func(ctx context.Context) (err error) {
+		// 外部APIから投稿を取得（比較用）
+		if externalPost, err = client.getExternalPost(ctx, 1); err != nil {
+			return fmt.Errorf("failed to get external post: %w", err)
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// 4. 各投稿のコメントを取得（comment-service経由）。投稿一覧に依存するので 2 段目で並行に取得
+	comments := make([][]Comment, len(posts))
+	g, commentsCtx := fanout.WithContext(ctx, concurrency)
+	for i, post := range posts {
+		// 取得に失敗したりリクエストがキャンセルされたりしたら、残りの投稿の分は始めない
+		if commentsCtx.Err() != nil {
+			break
+		}
+		g.Go("fetchPostComments", func(ctx context.Context) (err error) {
+			if comments[i], err = client.getPostComments(ctx, post.ID); err != nil {
+				return fmt.Errorf("failed to get comments for post %d: %w", post.ID, err)
+			}
+			return nil
+		}, attribute.Int("post.id", post.ID))
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	profile := &UserProfile{User: user, ExternalPost: externalPost, Posts: make([]PostWithComments, len(posts))}
+	for i, post := range posts {
+		profile.Posts[i] = PostWithComments{Post: post, Comments: comments[i]}
+	}
+	return profile, nil
+}
+
+func orchestrateUserData(ctx context.Context, client *MicroserviceClient, userID int, concurrency int) error {
 	// 複数サービスの統合処理なので、ビジネスロジック用のスパンを作成
 	tracer := otel.Tracer("orchestrator")
 	ctx, span := tracer.Start(ctx, "orchestrateUserData")
 	defer span.End()
 
-	// 1. ユーザー情報を取得（user-service経由）
-	user, err := client.getUser(ctx, userID)
+	profile, err := fetchUserProfile(ctx, client, userID, concurrency)
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		return err
 	}
+	user, externalPost := profile.User, profile.ExternalPost
 
 	fmt.Printf("=== User Information ===\n")
 	fmt.Printf("User ID: %d\n", user.ID)
 	fmt.Printf("Name: %s\n", user.Name)
 	fmt.Printf("Email: %s\n", user.Email)
 
-	// 2. ユーザーの投稿を取得（post-service経由）
-	posts, err := client.getUserPosts(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user posts: %w", err)
-	}
-
 	fmt.Printf("\n=== User Posts (from post-service) ===\n")
-	for i, post := range posts {
+	for i, post := range profile.Posts {
 		if i >= 3 { // 最初の3件のみ表示
 			break
 		}
 		fmt.Printf("Post %d: %s\n", post.ID, post.Title)
 	}
 
-	// 3. 外部APIから投稿を取得（比較用）
-	externalPost, err := client.getExternalPost(ctx, 1)
-	if err != nil {
-		return fmt.Errorf("failed to get external post: %w", err)
+	fmt.Printf("\n=== Post Comments (from comment-service) ===\n")
+	for _, post := range profile.Posts {
+		fmt.Printf("Post %d: %d comments\n", post.ID, len(post.Comments))
+		for _, comment := range post.Comments {
+			fmt.Printf("  - %s: %s\n", comment.AuthorName, comment.Content)
+		}
 	}
 
 	fmt.Printf("\n=== External Post (JSONPlaceholder) ===\n")
@@ -534,7 +695,7 @@ func orchestrateUserData(ctx context.Context, client *MicroserviceClient, userID
 	fmt.Printf("Title: %s\n", externalPost.Title)
 	fmt.Printf("Body: %s\n", externalPost.Body)
 
-	// 4. エラーエンドポイントを呼び出してエラートレーシングをテスト
+	// 5. エラーエンドポイントを呼び出してエラートレーシングをテスト
 	fmt.Printf("\n=== Testing Error Tracing ===\n")
 	
 	// user-serviceのエラーエンドポイント
@@ -554,43 +715,142 @@ func orchestrateUserData(ctx context.Context, client *MicroserviceClient, userID
 	return nil
 }
 
+// profileHandler は GET /users/{id}/profile でユーザー・投稿（コメント付き）・外部投稿をまとめて返す
+func profileHandler(client *MicroserviceClient, concurrency int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// サーバースパンは otelhttp が作るので、下流呼び出しはその子になる
+		ctx := r.Context()
+
+		userID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || userID <= 0 {
+			writeAPIError(ctx, w, http.StatusBadRequest, errors.New("invalid user id"))
+			return
+		}
+
+		profile, err := fetchUserProfile(ctx, client, userID, concurrency)
+		if err != nil {
+			writeAPIError(ctx, w, upstreamStatus(err), err)
+			return
+		}
+
+		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+			span.SetAttributes(attribute.Int("profile.posts", len(profile.Posts)))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(profile); err != nil {
+			slog.ErrorContext(ctx, "failed to encode profile", "error", err)
+		}
+	}
+}
+
+// upstreamStatus は下流のエラーを API のステータスコードに変換する
+func upstreamStatus(err error) int {
+	var se *statusError
+	switch {
+	case errors.As(err, &se) && se.StatusCode == http.StatusNotFound:
+		return http.StatusNotFound
+	case errors.Is(err, httpclient.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeAPIError(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// serveAPI はオーケストレーターを集約 API（BFF）として起動し、ctx がキャンセルされるかシグナルで停止する
+func serveAPI(ctx context.Context, cfg *config.Orchestrator, client *MicroserviceClient) error {
+	probes := health.New("orchestrator", health.Options{
+		Timeout:     cfg.HealthCheckTimeout,
+		TraceChecks: cfg.TraceHealthChecks,
+	})
+	probes.Add("otlp_exporter", false, telemetry.CheckExport)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}/profile", profileHandler(client, cfg.Concurrency()))
+	probes.Register(mux)
+
+	// HTTP計装でラップ（スパン名は "GET /users/{id}/profile" のようにルートで付ける）
+	handler := serverspan.NewHandler(mux, mux, "orchestrator", otelhttp.WithFilter(probes.Filter))
+
+	fmt.Printf("🚀 Orchestrator API starting on %s\n", cfg.ListenAddr)
+	fmt.Println("📊 Endpoints:")
+	fmt.Println("  GET /users/1/profile - User, posts with comments and external post")
+	fmt.Println("  GET /livez - Liveness probe")
+	fmt.Println("  GET /readyz, GET /health - Readiness with per-component checks")
+	fmt.Printf("🔀 Orchestration mode: %s (max concurrency %d)\n", cfg.OrchestrationMode, cfg.Concurrency())
+
+	srv := server.New(cfg.ListenAddr, handler, server.Options{
+		Name:            "orchestrator",
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	})
+	// 停止が始まったら readiness を落とす
+	probes.Add("server", true, srv.CheckReady)
+	return srv.Run(ctx)
+}
+
 func main() {
-	tp, err := initTracer()
-	if err != nil {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// -h は使い方を表示して正常終了する
+			return
+		}
 		log.Fatal(err)
 	}
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}()
+}
 
-	mp, err := initMetrics()
+// run はシグナル受信時やエラー時にもルートスパンの終了とテレメトリーのフラッシュが実行されるよう main から分けている
+func run() error {
+	cfg, err := config.LoadOrchestrator(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if err := mp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down meter provider: %v", err)
-		}
-	}()
+	cfg.Print(os.Stdout)
+
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{ServiceName: "orchestrator"})
+	if err != nil {
+		return err
+	}
+	defer telemetry.Shutdown(shutdown)
 
 	// マイクロサービスクライアントを初期化
-	client, err := newMicroserviceClient()
+	client, err := newMicroserviceClient(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	// SIGINT/SIGTERM で途中終了してもスパンを閉じてフラッシュする
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// サーバーモードではデモを実行せずに API を提供し続ける
+	if cfg.Serve {
+		return serveAPI(ctx, cfg, client)
 	}
 
 	// メインのオーケストレーション処理を開始
 	tracer := otel.Tracer("orchestrator")
-	ctx, mainSpan := tracer.Start(context.Background(), "main_orchestration")
+	ctx, mainSpan := tracer.Start(ctx, "main_orchestration")
 	defer mainSpan.End()
 
 	fmt.Println("🚀 Starting microservice orchestration...")
 	fmt.Println("📊 This will call:")
-	fmt.Println("  - user-service (localhost:8080)")
-	fmt.Println("  - post-service (localhost:8081)")
-	fmt.Println("  - JSONPlaceholder API (external)")
+	fmt.Printf("  - user-service (%s)\n", cfg.UserServiceURL)
+	fmt.Printf("  - post-service (%s)\n", cfg.PostServiceURL)
+	fmt.Printf("  - comment-service (%s)\n", cfg.CommentServiceURL)
+	fmt.Printf("  - JSONPlaceholder-compatible API (%s)\n", cfg.ExternalAPIURL)
+	fmt.Printf("🔀 Orchestration mode: %s (max concurrency %d)\n", cfg.OrchestrationMode, cfg.Concurrency())
 	fmt.Println()
 
 	// Wait a bit for services to start up and register metrics/traces
@@ -598,11 +858,13 @@ func main() {
 	time.Sleep(3 * time.Second)
 
 	// Check observability tools status before starting
-	checkObservabilityTools(ctx, client)
+	checkObservabilityTools(ctx, cfg)
 
 	userID := 1
-	if err := orchestrateUserData(ctx, client, userID); err != nil {
-		log.Fatalf("Orchestration failed: %v", err)
+	if err := orchestrateUserData(ctx, client, userID, cfg.Concurrency()); err != nil {
+		mainSpan.RecordError(err)
+		mainSpan.SetStatus(codes.Error, "orchestration failed")
+		return fmt.Errorf("orchestration failed: %w", err)
 	}
 
 	fmt.Println("\n✅ Orchestration completed successfully!")
@@ -610,6 +872,10 @@ func main() {
 	// 🎯 ViewとExemplarのデモ
 	fmt.Println("\n🎯 Demonstrating Views and Exemplars...")
 	demonstrateViewsAndExemplars(ctx, client)
+
+	// 🔌 サーキットブレーカーのデモ
+	fmt.Println("\n🔌 Demonstrating circuit breaker...")
+	demonstrateCircuitBreaker(ctx, client, cfg)
 	
 	// Wait for metrics and traces to be exported
 	fmt.Println("⏳ Waiting 5 seconds for metrics and traces to be exported...")
@@ -617,17 +883,19 @@ func main() {
 
 	// Check observability tools status after operations
 	fmt.Println("🔍 Post-operation observability check:")
-	checkObservabilityTools(ctx, client)
+	checkObservabilityTools(ctx, cfg)
 
 	fmt.Println("📈 Access URLs:")
-	fmt.Println("  - Jaeger UI: http://localhost:16686")
-	fmt.Println("  - Prometheus UI: http://localhost:9090")
-	fmt.Println("  - OTEL Collector metrics: http://localhost:8889/metrics")
-	fmt.Println("🔍 Look for 'orchestrator', 'user-service', 'post-service' in Jaeger/Prometheus")
+	fmt.Printf("  - Jaeger UI: %s\n", cfg.JaegerURL)
+	fmt.Printf("  - Prometheus UI: %s\n", cfg.PrometheusURL)
+	fmt.Printf("  - OTEL Collector metrics: %s\n", cfg.CollectorMetricsURL)
+	fmt.Println("🔍 Look for 'orchestrator', 'user-service', 'post-service', 'comment-service' in Jaeger/Prometheus")
 	
 	fmt.Println("\n🎓 View & Exemplar Learning:")
 	fmt.Println("  1. Check Prometheus UI for 'user_service_response_time_custom' (View)")
 	fmt.Println("  2. Look for 'user_service_error_rate' (View)")
 	fmt.Println("  3. Click on exemplar links in histograms to jump to traces (Exemplar)")
 	fmt.Println("  4. Notice custom bucket boundaries in the histogram")
+	fmt.Println("  5. In Grafana Explore (Loki), open a log line's traceid to jump to its trace")
+	return nil
 }
\ No newline at end of file
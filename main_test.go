@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"otel-playground/internal/config"
+	"otel-playground/internal/httpclient"
+	"otel-playground/internal/telemetry/telemetrytest"
+)
+
+// upstreams は下流サービスと外部 API の代わりに 1 つのサーバーで各エンドポイントに答える。
+// fail に入れたパスは指定したステータスを返す
+type upstreams struct {
+	fail  map[string]int
+	block chan struct{} // nil でなければ閉じるかリクエストがキャンセルされるまで応答しない
+}
+
+func (u *upstreams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if u.block != nil {
+		select {
+		case <-u.block:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status, ok := u.fail[r.URL.Path]; ok {
+		w.WriteHeader(status)
+		return
+	}
+	var body any
+	switch r.URL.Path {
+	case "/users":
+		body = User{ID: 1, Name: "Alice", Email: "alice@example.com"}
+	case "/posts/by-user":
+		body = []Post{{ID: 1, UserID: 1, Title: "first"}, {ID: 2, UserID: 1, Title: "second"}}
+	case "/comments/by-post":
+		body = []Comment{{ID: 1, PostID: 1, AuthorName: "bob", Content: "hi"}}
+	case "/posts/1":
+		body = ExternalPost{UserID: 1, ID: 1, Title: "external"}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+// newTestAPI は stub を下流にしたプロフィール API を serveAPI と同じ計装で作る
+func newTestAPI(t *testing.T, stub *upstreams) (*telemetrytest.Harness, http.Handler) {
+	t.Helper()
+
+	h := telemetrytest.New(t)
+	client, cfg := newTestClient(t, stub)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}/profile", profileHandler(client, cfg.Concurrency()))
+	return h, mux
+}
+
+// newTestClient は stub を全サービスと外部 API の代わりにするクライアントを作る
+func newTestClient(t *testing.T, stub *upstreams) (*MicroserviceClient, *config.Orchestrator) {
+	t.Helper()
+
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	if stub.block != nil {
+		// srv.Close は応答中のハンドラを待つので、先に解放する
+		t.Cleanup(func() { close(stub.block) })
+	}
+
+	cfg := config.DefaultOrchestrator()
+	cfg.UserServiceURL, cfg.PostServiceURL, cfg.CommentServiceURL, cfg.ExternalAPIURL = srv.URL, srv.URL, srv.URL, srv.URL
+	// 失敗の扱いだけを見るため、リトライとサーキットブレーカーは効かせない
+	cfg.RetryMaxAttempts = 1
+	cfg.BreakerFailureThreshold = 100
+	client, err := newMicroserviceClient(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &cfg
+}
+
+func getProfile(handler http.Handler, ctx context.Context) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodGet, "/users/1/profile", nil))
+	return w
+}
+
+func TestProfileHandler(t *testing.T) {
+	_, handler := newTestAPI(t, &upstreams{})
+
+	w := getProfile(handler, context.Background())
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var profile UserProfile
+	if err := json.NewDecoder(w.Body).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.User.Name != "Alice" || len(profile.Posts) != 2 || len(profile.Posts[1].Comments) != 1 || profile.ExternalPost.Title != "external" {
+		t.Errorf("profile = %+v", profile)
+	}
+}
+
+func TestProfileHandlerUpstreamFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		fail map[string]int
+		want int
+	}{
+		// 1 つでも失敗すれば部分的なプロフィールは返さない
+		{"comments fail", map[string]int{"/comments/by-post": 500}, http.StatusBadGateway},
+		{"external api unavailable", map[string]int{"/posts/1": 503}, http.StatusBadGateway},
+		{"unknown user", map[string]int{"/users": 404}, http.StatusNotFound},
+		{"all fail", map[string]int{"/users": 500, "/posts/by-user": 500, "/comments/by-post": 500, "/posts/1": 500}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, handler := newTestAPI(t, &upstreams{fail: tt.fail})
+
+			w := getProfile(handler, context.Background())
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] == "" {
+				t.Errorf("body = %v (%v), want an error message", body, err)
+			}
+		})
+	}
+}
+
+func TestProfileHandlerCancellation(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		_, handler := newTestAPI(t, &upstreams{block: make(chan struct{})})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if w := getProfile(handler, ctx); w.Code != http.StatusGatewayTimeout {
+			t.Errorf("status = %d, want 504: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("client gone", func(t *testing.T) {
+		_, handler := newTestAPI(t, &upstreams{block: make(chan struct{})})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- getProfile(handler, ctx) }()
+		cancel()
+
+		// 下流の応答を待たずに戻り、途中までのプロフィールを成功として返さない
+		select {
+		case w := <-done:
+			if w.Code == http.StatusOK {
+				t.Errorf("status = 200 after the request was canceled: %s", w.Body)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler kept waiting for upstreams after the request was canceled")
+		}
+	})
+}
+
+func TestProfileHandlerRecordsError(t *testing.T) {
+	h, handler := newTestAPI(t, &upstreams{fail: map[string]int{"/posts/by-user": 500}})
+
+	w := getProfile(handler, context.Background())
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	// 失敗した下流の呼び出しは fanout の子スパンに残る
+	fetch := h.Span(t, "fetchUserPosts")
+	if fetch.Status.Code != codes.Error {
+		t.Errorf("fetchUserPosts status = %+v, want Error", fetch.Status)
+	}
+}
+
+func TestUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("failed to get user: %w", &statusError{StatusCode: 404}), http.StatusNotFound},
+		{fmt.Errorf("failed to get user: %w", &statusError{StatusCode: 500}), http.StatusBadGateway},
+		{fmt.Errorf("%w: localhost:8080", httpclient.ErrCircuitOpen), http.StatusServiceUnavailable},
+		{fmt.Errorf("failed to get user posts: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{context.Canceled, http.StatusBadGateway},
+		{errors.New("connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if got := upstreamStatus(tt.err); got != tt.want {
+			t.Errorf("upstreamStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFetchUserProfileCanceledBeforeStart(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			telemetrytest.New(t)
+			client, _ := newTestClient(t, &upstreams{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			// 何も取得していないのに nil エラーで空のプロフィールを返さない
+			profile, err := fetchUserProfile(ctx, client, 1, concurrency)
+			if !errors.Is(err, context.Canceled) || profile != nil {
+				t.Errorf("fetchUserProfile = %+v, %v; want context.Canceled", profile, err)
+			}
+		})
+	}
+}